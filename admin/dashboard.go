@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"embed"
+	"net/http"
+
+	"deeptrade/conf"
+	"deeptrade/utils"
+)
+
+//go:embed static/index.html
+var dashboardFS embed.FS
+
+// handleDashboard 控制台页面，页面通过管理接口读取数据
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found"})
+		return
+	}
+	page, err := dashboardFS.ReadFile("static/index.html")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// roleModels 一个角色的模型降级链
+type roleModels struct {
+	Role     string   `json:"role"`
+	Override string   `json:"override"` // 运行时指定的首选模型
+	Chain    []string `json:"chain"`
+}
+
+// modelStatus 开仓和持仓角色当前的模型降级链
+func modelStatus() []roleModels {
+	var result []roleModels
+	for _, role := range []string{"entry", "track"} {
+		hasPosition := role == "track"
+		rm := roleModels{Role: role, Override: utils.ModelOverride(hasPosition), Chain: []string{}}
+		for _, lc := range utils.LLMChain(hasPosition) {
+			rm.Chain = append(rm.Chain, lc.Model)
+		}
+		result = append(result, rm)
+	}
+	return result
+}
+
+// configSummary 配置摘要，不包含密钥和接口地址
+func configSummary() map[string]any {
+	cfg := conf.Get()
+	var models []map[string]any
+	for _, lc := range cfg.LLM {
+		models = append(models, map[string]any{
+			"model":          lc.Model,
+			"entry_enable":   lc.EntryEnable,
+			"track_enable":   lc.TrackEnable,
+			"entry_priority": lc.EntryPriority,
+			"track_priority": lc.TrackPriority,
+			"output_mode":    lc.OutputMode,
+		})
+	}
+	return map[string]any{
+		"environment": cfg.Binance.CurrentEnvironment,
+		"trading":     cfg.Trading,
+		"margin":      cfg.Margin,
+		"risk":        cfg.Risk,
+		"llm":         models,
+		"llm_cost":    cfg.LLMCost,
+		"calendar":    cfg.Calendar,
+		"trigger":     cfg.Trigger,
+		"features": map[string]bool{
+			"ensemble": cfg.Ensemble.Enable,
+			"pipeline": cfg.Pipeline.Enable,
+			"agent":    cfg.Agent.Enable,
+			"shadow":   cfg.Shadow.Enable,
+			"trigger":  cfg.Trigger.Enable,
+		},
+	}
+}
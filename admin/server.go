@@ -0,0 +1,324 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/task"
+	tradeflow "deeptrade/task/trade_flow"
+	"deeptrade/utils"
+)
+
+// Start 启动管理接口，监听地址为空时不启动，ctx 取消时关闭服务
+func Start(ctx context.Context) {
+	cfg := conf.Get().Admin
+	if cfg.Listen == "" {
+		return
+	}
+	if cfg.Token == "" {
+		logger.Warnf(ctx, "[管理接口] 未配置token，管理接口不启动")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kill", auth(cfg.Token, handleKill))
+	mux.HandleFunc("/rearm", auth(cfg.Token, handleRearm))
+	mux.HandleFunc("/halt", auth(cfg.Token, handleHaltState))
+	mux.HandleFunc("/cost", auth(cfg.Token, handleCost))
+	mux.HandleFunc("/shadow", auth(cfg.Token, handleShadow))
+	mux.HandleFunc("/report", auth(cfg.Token, handleReport))
+	// 只读查询
+	mux.HandleFunc("/status", auth(cfg.Token, handleStatus))
+	mux.HandleFunc("/position", auth(cfg.Token, handlePosition))
+	mux.HandleFunc("/decisions", auth(cfg.Token, handleDecisions))
+	mux.HandleFunc("/memory", auth(cfg.Token, handleMemory))
+	mux.HandleFunc("/tradeflow", auth(cfg.Token, handleTradeFlow))
+	mux.HandleFunc("/config", auth(cfg.Token, handleConfig))
+	// 控制操作
+	mux.HandleFunc("/pause", auth(cfg.Token, post(handlePause)))
+	mux.HandleFunc("/resume", auth(cfg.Token, post(handleResume)))
+	mux.HandleFunc("/cycle", auth(cfg.Token, post(handleCycle)))
+	mux.HandleFunc("/close", auth(cfg.Token, post(handleClose)))
+	mux.HandleFunc("/sltp", auth(cfg.Token, post(handleSLTP)))
+	mux.HandleFunc("/model", auth(cfg.Token, handleModel))
+	// 控制台页面不需要令牌，页面中的请求携带令牌
+	mux.HandleFunc("/", handleDashboard)
+
+	srv := &http.Server{Addr: cfg.Listen, Handler: mux}
+	go func() {
+		logger.Infof(ctx, "[管理接口] 监听 %s", cfg.Listen)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf(ctx, "[管理接口] 服务异常退出: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf(ctx, "[管理接口] 关闭服务失败: %v", err)
+		}
+	}()
+}
+
+// auth 校验请求头中的访问令牌
+func auth(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// 常量时间比较，避免通过响应时间逐位猜测令牌
+		if subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// post 只允许 POST 请求
+func post(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleKill 触发紧急停止
+func handleKill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "管理接口触发"
+	}
+	if err := task.TriggerKillSwitch(r.Context(), reason); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "state": task.GetHaltState()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"state": task.GetHaltState()})
+}
+
+// handleRearm 重新启用交易
+func handleRearm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+		return
+	}
+	if err := task.Rearm(r.Context()); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"state": task.GetHaltState()})
+}
+
+// handleHaltState 查询紧急停止状态
+func handleHaltState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"state": task.GetHaltState()})
+}
+
+// handleCost 查询LLM费用汇总及费用与交易结果对比
+func handleCost(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	resp := map[string]any{"summary": utils.GetCostSummary()}
+	report, err := task.BuildCostReport(days)
+	if err != nil {
+		resp["report_error"] = err.Error()
+	} else {
+		resp["report"] = report
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleShadow 查询影子模式挑战者与实盘的对比报告
+func handleShadow(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	report, err := task.BuildShadowReport(r.Context(), days)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"report": report})
+}
+
+// handleReport 生成最近 days 天的交易报告，format 为 html(默认) 或 md
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = task.ReportHTML
+	}
+	until := time.Now()
+	report, err := task.BuildReport(r.Context(), until.AddDate(0, 0, -days), until)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	content, err := report.Render(format)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	contentType := "text/html; charset=utf-8"
+	if format == task.ReportMarkdown {
+		contentType = "text/markdown; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(content))
+}
+
+// handleStatus 查询运行状态：交易时段、紧急停止、暂停、上次交易周期、模型和今日费用
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"environment":    conf.Get().Binance.CurrentEnvironment,
+		"working":        task.IsWork(),
+		"halt":           task.GetHaltState(),
+		"pause":          task.GetPauseState(),
+		"last_cycle":     task.LastCycleTime(),
+		"sleep_sec":      task.GetSleepSec(),
+		"models":         modelStatus(),
+		"llm_health":     utils.GetLLMHealth(),
+		"llm_cost_today": utils.TodayLLMCost(),
+		"currency":       conf.Get().LLMCost.Currency,
+	})
+}
+
+// handlePosition 查询当前持仓和止盈止损委托
+func handlePosition(w http.ResponseWriter, r *http.Request) {
+	status, err := task.GetPositionStatus(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleDecisions 查询最近 n 条决策的完整记录，默认10条，最多100条
+func handleDecisions(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	if n <= 0 {
+		n = 10
+	}
+	n = min(n, 100)
+	records, err := task.LastDecisionRecords(n)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"decisions": records})
+}
+
+// handleMemory 查询当前的持仓记忆
+func handleMemory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"entries": task.GetMemoryEntries(r.Context()), "text": task.GetMemory(r.Context())})
+}
+
+// handleTradeFlow 查询成交流缓存统计
+func handleTradeFlow(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, tradeflow.GetOnceTradeFlow().Stats())
+}
+
+// handleConfig 查询配置摘要，不包含密钥
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, configSummary())
+}
+
+// handlePause 暂停交易，不撤单不平仓
+func handlePause(w http.ResponseWriter, r *http.Request) {
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "管理接口暂停"
+	}
+	if err := task.Pause(r.Context(), reason); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pause": task.GetPauseState()})
+}
+
+// handleResume 恢复交易
+func handleResume(w http.ResponseWriter, r *http.Request) {
+	if err := task.Resume(r.Context()); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pause": task.GetPauseState()})
+}
+
+// handleCycle 立即开始下一个交易周期
+func handleCycle(w http.ResponseWriter, r *http.Request) {
+	if err := task.RequestCycle("管理接口手动触发"); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handleClose 市价平仓，side 为 LONG/SHORT 时只平该方向，为空时全部平仓
+func handleClose(w http.ResponseWriter, r *http.Request) {
+	side := strings.ToUpper(r.FormValue("side"))
+	if side != "" && side != "LONG" && side != "SHORT" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "side必须是LONG或SHORT"})
+		return
+	}
+	// 平仓不随请求断开而中断
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+	defer cancel()
+	if err := task.ClosePositions(ctx, side, "管理接口手动平仓"); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handleSLTP 调整当前持仓的止损止盈
+func handleSLTP(w http.ResponseWriter, r *http.Request) {
+	stopLoss, err1 := strconv.ParseFloat(r.FormValue("stop_loss"), 64)
+	takeProfit, err2 := strconv.ParseFloat(r.FormValue("take_profit"), 64)
+	if err1 != nil || err2 != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "stop_loss和take_profit必须是价格"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+	defer cancel()
+	if err := task.AdjustSLTP(ctx, stopLoss, takeProfit, "管理接口手动调整"); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handleModel GET 查询各角色的模型，POST 切换角色的首选模型，role 为 entry/track，model 为空时恢复配置
+func handleModel(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		role := r.FormValue("role")
+		if role != "entry" && role != "track" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "role必须是entry或track"})
+			return
+		}
+		if err := task.SetModelOverride(role == "track", r.FormValue("model")); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"models": modelStatus()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
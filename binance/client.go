@@ -1,12 +1,14 @@
 package binance
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/metrics"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"sort"
@@ -26,7 +28,7 @@ func GetOnceFuturesClient() *FuturesClient {
 	once.Do(func() {
 		client, err := GetFuturesClient()
 		if err != nil {
-			log.Printf("[市场数据] 创建期货客户端失败: %v", err)
+			logger.Errorf(context.Background(), "[市场数据] 创建期货客户端失败: %v", err)
 			panic(err)
 		}
 		fclient = client
@@ -34,8 +36,9 @@ func GetOnceFuturesClient() *FuturesClient {
 	return fclient
 }
 
-// RequestRateLimit 请求速率限制器
+// RequestRateLimit 请求速率限制器，可并发使用
 type RequestRateLimit struct {
+	mu        sync.Mutex
 	rateLimit int
 	interval  int
 	tokens    int
@@ -52,34 +55,54 @@ func NewRequestRateLimit(rateLimit, interval int) *RequestRateLimit {
 	}
 }
 
-// Wait 等待直到可以发送请求
-func (r *RequestRateLimit) Wait() {
-	now := time.Now()
-	elapsed := now.Sub(r.lastTime).Milliseconds()
+// Wait 等待直到可以发送请求，ctx 取消时提前返回
+func (r *RequestRateLimit) Wait(ctx context.Context) error {
+	if r.rateLimit <= 0 || r.interval <= 0 {
+		return nil
+	}
+	waited := false
+	for {
+		r.mu.Lock()
+		r.refill(time.Now())
+		if r.tokens > 0 {
+			r.tokens--
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
 
-	// 补充令牌
-	if elapsed >= int64(r.interval) {
-		r.tokens = r.rateLimit
-		r.lastTime = now
-	} else {
-		tokensToAdd := int(elapsed * int64(r.rateLimit) / int64(r.interval))
-		if tokensToAdd > 0 {
-			r.tokens += tokensToAdd
-			if r.tokens > r.rateLimit {
-				r.tokens = r.rateLimit
-			}
-			r.lastTime = now
+		// 没有令牌时等待补充一个令牌的时间，等待期间不持有锁
+		if !waited {
+			metrics.RateLimitWaits.Inc()
+			waited = true
+		}
+		waitTime := time.Duration(r.interval) * time.Millisecond / time.Duration(r.rateLimit)
+		if waitTime < time.Millisecond {
+			waitTime = time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitTime):
 		}
 	}
+}
 
-	// 如果没有令牌，等待
-	if r.tokens <= 0 {
-		waitTime := time.Duration(r.interval) * time.Millisecond
-		time.Sleep(waitTime)
+// refill 按经过的时间补充令牌，调用方需持有 mu
+func (r *RequestRateLimit) refill(now time.Time) {
+	elapsed := now.Sub(r.lastTime).Milliseconds()
+	if elapsed >= int64(r.interval) {
 		r.tokens = r.rateLimit
-		r.lastTime = time.Now()
-	} else {
-		r.tokens--
+		r.lastTime = now
+		return
+	}
+	tokensToAdd := int(elapsed * int64(r.rateLimit) / int64(r.interval))
+	if tokensToAdd > 0 {
+		r.tokens += tokensToAdd
+		if r.tokens > r.rateLimit {
+			r.tokens = r.rateLimit
+		}
+		r.lastTime = now
 	}
 }
 
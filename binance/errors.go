@@ -1,6 +1,7 @@
 package binance
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -35,6 +36,22 @@ const (
 	ErrCodeDuplicateOrder
 )
 
+var errorCodeNames = [...]string{
+	"unknown", "invalid_request", "invalid_json", "invalid_symbol", "invalid_interval",
+	"invalid_order_type", "invalid_time_in_force", "invalid_side", "invalid_quantity", "invalid_price",
+	"invalid_timestamp", "disconnected", "unauthorized", "too_many_requests", "internal_error",
+	"service_unavailable", "unknown_order", "order_rejected", "cancel_rejected", "no_such_order",
+	"insufficient_funds", "account_inactive", "duplicate_order",
+}
+
+// String 错误代码名称，用于日志和监控指标标签
+func (c ErrorCode) String() string {
+	if c >= 0 && int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return fmt.Sprintf("code_%d", int(c))
+}
+
 // Error 自定义错误类型
 type Error struct {
 	Code    ErrorCode `json:"code"`    // 错误代码
@@ -51,6 +68,15 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("binance error [%d]: %s", e.Code, e.Message)
 }
 
+// errorCodeOf 取错误的错误代码，非本包错误时为 ErrCodeUnknown
+func errorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrCodeUnknown
+}
+
 // NewError 创建新的错误
 func NewError(code ErrorCode, message, details, raw string) *Error {
 	return &Error{
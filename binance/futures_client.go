@@ -1,7 +1,10 @@
 package binance
 
 import (
+	"context"
 	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/metrics"
 	"deeptrade/utils"
 	"encoding/json"
 	"io"
@@ -38,6 +41,14 @@ const (
 	MarginTypeCross    MarginType = "CROSS"    // 全仓
 )
 
+// PositionMarginType 逐仓保证金调整方向
+type PositionMarginType int
+
+const (
+	PositionMarginAdd    PositionMarginType = 1 // 增加逐仓保证金
+	PositionMarginReduce PositionMarginType = 2 // 减少逐仓保证金
+)
+
 // WorkingType 工作类型
 type WorkingType string
 
@@ -161,17 +172,42 @@ type UserTrade struct {
 	Maker           bool   `json:"maker"`           // 是否挂单方
 }
 
+// PositionMarginResult 逐仓保证金调整结果
+type PositionMarginResult struct {
+	Amount float64            `json:"amount"` // 调整数量
+	Code   int                `json:"code"`   // 返回码
+	Msg    string             `json:"msg"`    // 返回信息
+	Type   PositionMarginType `json:"type"`   // 调整方向: 1增加 2减少
+}
+
 // NewFuturesClient 创建新的合约客户端 (保持向后兼容)
 func NewFuturesClient(config interface{}) (*FuturesClient, error) {
 	// 这个方法保持向后兼容，但建议使用 NewFuturesClientFromConfig
 	return NewFuturesClientFromConfig()
 }
 
-// doRequest 执行HTTP请求
-func (c *FuturesClient) doRequest(method, endpoint string, params map[string]string, needAuth bool) ([]byte, error) {
+// doRequest 执行HTTP请求，记录各接口的耗时和错误次数
+func (c *FuturesClient) doRequest(ctx context.Context, method, endpoint string, params map[string]string, needAuth bool) ([]byte, error) {
 	// 速率限制
-	c.rateLimit.Wait()
+	if err := c.rateLimit.Wait(ctx); err != nil {
+		return nil, NewError(ErrCodeDisconnected, "请求已取消", err.Error(), "")
+	}
+
+	start := time.Now()
+	body, err := c.send(ctx, method, endpoint, params, needAuth)
+	elapsed := time.Since(start)
+	metrics.BinanceRequestDuration.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+	if err != nil {
+		metrics.BinanceErrors.WithLabelValues(endpoint, errorCodeOf(err).String()).Inc()
+		logger.Warnf(ctx, "[币安] %s %s 失败(%dms): %v", method, endpoint, elapsed.Milliseconds(), err)
+		return body, err
+	}
+	logger.Debugf(ctx, "[币安] %s %s %dms", method, endpoint, elapsed.Milliseconds())
+	return body, nil
+}
 
+// send 构建并发送HTTP请求，解析错误响应
+func (c *FuturesClient) send(ctx context.Context, method, endpoint string, params map[string]string, needAuth bool) ([]byte, error) {
 	// 构建URL
 	fullURL := c.clientConfig.BaseURL + endpoint
 
@@ -194,7 +230,7 @@ func (c *FuturesClient) doRequest(method, endpoint string, params map[string]str
 				fullURL += "?" + queryString
 			}
 		}
-		req, err = http.NewRequest(method, fullURL, nil)
+		req, err = http.NewRequestWithContext(ctx, method, fullURL, nil)
 	} else {
 		// POST/PUT请求使用表单格式
 		formData := url.Values{}
@@ -209,10 +245,10 @@ func (c *FuturesClient) doRequest(method, endpoint string, params map[string]str
 			if queryString != "" {
 				fullURL += "?" + queryString
 			}
-			req, err = http.NewRequest(method, fullURL, nil)
+			req, err = http.NewRequestWithContext(ctx, method, fullURL, nil)
 		} else {
 			// 不需要认证的请求，参数作为表单数据发送
-			req, err = http.NewRequest(method, fullURL, strings.NewReader(formData.Encode()))
+			req, err = http.NewRequestWithContext(ctx, method, fullURL, strings.NewReader(formData.Encode()))
 			if err == nil {
 				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 			}
@@ -249,8 +285,9 @@ func (c *FuturesClient) doRequest(method, endpoint string, params map[string]str
 	}
 
 	// 检查API错误（即使HTTP状态码不是200也尝试解析）
+	// 币安错误码均为负数，部分写接口成功时会返回 {"code":200,"msg":"success"}
 	var apiErr APIError
-	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Code != 0 {
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Code < 0 {
 		return nil, ConvertAPIError(&apiErr)
 	}
 
@@ -263,7 +300,7 @@ func (c *FuturesClient) doRequest(method, endpoint string, params map[string]str
 }
 
 // retryRequest 带重试的请求
-func (c *FuturesClient) retryRequest(method, endpoint string, params map[string]string, needAuth bool) ([]byte, error) {
+func (c *FuturesClient) retryRequest(ctx context.Context, method, endpoint string, params map[string]string, needAuth bool) ([]byte, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= c.clientConfig.MaxRetries; attempt++ {
@@ -273,15 +310,23 @@ func (c *FuturesClient) retryRequest(method, endpoint string, params map[string]
 			for i := 1; i < attempt; i++ {
 				delay *= time.Duration(c.clientConfig.RetryBackoff)
 			}
-			time.Sleep(delay)
+			select {
+			case <-ctx.Done():
+				return nil, NewError(ErrCodeDisconnected, "请求已取消", ctx.Err().Error(), "")
+			case <-time.After(delay):
+			}
 		}
 
-		body, err := c.doRequest(method, endpoint, params, needAuth)
+		body, err := c.doRequest(ctx, method, endpoint, params, needAuth)
 		if err == nil {
 			return body, nil
 		}
 
 		lastErr = err
+		if ctx.Err() != nil {
+			// 上下文已取消，不再重试
+			break
+		}
 
 		// 某些错误不需要重试
 		if binanceErr, ok := err.(*Error); ok {
@@ -299,8 +344,8 @@ func (c *FuturesClient) retryRequest(method, endpoint string, params map[string]
 }
 
 // Ping 测试连接
-func (c *FuturesClient) Ping() error {
-	_, err := c.retryRequest("GET", "/fapi/v1/ping", nil, false)
+func (c *FuturesClient) Ping(ctx context.Context) error {
+	_, err := c.retryRequest(ctx, "GET", "/fapi/v1/ping", nil, false)
 	if err != nil {
 		return err
 	}
@@ -308,8 +353,8 @@ func (c *FuturesClient) Ping() error {
 }
 
 // GetServerTime 获取服务器时间
-func (c *FuturesClient) GetServerTime() (*ServerTime, error) {
-	body, err := c.retryRequest("GET", "/fapi/v1/time", nil, false)
+func (c *FuturesClient) GetServerTime(ctx context.Context) (*ServerTime, error) {
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/time", nil, false)
 	if err != nil {
 		return nil, err
 	}
@@ -323,8 +368,8 @@ func (c *FuturesClient) GetServerTime() (*ServerTime, error) {
 }
 
 // GetExchangeInfo 获取交易规则和交易对信息
-func (c *FuturesClient) GetExchangeInfo() ([]SymbolInfo, error) {
-	body, err := c.retryRequest("GET", "/fapi/v1/exchangeInfo", nil, false)
+func (c *FuturesClient) GetExchangeInfo(ctx context.Context) ([]SymbolInfo, error) {
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/exchangeInfo", nil, false)
 	if err != nil {
 		return nil, err
 	}
@@ -341,12 +386,12 @@ func (c *FuturesClient) GetExchangeInfo() ([]SymbolInfo, error) {
 }
 
 // Get24hrTicker 获取24小时价格变动统计
-func (c *FuturesClient) Get24hrTicker(symbol Symbol) (*FuturesTicker, error) {
+func (c *FuturesClient) Get24hrTicker(ctx context.Context, symbol Symbol) (*FuturesTicker, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/ticker/24hr", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/ticker/24hr", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -360,13 +405,13 @@ func (c *FuturesClient) Get24hrTicker(symbol Symbol) (*FuturesTicker, error) {
 }
 
 // GetDepth 获取深度信息
-func (c *FuturesClient) GetDepth(symbol Symbol, limit DepthLevel) (*Depth, error) {
+func (c *FuturesClient) GetDepth(ctx context.Context, symbol Symbol, limit DepthLevel) (*Depth, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 		"limit":  strconv.Itoa(int(limit)),
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/depth", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/depth", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +458,7 @@ func (c *FuturesClient) GetDepth(symbol Symbol, limit DepthLevel) (*Depth, error
 }
 
 // GetKlines 获取K线数据
-func (c *FuturesClient) GetKlines(symbol Symbol, interval KlineInterval, limit int) ([]Kline, error) {
+func (c *FuturesClient) GetKlines(ctx context.Context, symbol Symbol, interval KlineInterval, limit int) ([]Kline, error) {
 	params := map[string]string{
 		"symbol":   string(symbol),
 		"interval": string(interval),
@@ -423,7 +468,47 @@ func (c *FuturesClient) GetKlines(symbol Symbol, interval KlineInterval, limit i
 		params["limit"] = strconv.Itoa(limit)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/klines", params, false)
+	klines, err := c.getKlines(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 排除最后一条正在形成的K线（数据不完整）
+	// 特别是在K线周期即将结束时，成交量等数据会显示异常值如"2.333"
+	if len(klines) > 1 {
+		klines = klines[:len(klines)-1]
+	}
+
+	return klines, nil
+}
+
+// GetKlinesRange 获取时间范围内的K线数据，endTime 为0时不限制结束时间，只排除尚未收盘的K线
+func (c *FuturesClient) GetKlinesRange(ctx context.Context, symbol Symbol, interval KlineInterval, startTime, endTime int64, limit int) ([]Kline, error) {
+	params := map[string]string{
+		"symbol":    string(symbol),
+		"interval":  string(interval),
+		"startTime": strconv.FormatInt(startTime, 10),
+	}
+	if endTime > 0 {
+		params["endTime"] = strconv.FormatInt(endTime, 10)
+	}
+	if limit > 0 {
+		params["limit"] = strconv.Itoa(limit)
+	}
+
+	klines, err := c.getKlines(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(klines); n > 0 && klines[n-1].CloseTime >= time.Now().UnixMilli() {
+		klines = klines[:n-1]
+	}
+	return klines, nil
+}
+
+// getKlines 请求并解析K线数据
+func (c *FuturesClient) getKlines(ctx context.Context, params map[string]string) ([]Kline, error) {
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/klines", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -456,27 +541,21 @@ func (c *FuturesClient) GetKlines(symbol Symbol, interval KlineInterval, limit i
 		klines = append(klines, kline)
 	}
 
-	// 排除最后一条正在形成的K线（数据不完整）
-	// 特别是在K线周期即将结束时，成交量等数据会显示异常值如"2.333"
-	if len(klines) > 1 {
-		klines = klines[:len(klines)-1]
-	}
-
 	return klines, nil
 }
 
 // GetKlines1h 获取1小时K线数据
-func (c *FuturesClient) GetKlines1h(symbol Symbol, limit int) ([]Kline, error) {
-	return c.GetKlines(symbol, KlineInterval1h, limit)
+func (c *FuturesClient) GetKlines1h(ctx context.Context, symbol Symbol, limit int) ([]Kline, error) {
+	return c.GetKlines(ctx, symbol, KlineInterval1h, limit)
 }
 
 // GetKlines4h 获取4小时K线数据
-func (c *FuturesClient) GetKlines4h(symbol Symbol, limit int) ([]Kline, error) {
-	return c.GetKlines(symbol, KlineInterval4h, limit)
+func (c *FuturesClient) GetKlines4h(ctx context.Context, symbol Symbol, limit int) ([]Kline, error) {
+	return c.GetKlines(ctx, symbol, KlineInterval4h, limit)
 }
 
 // GetRecentTrades 获取最近交易记录
-func (c *FuturesClient) GetRecentTrades(symbol Symbol, limit int) ([]RecentTrade, error) {
+func (c *FuturesClient) GetRecentTrades(ctx context.Context, symbol Symbol, limit int) ([]RecentTrade, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -485,7 +564,7 @@ func (c *FuturesClient) GetRecentTrades(symbol Symbol, limit int) ([]RecentTrade
 		params["limit"] = strconv.Itoa(limit)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/trades", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/trades", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -499,14 +578,14 @@ func (c *FuturesClient) GetRecentTrades(symbol Symbol, limit int) ([]RecentTrade
 }
 
 // GetMarkPrice 获取标记价格
-func (c *FuturesClient) GetMarkPrice(symbol Symbol) (*MarkPrice, error) {
+func (c *FuturesClient) GetMarkPrice(ctx context.Context, symbol Symbol) (*MarkPrice, error) {
 	params := map[string]string{}
 
 	if symbol != "" {
 		params["symbol"] = string(symbol)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/premiumIndex", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/premiumIndex", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -535,12 +614,12 @@ func (c *FuturesClient) GetMarkPrice(symbol Symbol) (*MarkPrice, error) {
 }
 
 // GetLatestFundingRate 获取最新资金费率
-func (c *FuturesClient) GetLatestFundingRate(symbol Symbol) (*FundingRateHistory, error) {
+func (c *FuturesClient) GetLatestFundingRate(ctx context.Context, symbol Symbol) (*FundingRateHistory, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/fundingRate", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/fundingRate", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -559,7 +638,7 @@ func (c *FuturesClient) GetLatestFundingRate(symbol Symbol) (*FundingRateHistory
 }
 
 // GetFundingRateHistory 获取资金费率历史
-func (c *FuturesClient) GetFundingRateHistory(symbol Symbol, limit int, startTime, endTime int64) ([]FundingRateHistory, error) {
+func (c *FuturesClient) GetFundingRateHistory(ctx context.Context, symbol Symbol, limit int, startTime, endTime int64) ([]FundingRateHistory, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -578,7 +657,7 @@ func (c *FuturesClient) GetFundingRateHistory(symbol Symbol, limit int, startTim
 		params["endTime"] = strconv.FormatInt(endTime, 10)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/fundingRate", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/fundingRate", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -592,12 +671,12 @@ func (c *FuturesClient) GetFundingRateHistory(symbol Symbol, limit int, startTim
 }
 
 // GetOpenInterest 获取持仓量（Open Interest）
-func (c *FuturesClient) GetOpenInterest(symbol Symbol) (*OpenInterest, error) {
+func (c *FuturesClient) GetOpenInterest(ctx context.Context, symbol Symbol) (*OpenInterest, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/openInterest", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/openInterest", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -611,10 +690,10 @@ func (c *FuturesClient) GetOpenInterest(symbol Symbol) (*OpenInterest, error) {
 }
 
 // GetAccountInfo 获取合约账户信息（需要API密钥）
-func (c *FuturesClient) GetAccountInfo() (*FuturesAccountInfo, error) {
+func (c *FuturesClient) GetAccountInfo(ctx context.Context) (*FuturesAccountInfo, error) {
 	params := map[string]string{}
 
-	body, err := c.retryRequest("GET", "/fapi/v2/account", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v2/account", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -628,14 +707,14 @@ func (c *FuturesClient) GetAccountInfo() (*FuturesAccountInfo, error) {
 }
 
 // GetPositions 获取持仓信息（需要API密钥）
-func (c *FuturesClient) GetPositions(symbol Symbol) ([]Position, error) {
+func (c *FuturesClient) GetPositions(ctx context.Context, symbol Symbol) ([]Position, error) {
 	params := map[string]string{}
 
 	if symbol != "" {
 		params["symbol"] = string(symbol)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v2/positionRisk", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v2/positionRisk", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -649,13 +728,13 @@ func (c *FuturesClient) GetPositions(symbol Symbol) ([]Position, error) {
 }
 
 // SetLeverage 设置杠杆倍数（需要API密钥）
-func (c *FuturesClient) SetLeverage(symbol Symbol, leverage int) error {
+func (c *FuturesClient) SetLeverage(ctx context.Context, symbol Symbol, leverage int) error {
 	params := map[string]string{
 		"symbol":   string(symbol),
 		"leverage": strconv.Itoa(leverage),
 	}
 
-	_, err := c.retryRequest("POST", "/fapi/v1/leverage", params, true)
+	_, err := c.retryRequest(ctx, "POST", "/fapi/v1/leverage", params, true)
 	if err != nil {
 		return err
 	}
@@ -664,13 +743,13 @@ func (c *FuturesClient) SetLeverage(symbol Symbol, leverage int) error {
 }
 
 // SetMarginType 设置保证金模式（需要API密钥）
-func (c *FuturesClient) SetMarginType(symbol Symbol, marginType MarginType) error {
+func (c *FuturesClient) SetMarginType(ctx context.Context, symbol Symbol, marginType MarginType) error {
 	params := map[string]string{
 		"symbol":     string(symbol),
 		"marginType": string(marginType),
 	}
 
-	_, err := c.retryRequest("POST", "/fapi/v1/marginType", params, true)
+	_, err := c.retryRequest(ctx, "POST", "/fapi/v1/marginType", params, true)
 	if err != nil {
 		return err
 	}
@@ -678,8 +757,44 @@ func (c *FuturesClient) SetMarginType(symbol Symbol, marginType MarginType) erro
 	return nil
 }
 
+// ModifyIsolatedMargin 调整逐仓保证金（需要API密钥）
+func (c *FuturesClient) ModifyIsolatedMargin(ctx context.Context, symbol Symbol, positionSide PositionSide, amount float64, marginType PositionMarginType) (*PositionMarginResult, error) {
+	params := map[string]string{
+		"symbol": string(symbol),
+		"amount": strconv.FormatFloat(amount, 'f', 2, 64),
+		"type":   strconv.Itoa(int(marginType)),
+	}
+
+	// 单向持仓模式下positionSide为BOTH，可以不传
+	if positionSide != "" && positionSide != PositionSideBoth {
+		params["positionSide"] = string(positionSide)
+	}
+
+	body, err := c.retryRequest(ctx, "POST", "/fapi/v1/positionMargin", params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var result PositionMarginResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, NewError(ErrCodeInvalidJSON, "解析逐仓保证金调整结果失败", err.Error(), string(body))
+	}
+
+	return &result, nil
+}
+
+// AddIsolatedMargin 增加逐仓保证金
+func (c *FuturesClient) AddIsolatedMargin(ctx context.Context, symbol Symbol, positionSide PositionSide, amount float64) (*PositionMarginResult, error) {
+	return c.ModifyIsolatedMargin(ctx, symbol, positionSide, amount, PositionMarginAdd)
+}
+
+// ReduceIsolatedMargin 减少逐仓保证金
+func (c *FuturesClient) ReduceIsolatedMargin(ctx context.Context, symbol Symbol, positionSide PositionSide, amount float64) (*PositionMarginResult, error) {
+	return c.ModifyIsolatedMargin(ctx, symbol, positionSide, amount, PositionMarginReduce)
+}
+
 // SetPositionMode 设置持仓模式（需要API密钥）
-func (c *FuturesClient) SetPositionMode(dualSidePosition bool) error {
+func (c *FuturesClient) SetPositionMode(ctx context.Context, dualSidePosition bool) error {
 	params := map[string]string{
 		"dualSidePosition": "false",
 	}
@@ -688,7 +803,7 @@ func (c *FuturesClient) SetPositionMode(dualSidePosition bool) error {
 		params["dualSidePosition"] = "true"
 	}
 
-	_, err := c.retryRequest("POST", "/fapi/v1/positionSide/dual", params, true)
+	_, err := c.retryRequest(ctx, "POST", "/fapi/v1/positionSide/dual", params, true)
 	if err != nil {
 		return err
 	}
@@ -697,8 +812,8 @@ func (c *FuturesClient) SetPositionMode(dualSidePosition bool) error {
 }
 
 // GetPositionMode 获取当前持仓模式（需要API密钥）
-func (c *FuturesClient) GetPositionMode() (bool, error) {
-	body, err := c.retryRequest("GET", "/fapi/v1/positionSide/dual", nil, true)
+func (c *FuturesClient) GetPositionMode(ctx context.Context) (bool, error) {
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/positionSide/dual", nil, true)
 	if err != nil {
 		return false, err
 	}
@@ -714,7 +829,7 @@ func (c *FuturesClient) GetPositionMode() (bool, error) {
 }
 
 // NewOrder 下新订单（需要API密钥）
-func (c *FuturesClient) NewOrder(req *NewOrderRequest, positionSide PositionSide) (*Order, error) {
+func (c *FuturesClient) NewOrder(ctx context.Context, req *NewOrderRequest, positionSide PositionSide) (*Order, error) {
 	params := map[string]string{
 		"symbol": string(req.Symbol),
 		"side":   string(req.Side),
@@ -752,21 +867,24 @@ func (c *FuturesClient) NewOrder(req *NewOrderRequest, positionSide PositionSide
 		params["workingType"] = string(req.WorkingType)
 	}
 
-	body, err := c.retryRequest("POST", "/fapi/v1/order", params, true)
+	body, err := c.retryRequest(ctx, "POST", "/fapi/v1/order", params, true)
 	if err != nil {
+		metrics.Orders.WithLabelValues(string(req.Type), errorCodeOf(err).String()).Inc()
 		return nil, err
 	}
 
 	var order Order
 	if err := json.Unmarshal(body, &order); err != nil {
+		metrics.Orders.WithLabelValues(string(req.Type), ErrCodeInvalidJSON.String()).Inc()
 		return nil, NewError(ErrCodeInvalidJSON, "解析订单信息失败", err.Error(), string(body))
 	}
+	metrics.Orders.WithLabelValues(string(req.Type), strings.ToLower(string(order.Status))).Inc()
 
 	return &order, nil
 }
 
 // GetOrder 查询订单（需要API密钥）
-func (c *FuturesClient) GetOrder(symbol Symbol, orderId int64, origClientOrderId string) (*Order, error) {
+func (c *FuturesClient) GetOrder(ctx context.Context, symbol Symbol, orderId int64, origClientOrderId string) (*Order, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -779,7 +897,7 @@ func (c *FuturesClient) GetOrder(symbol Symbol, orderId int64, origClientOrderId
 		params["origClientOrderId"] = origClientOrderId
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/order", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/order", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -793,7 +911,7 @@ func (c *FuturesClient) GetOrder(symbol Symbol, orderId int64, origClientOrderId
 }
 
 // CancelOrder 取消订单（需要API密钥）
-func (c *FuturesClient) CancelOrder(symbol Symbol, orderId int64, origClientOrderId string) (*Order, error) {
+func (c *FuturesClient) CancelOrder(ctx context.Context, symbol Symbol, orderId int64, origClientOrderId string) (*Order, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -806,7 +924,7 @@ func (c *FuturesClient) CancelOrder(symbol Symbol, orderId int64, origClientOrde
 		params["origClientOrderId"] = origClientOrderId
 	}
 
-	body, err := c.retryRequest("DELETE", "/fapi/v1/order", params, true)
+	body, err := c.retryRequest(ctx, "DELETE", "/fapi/v1/order", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -820,12 +938,12 @@ func (c *FuturesClient) CancelOrder(symbol Symbol, orderId int64, origClientOrde
 }
 
 // CancelAllOpenOrders 取消所有挂单（需要API密钥）
-func (c *FuturesClient) CancelAllOpenOrders(symbol Symbol) ([]Order, error) {
+func (c *FuturesClient) CancelAllOpenOrders(ctx context.Context, symbol Symbol) ([]Order, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
 
-	body, err := c.retryRequest("DELETE", "/fapi/v1/allOpenOrders", params, true)
+	body, err := c.retryRequest(ctx, "DELETE", "/fapi/v1/allOpenOrders", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -839,14 +957,14 @@ func (c *FuturesClient) CancelAllOpenOrders(symbol Symbol) ([]Order, error) {
 }
 
 // GetOpenOrders 查询当前挂单（需要API密钥）
-func (c *FuturesClient) GetOpenOrders(symbol Symbol) ([]Order, error) {
+func (c *FuturesClient) GetOpenOrders(ctx context.Context, symbol Symbol) ([]Order, error) {
 	params := map[string]string{}
 
 	if symbol != "" {
 		params["symbol"] = string(symbol)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/openOrders", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/openOrders", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -860,7 +978,7 @@ func (c *FuturesClient) GetOpenOrders(symbol Symbol) ([]Order, error) {
 }
 
 // GetOrderHistory 查询所有订单（需要API密钥）
-func (c *FuturesClient) GetOrderHistory(symbol Symbol, limit int, orderId, startTime, endTime int64) ([]Order, error) {
+func (c *FuturesClient) GetOrderHistory(ctx context.Context, symbol Symbol, limit int, orderId, startTime, endTime int64) ([]Order, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -881,7 +999,7 @@ func (c *FuturesClient) GetOrderHistory(symbol Symbol, limit int, orderId, start
 		params["endTime"] = strconv.FormatInt(endTime, 10)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/allOrders", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/allOrders", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -895,7 +1013,7 @@ func (c *FuturesClient) GetOrderHistory(symbol Symbol, limit int, orderId, start
 }
 
 // GetUserTrades 获取用户成交记录（需要API密钥）
-func (c *FuturesClient) GetUserTrades(symbol Symbol, limit int, orderId, startTime, endTime int64) ([]UserTrade, error) {
+func (c *FuturesClient) GetUserTrades(ctx context.Context, symbol Symbol, limit int, orderId, startTime, endTime int64) ([]UserTrade, error) {
 	params := map[string]string{
 		"symbol": string(symbol),
 	}
@@ -916,7 +1034,7 @@ func (c *FuturesClient) GetUserTrades(symbol Symbol, limit int, orderId, startTi
 		params["endTime"] = strconv.FormatInt(endTime, 10)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/userTrades", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/userTrades", params, true)
 	if err != nil {
 		return nil, err
 	}
@@ -930,7 +1048,7 @@ func (c *FuturesClient) GetUserTrades(symbol Symbol, limit int, orderId, startTi
 }
 
 // GetIncomeHistory 获取收入历史（需要API密钥）
-func (c *FuturesClient) GetIncomeHistory(symbol string, incomeType string, limit int, startTime, endTime int64) ([]FundingRateHistory, error) {
+func (c *FuturesClient) GetIncomeHistory(ctx context.Context, symbol string, incomeType string, limit int, startTime, endTime int64) ([]Income, error) {
 	params := map[string]string{}
 
 	if symbol != "" {
@@ -953,12 +1071,12 @@ func (c *FuturesClient) GetIncomeHistory(symbol string, incomeType string, limit
 		params["endTime"] = strconv.FormatInt(endTime, 10)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/income", params, true)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/income", params, true)
 	if err != nil {
 		return nil, err
 	}
 
-	var incomeHistory []FundingRateHistory
+	var incomeHistory []Income
 	if err := json.Unmarshal(body, &incomeHistory); err != nil {
 		return nil, NewError(ErrCodeInvalidJSON, "解析收入历史失败", err.Error(), string(body))
 	}
@@ -967,7 +1085,7 @@ func (c *FuturesClient) GetIncomeHistory(symbol string, incomeType string, limit
 }
 
 // GetTopLongShortPositionRatio 获取大户持仓量多空比
-func (c *FuturesClient) GetTopLongShortPositionRatio(symbol Symbol, period string, limit int) ([]TopLongShortPositionRatio, error) {
+func (c *FuturesClient) GetTopLongShortPositionRatio(ctx context.Context, symbol Symbol, period string, limit int) ([]TopLongShortPositionRatio, error) {
 	params := map[string]interface{}{
 		"symbol": string(symbol),
 		"period": period,
@@ -978,20 +1096,20 @@ func (c *FuturesClient) GetTopLongShortPositionRatio(symbol Symbol, period strin
 	}
 	var ratios []TopLongShortPositionRatio
 	client := utils.GetProxyHTTPClient(conf.Get().Binance.DefaultProxy, conf.Get().Binance.Timeout)
-	resp := requests.NewHTTPRequest("https://fapi.binance.com/futures/data/topLongShortPositionRatio").SetClient(client).SetQueryParams(params).ToJSON(&ratios)
+	resp := requests.NewHTTPRequest("https://fapi.binance.com/futures/data/topLongShortPositionRatio").SetClient(client).SetQueryParams(params).WithContext(ctx).ToJSON(&ratios)
 
 	return ratios, resp.Error
 }
 
 // GetBookTicker 获取当前最优挂单信息
-func (c *FuturesClient) GetBookTicker(symbol Symbol) (*BookTicker, error) {
+func (c *FuturesClient) GetBookTicker(ctx context.Context, symbol Symbol) (*BookTicker, error) {
 	params := map[string]string{}
 
 	if symbol != "" {
 		params["symbol"] = string(symbol)
 	}
 
-	body, err := c.retryRequest("GET", "/fapi/v1/ticker/bookTicker", params, false)
+	body, err := c.retryRequest(ctx, "GET", "/fapi/v1/ticker/bookTicker", params, false)
 	if err != nil {
 		return nil, err
 	}
@@ -1026,7 +1144,7 @@ func (c *FuturesClient) GetBookTicker(symbol Symbol) (*BookTicker, error) {
 }
 
 // GetTopLongShortAccountRatio 获取大户账户数多空比
-func (c *FuturesClient) GetTopLongShortAccountRatio(symbol Symbol, period string, limit int) ([]TopLongShortAccountRatio, error) {
+func (c *FuturesClient) GetTopLongShortAccountRatio(ctx context.Context, symbol Symbol, period string, limit int) ([]TopLongShortAccountRatio, error) {
 	params := map[string]interface{}{
 		"symbol": string(symbol),
 		"period": period,
@@ -1037,6 +1155,22 @@ func (c *FuturesClient) GetTopLongShortAccountRatio(symbol Symbol, period string
 
 	var ratios []TopLongShortAccountRatio
 	client := utils.GetProxyHTTPClient(conf.Get().Binance.DefaultProxy, conf.Get().Binance.Timeout)
-	resp := requests.NewHTTPRequest("https://fapi.binance.com/futures/data/topLongShortAccountRatio").SetClient(client).SetQueryParams(params).ToJSON(&ratios)
+	resp := requests.NewHTTPRequest("https://fapi.binance.com/futures/data/topLongShortAccountRatio").SetClient(client).SetQueryParams(params).WithContext(ctx).ToJSON(&ratios)
 	return ratios, resp.Error
 }
+
+// GetOpenInterestHistory 获取持仓量历史
+func (c *FuturesClient) GetOpenInterestHistory(ctx context.Context, symbol Symbol, period string, limit int) ([]OpenInterestHistory, error) {
+	params := map[string]interface{}{
+		"symbol": string(symbol),
+		"period": period,
+	}
+	if limit > 0 {
+		params["limit"] = strconv.Itoa(limit)
+	}
+
+	var history []OpenInterestHistory
+	client := utils.GetProxyHTTPClient(conf.Get().Binance.DefaultProxy, conf.Get().Binance.Timeout)
+	resp := requests.NewHTTPRequest("https://fapi.binance.com/futures/data/openInterestHist").SetClient(client).SetQueryParams(params).WithContext(ctx).ToJSON(&history)
+	return history, resp.Error
+}
@@ -1,6 +1,7 @@
 package binance_test
 
 import (
+	"context"
 	"deeptrade/binance"
 	"deeptrade/conf"
 	"deeptrade/task"
@@ -29,37 +30,37 @@ func GetFuturesClient() *binance.FuturesClient {
 
 func TestFuturesGetPositions(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetPositions(binance.ETHUSDT_PERP)
+	data, _ := client.GetPositions(context.Background(), binance.ETHUSDT_PERP)
 	t.Log(jsondata(data))
 }
 
 func TestGetFundingRateHistory(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetFundingRateHistory(binance.ETHUSDT_PERP, 6, 0, 0)
+	data, _ := client.GetFundingRateHistory(context.Background(), binance.ETHUSDT_PERP, 6, 0, 0)
 	t.Log(jsondata(data))
 }
 
 func TestGetBookTicker(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetBookTicker(binance.ETHUSDT_PERP)
+	data, _ := client.GetBookTicker(context.Background(), binance.ETHUSDT_PERP)
 	t.Log(jsondata(data))
 }
 
 func TestGetKlines(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetKlines(binance.ETHUSDT_PERP, binance.KlineInterval3m, 30)
+	data, _ := client.GetKlines(context.Background(), binance.ETHUSDT_PERP, binance.KlineInterval3m, 30)
 	t.Log(task.CSVData(data))
 }
 
 func TestGetRecentTrades(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetRecentTrades(binance.ETHUSDT_PERP, 1000)
+	data, _ := client.GetRecentTrades(context.Background(), binance.ETHUSDT_PERP, 1000)
 	t.Log(jsondata(data))
 }
 
 func TestGetOpenOrders(t *testing.T) {
 	client := GetFuturesClient()
-	data, _ := client.GetOpenOrders(binance.ETHUSDT_PERP)
+	data, _ := client.GetOpenOrders(context.Background(), binance.ETHUSDT_PERP)
 	t.Log(jsondata(data))
 }
 
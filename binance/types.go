@@ -303,6 +303,33 @@ type OpenInterest struct {
 	Timestamp         int64  `json:"timestamp"`         // 时间戳
 }
 
+// OpenInterestHistory 持仓量历史
+type OpenInterestHistory struct {
+	Symbol               string `json:"symbol"`               // 交易对
+	SumOpenInterest      string `json:"sumOpenInterest"`      // 持仓总数量
+	SumOpenInterestValue string `json:"sumOpenInterestValue"` // 持仓总价值
+	Timestamp            int64  `json:"timestamp"`            // 时间戳
+}
+
+// 收入类型
+const (
+	IncomeTypeRealizedPnl = "REALIZED_PNL" // 已实现盈亏
+	IncomeTypeFundingFee  = "FUNDING_FEE"  // 资金费用
+	IncomeTypeCommission  = "COMMISSION"   // 手续费
+)
+
+// Income 账户收入流水
+type Income struct {
+	Symbol     string `json:"symbol"`     // 交易对
+	IncomeType string `json:"incomeType"` // 收入类型
+	Income     string `json:"income"`     // 金额，正数为收入
+	Asset      string `json:"asset"`      // 资产
+	Info       string `json:"info"`       // 备注
+	Time       int64  `json:"time"`       // 时间
+	TranID     int64  `json:"tranId"`     // 流水ID
+	TradeID    string `json:"tradeId"`    // 成交ID
+}
+
 // TopLongShortPositionRatio 大户持仓量多空比
 type TopLongShortPositionRatio struct {
 	Symbol         string `json:"symbol"`         // 交易对
@@ -0,0 +1,279 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+)
+
+// 计算交易时段时向后查找的最大天数
+const lookaheadDays = 14
+
+// Event 重大事件，例如 CPI、FOMC
+type Event struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// Window 交易时段区间 [Start, End)
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains 是否在区间内
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// session 解析后的每周时段，时间为当天零点起的分钟数
+type session struct {
+	weekdays map[time.Weekday]bool
+	start    int
+	end      int
+}
+
+// Calendar 交易日历
+type Calendar struct {
+	loc          *time.Location
+	sessions     []session
+	holidays     map[string]bool
+	events       []Event
+	bufferBefore time.Duration
+	bufferAfter  time.Duration
+	noNewBefore  time.Duration
+}
+
+var (
+	calendar     *Calendar
+	calendarErr  error
+	calendarOnce sync.Once
+)
+
+// Init 按配置创建交易日历，配置有误或事件文件加载失败时返回错误，启动时调用以便配置错误时直接退出
+func Init() error {
+	calendarOnce.Do(func() {
+		cg := conf.Get().Calendar
+		c, err := New(cg)
+		if err != nil {
+			calendarErr = fmt.Errorf("交易日历配置错误: %v", err)
+			return
+		}
+		if cg.EventsFile != "" {
+			events, err := LoadEvents(cg.EventsFile)
+			if err != nil {
+				calendarErr = fmt.Errorf("加载交易日历事件文件失败: %v", err)
+				return
+			}
+			c.SetEvents(events)
+		}
+		calendar = c
+	})
+	return calendarErr
+}
+
+// GetOnceCalendar 获取交易日历；配置有误时不能退回到全天候交易，直接 panic，启动时应先调用 Init 校验
+func GetOnceCalendar() *Calendar {
+	if err := Init(); err != nil {
+		panic(err)
+	}
+	return calendar
+}
+
+// New 根据配置创建交易日历，未配置任何时段时视为全天候交易
+func New(cg conf.CalendarConf) (*Calendar, error) {
+	loc := time.Local
+	if cg.Timezone != "" {
+		l, err := time.LoadLocation(cg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("时区%s无效: %v", cg.Timezone, err)
+		}
+		loc = l
+	}
+
+	c := &Calendar{
+		loc:          loc,
+		holidays:     make(map[string]bool),
+		bufferBefore: time.Duration(cg.EventBufferBeforeMin) * time.Minute,
+		bufferAfter:  time.Duration(cg.EventBufferAfterMin) * time.Minute,
+		noNewBefore:  time.Duration(cg.NoNewPositionMin) * time.Minute,
+	}
+
+	for _, sc := range cg.Sessions {
+		start, err := parseClock(sc.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(sc.End)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("交易时段%s-%s结束时间必须晚于开始时间", sc.Start, sc.End)
+		}
+		s := session{weekdays: make(map[time.Weekday]bool), start: start, end: end}
+		for _, d := range sc.Weekdays {
+			if d < 0 || d > 6 {
+				return nil, fmt.Errorf("交易时段星期取值无效: %d", d)
+			}
+			s.weekdays[time.Weekday(d)] = true
+		}
+		c.sessions = append(c.sessions, s)
+	}
+	if len(cg.Sessions) == 0 {
+		all := session{weekdays: make(map[time.Weekday]bool), start: 0, end: 24 * 60}
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			all.weekdays[d] = true
+		}
+		c.sessions = append(c.sessions, all)
+	}
+
+	for _, h := range cg.Holidays {
+		if _, err := time.ParseInLocation("2006-01-02", h, loc); err != nil {
+			return nil, fmt.Errorf("休市日期%s格式无效: %v", h, err)
+		}
+		c.holidays[h] = true
+	}
+	return c, nil
+}
+
+// LoadEvents 从JSON文件加载重大事件
+func LoadEvents(path string) ([]Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("解析事件文件失败: %v", err)
+	}
+	return events, nil
+}
+
+// SetEvents 设置重大事件列表
+func (c *Calendar) SetEvents(events []Event) {
+	sorted := append([]Event(nil), events...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	c.events = sorted
+}
+
+// Location 日历使用的时区
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// InSession 判断时间是否在交易时段内
+func (c *Calendar) InSession(t time.Time) bool {
+	_, ok := c.CurrentWindow(t)
+	return ok
+}
+
+// CurrentWindow 返回时间所在的交易时段，相邻时段会合并
+func (c *Calendar) CurrentWindow(t time.Time) (Window, bool) {
+	for _, w := range c.windows(t) {
+		if w.Contains(t) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// NextBoundary 返回下一个交易时段边界：时段内返回结束时间，时段外返回下一次开始时间，opening 表示该边界是否为开始
+func (c *Calendar) NextBoundary(t time.Time) (boundary time.Time, opening bool, ok bool) {
+	for _, w := range c.windows(t) {
+		if w.Contains(t) {
+			return w.End, false, true
+		}
+		if w.Start.After(t) {
+			return w.Start, true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// EventBlackout 判断时间是否处于重大事件前后的缓冲期
+func (c *Calendar) EventBlackout(t time.Time) (Event, bool) {
+	for _, e := range c.events {
+		if !t.Before(e.Time.Add(-c.bufferBefore)) && !t.After(e.Time.Add(c.bufferAfter)) {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// CanOpenPosition 判断当前是否允许开新仓，不允许时返回原因
+func (c *Calendar) CanOpenPosition(t time.Time) (bool, string) {
+	w, ok := c.CurrentWindow(t)
+	if !ok {
+		return false, "不在交易时段内"
+	}
+	if c.noNewBefore > 0 && w.End.Sub(t) < c.noNewBefore {
+		return false, fmt.Sprintf("距离交易时段结束(%s)不足%v", w.End.In(c.loc).Format("01-02 15:04"), c.noNewBefore)
+	}
+	if e, ok := c.EventBlackout(t); ok {
+		return false, fmt.Sprintf("处于事件%s(%s)前后的缓冲期", e.Name, e.Time.In(c.loc).Format("01-02 15:04"))
+	}
+	return true, ""
+}
+
+// windows 计算从前一天开始若干天内的交易时段，按开始时间排序并合并相邻或重叠的时段
+func (c *Calendar) windows(t time.Time) []Window {
+	local := t.In(c.loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.loc).AddDate(0, 0, -1)
+
+	var list []Window
+	for i := 0; i <= lookaheadDays; i++ {
+		d := day.AddDate(0, 0, i)
+		if c.holidays[d.Format("2006-01-02")] {
+			continue
+		}
+		for _, s := range c.sessions {
+			if !s.weekdays[d.Weekday()] {
+				continue
+			}
+			list = append(list, Window{
+				Start: clockTime(d, s.start),
+				End:   clockTime(d, s.end),
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+
+	var merged []Window
+	for _, w := range list {
+		if n := len(merged); n > 0 && !w.Start.After(merged[n-1].End) {
+			if w.End.After(merged[n-1].End) {
+				merged[n-1].End = w.End
+			}
+			continue
+		}
+		merged = append(merged, w)
+	}
+	return merged
+}
+
+// clockTime 返回某天零点起若干分钟的时间，按日历时区计算以正确处理夏令时
+func clockTime(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+// parseClock 解析 HH:MM 为分钟数，允许 24:00
+func parseClock(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("时间%s格式无效，应为HH:MM", s)
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("时间%s格式无效，应为HH:MM", s)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,91 @@
+package calendar_test
+
+import (
+	"testing"
+	"time"
+
+	"deeptrade/calendar"
+	"deeptrade/conf"
+)
+
+func newTestCalendar(t *testing.T) *calendar.Calendar {
+	c, err := calendar.New(conf.CalendarConf{
+		Timezone: "Asia/Shanghai",
+		Sessions: []conf.SessionConf{
+			{Weekdays: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "13:00"},
+			{Weekdays: []int{1, 2, 3, 4, 5}, Start: "18:00", End: "24:00"},
+			{Weekdays: []int{2, 3, 4, 5, 6}, Start: "00:00", End: "04:00"},
+		},
+		Holidays:             []string{"2026-10-21"},
+		EventBufferBeforeMin: 30,
+		EventBufferAfterMin:  15,
+		NoNewPositionMin:     30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestInSession(t *testing.T) {
+	c := newTestCalendar(t)
+	loc := c.Location()
+	cases := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"周一上午", time.Date(2026, 10, 19, 10, 0, 0, 0, loc), true},
+		{"周一午间", time.Date(2026, 10, 19, 14, 0, 0, 0, loc), false},
+		{"周二凌晨", time.Date(2026, 10, 20, 3, 59, 0, 0, loc), true},
+		{"周二凌晨结束", time.Date(2026, 10, 20, 4, 0, 0, 0, loc), false},
+		{"周日", time.Date(2026, 10, 18, 10, 0, 0, 0, loc), false},
+		{"休市日", time.Date(2026, 10, 21, 10, 0, 0, 0, loc), false},
+	}
+	for _, tc := range cases {
+		if got := c.InSession(tc.at); got != tc.want {
+			t.Errorf("%s: InSession=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNextBoundary(t *testing.T) {
+	c := newTestCalendar(t)
+	loc := c.Location()
+
+	// 周一晚间时段与周二凌晨时段相连，结束时间为周二4点
+	next, opening, ok := c.NextBoundary(time.Date(2026, 10, 19, 20, 0, 0, 0, loc))
+	if !ok || opening || !next.Equal(time.Date(2026, 10, 20, 4, 0, 0, 0, loc)) {
+		t.Errorf("NextBoundary=%v opening=%v ok=%v", next, opening, ok)
+	}
+
+	// 周日白天，下一次开始为周一9点
+	next, opening, ok = c.NextBoundary(time.Date(2026, 10, 18, 10, 0, 0, 0, loc))
+	if !ok || !opening || !next.Equal(time.Date(2026, 10, 19, 9, 0, 0, 0, loc)) {
+		t.Errorf("NextBoundary=%v opening=%v ok=%v", next, opening, ok)
+	}
+}
+
+func TestCanOpenPosition(t *testing.T) {
+	c := newTestCalendar(t)
+	loc := c.Location()
+	c.SetEvents([]calendar.Event{{Name: "CPI", Time: time.Date(2026, 10, 19, 10, 30, 0, 0, loc)}})
+
+	cases := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"正常开仓", time.Date(2026, 10, 19, 9, 30, 0, 0, loc), true},
+		{"事件前缓冲", time.Date(2026, 10, 19, 10, 10, 0, 0, loc), false},
+		{"事件后缓冲", time.Date(2026, 10, 19, 10, 40, 0, 0, loc), false},
+		{"事件缓冲结束", time.Date(2026, 10, 19, 10, 50, 0, 0, loc), true},
+		{"临近时段结束", time.Date(2026, 10, 19, 12, 40, 0, 0, loc), false},
+		{"时段外", time.Date(2026, 10, 19, 14, 0, 0, 0, loc), false},
+	}
+	for _, tc := range cases {
+		if got, reason := c.CanOpenPosition(tc.at); got != tc.want {
+			t.Errorf("%s: CanOpenPosition=%v(%s), want %v", tc.name, got, reason, tc.want)
+		}
+	}
+}
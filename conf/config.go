@@ -2,6 +2,8 @@ package conf
 
 import (
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/8treenet/freedom"
@@ -24,9 +26,28 @@ var cfg *Configuration
 
 // Configuration .
 type Configuration struct {
-	Binance BinanceConf `toml:"binance" yaml:"binance"`
-	LLM     []LLMConf   `toml:"llm" yaml:"llm"`
-	Trading TradingConf `toml:"trading" yaml:"trading"`
+	Binance    BinanceConf    `toml:"binance" yaml:"binance"`
+	LLM        []LLMConf      `toml:"llm" yaml:"llm"`
+	LLMPolicy  LLMPolicyConf  `toml:"llm_policy" yaml:"llm_policy"`
+	LLMCost    LLMCostConf    `toml:"llm_cost" yaml:"llm_cost"`
+	Trading    TradingConf    `toml:"trading" yaml:"trading"`
+	Margin     []MarginConf   `toml:"margin" yaml:"margin"`
+	Risk       RiskConf       `toml:"risk" yaml:"risk"`
+	Storage    StorageConf    `toml:"storage" yaml:"storage"`
+	KillSwitch KillSwitchConf `toml:"kill_switch" yaml:"kill_switch"`
+	Admin      AdminConf      `toml:"admin" yaml:"admin"`
+	Metrics    MetricsConf    `toml:"metrics" yaml:"metrics"`
+	Log        LogConf        `toml:"log" yaml:"log"`
+	Notify     NotifyConf     `toml:"notify" yaml:"notify"`
+	Calendar   CalendarConf   `toml:"calendar" yaml:"calendar"`
+	Trigger    TriggerConf    `toml:"trigger" yaml:"trigger"`
+	Ensemble   EnsembleConf   `toml:"ensemble" yaml:"ensemble"`
+	Agent      AgentConf      `toml:"agent" yaml:"agent"`
+	Memory     MemoryConf     `toml:"memory" yaml:"memory"`
+	Reflection ReflectionConf `toml:"reflection" yaml:"reflection"`
+	Shadow     ShadowConf     `toml:"shadow" yaml:"shadow"`
+	Pipeline   PipelineConf   `toml:"pipeline" yaml:"pipeline"`
+	Prompt     PromptConf     `toml:"prompt" yaml:"prompt"`
 }
 
 // GetBinanceEnvironment 获取当前环境的币安配置
@@ -40,24 +61,46 @@ func (cg *Configuration) GetBinanceEnvironment() BinanceEnvironment {
 	return cg.Binance.BinanceEnvironmentTest
 }
 
-// GetLLM 获取llm
+// GetLLM 获取llm，返回降级链中的第一个模型
 func (cg *Configuration) GetLLM(trackEnable ...bool) (result LLMConf) {
-	if len(trackEnable) > 0 && trackEnable[0] {
+	chain := cg.GetLLMChain(len(trackEnable) > 0 && trackEnable[0])
+	if len(chain) == 0 {
+		panic("LLM undefined")
+	}
+	return chain[0]
+}
+
+// GetLLMChain 获取角色对应的模型降级链，持仓角色未配置时使用开仓角色的模型
+func (cg *Configuration) GetLLMChain(trackEnable bool) (result []LLMConf) {
+	if trackEnable {
 		for _, v := range cg.LLM {
 			if v.TrackEnable {
-				result = v
-				return
+				result = append(result, v)
 			}
 		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].TrackPriority < result[j].TrackPriority })
+		if len(result) > 0 {
+			return
+		}
 	}
 
 	for _, v := range cg.LLM {
 		if v.EntryEnable {
-			result = v
-			return
+			result = append(result, v)
 		}
 	}
-	panic("LLM undefined")
+	sort.SliceStable(result, func(i, j int) bool { return result[i].EntryPriority < result[j].EntryPriority })
+	return
+}
+
+// GetMargin 获取交易对的保证金配置
+func (cg *Configuration) GetMargin(symbol string) (result MarginConf, ok bool) {
+	for _, v := range cg.Margin {
+		if v.Symbol == symbol {
+			return v, true
+		}
+	}
+	return
 }
 
 // DBConf .
@@ -114,6 +157,51 @@ type LLMConf struct {
 	EntryEnable bool   `toml:"entry_enable" yaml:"entry_enable"`
 	TrackEnable bool   `toml:"track_enable" yaml:"track_enable"`
 	Extra       string `toml:"extra" yaml:"extra"`
+	// 同一角色启用多个模型时按优先级从小到大依次降级，相同优先级按配置顺序
+	EntryPriority int `toml:"entry_priority" yaml:"entry_priority"`
+	TrackPriority int `toml:"track_priority" yaml:"track_priority"`
+	// 单次调用超时(秒)和最大重试次数，为0时使用 llm_policy 的默认值
+	TimeoutSec int `toml:"timeout_sec" yaml:"timeout_sec"`
+	MaxRetries int `toml:"max_retries" yaml:"max_retries"`
+	// 结构化输出方式: json_schema 使用 response_format，tool 使用强制工具调用，为空时从文本中解析
+	OutputMode string `toml:"output_mode" yaml:"output_mode"`
+	// 提示词(系统+用户消息)的token预算，为0时使用 prompt.token_budget
+	MaxPromptTokens int `toml:"max_prompt_tokens" yaml:"max_prompt_tokens"`
+	// 每百万token价格，用于费用统计
+	InputPrice  float64 `toml:"input_price" yaml:"input_price"`
+	OutputPrice float64 `toml:"output_price" yaml:"output_price"`
+}
+
+// Name 模型标识，用于日志和健康统计
+func (l LLMConf) Name() string {
+	return l.Model + "@" + l.BaseURL
+}
+
+// LLMPolicyConf LLM调用重试与降级策略
+type LLMPolicyConf struct {
+	// 默认单次调用超时(秒)
+	TimeoutSec int `toml:"timeout_sec" yaml:"timeout_sec"`
+	// 默认可重试错误(429/5xx/超时)的重试次数
+	MaxRetries int `toml:"max_retries" yaml:"max_retries"`
+	// 首次重试等待(毫秒)，之后按倍数递增
+	RetryDelayMs int     `toml:"retry_delay_ms" yaml:"retry_delay_ms"`
+	RetryBackoff float64 `toml:"retry_backoff" yaml:"retry_backoff"`
+	// 连续失败达到次数后暂时跳过该模型
+	FailThreshold int `toml:"fail_threshold" yaml:"fail_threshold"`
+	// 跳过时长(秒)
+	CooldownSec int `toml:"cooldown_sec" yaml:"cooldown_sec"`
+}
+
+// LLMCostConf LLM费用控制配置
+type LLMCostConf struct {
+	// 每日费用上限(与 llm.input_price/output_price 同币种)，0表示不限制
+	DailyCap float64 `toml:"daily_cap" yaml:"daily_cap"`
+	// 超出上限后的处理: fallback 改用便宜的模型, skip 跳过交易周期
+	CapAction string `toml:"cap_action" yaml:"cap_action"`
+	// fallback 使用的模型(对应 llm.model)，为空时使用降级链中价格最低的模型
+	FallbackModel string `toml:"fallback_model" yaml:"fallback_model"`
+	// 币种，仅用于展示
+	Currency string `toml:"currency" yaml:"currency"`
 }
 
 // TradingConf 交易相关配置
@@ -123,6 +211,300 @@ type TradingConf struct {
 	TriggerTime     int     `toml:"trigger_time" yaml:"trigger_time"`
 }
 
+// MarginConf 保证金模式配置（按交易对）
+type MarginConf struct {
+	Symbol string `toml:"symbol" yaml:"symbol"`
+	// 保证金模式: ISOLATED 逐仓, CROSS 全仓
+	MarginType string `toml:"margin_type" yaml:"margin_type"`
+	// 逐仓强平缓冲(%)，标记价与强平价的距离低于该比例时自动追加逐仓保证金
+	LiquidationBufferPct float64 `toml:"liquidation_buffer_pct" yaml:"liquidation_buffer_pct"`
+	// 追加后期望恢复到的强平距离(%)，为0时取缓冲的2倍
+	TargetBufferPct float64 `toml:"target_buffer_pct" yaml:"target_buffer_pct"`
+	// 单次最多追加的保证金(USDT)，为0时不限制
+	MaxAddMargin float64 `toml:"max_add_margin" yaml:"max_add_margin"`
+}
+
+// RiskConf 风控配置
+type RiskConf struct {
+	// 今日净亏损(USDT)达到该值后不再开仓或加仓，0表示不限制
+	MaxDailyLoss float64 `toml:"max_daily_loss" yaml:"max_daily_loss"`
+	// 连续亏损的完整交易笔数达到该值后不再开仓或加仓，0表示不限制
+	MaxConsecutiveLosses int                  `toml:"max_consecutive_losses" yaml:"max_consecutive_losses"`
+	Liquidation          LiquidationGuardConf `toml:"liquidation" yaml:"liquidation"`
+}
+
+// LiquidationGuardConf 强平距离与保证金率监控配置，按 告警 -> 减仓 -> 清仓 逐级升级
+type LiquidationGuardConf struct {
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 检查间隔(秒)，独立于LLM交易周期
+	IntervalSec int `toml:"interval_sec" yaml:"interval_sec"`
+	// 标记价与强平价距离(%)低于阈值时触发对应级别，0表示不启用该级别
+	AlertDistancePct   float64 `toml:"alert_distance_pct" yaml:"alert_distance_pct"`
+	ReduceDistancePct  float64 `toml:"reduce_distance_pct" yaml:"reduce_distance_pct"`
+	FlattenDistancePct float64 `toml:"flatten_distance_pct" yaml:"flatten_distance_pct"`
+	// 账户保证金率(%)=维持保证金/保证金余额，高于阈值时触发对应级别，0表示不启用该级别
+	AlertMarginRatio   float64 `toml:"alert_margin_ratio" yaml:"alert_margin_ratio"`
+	ReduceMarginRatio  float64 `toml:"reduce_margin_ratio" yaml:"reduce_margin_ratio"`
+	FlattenMarginRatio float64 `toml:"flatten_margin_ratio" yaml:"flatten_margin_ratio"`
+	// 减仓级别每次减仓的比例(%)
+	ReducePercent float64 `toml:"reduce_percent" yaml:"reduce_percent"`
+	// 同一方向持仓两次减仓的最小间隔(秒)，默认300
+	ReduceCooldownSec int `toml:"reduce_cooldown_sec" yaml:"reduce_cooldown_sec"`
+	// 同级别告警的最小间隔(秒)
+	AlertCooldownSec int `toml:"alert_cooldown_sec" yaml:"alert_cooldown_sec"`
+}
+
+// StorageConf 本地数据存储配置
+type StorageConf struct {
+	// 数据目录，保存运行状态等本地文件
+	DataDir string `toml:"data_dir" yaml:"data_dir"`
+}
+
+// Path 获取数据目录下的文件路径，并确保目录存在
+func (s StorageConf) Path(name string) string {
+	dir := s.DataDir
+	if dir == "" {
+		dir = "data"
+	}
+	os.MkdirAll(dir, 0755)
+	return filepath.Join(dir, name)
+}
+
+// KillSwitchConf 紧急停止配置
+type KillSwitchConf struct {
+	// 哨兵文件路径，文件出现时触发紧急停止
+	SentinelFile string `toml:"sentinel_file" yaml:"sentinel_file"`
+	// 哨兵文件检查间隔(秒)
+	PollSec int `toml:"poll_sec" yaml:"poll_sec"`
+}
+
+// LogConf 日志配置
+type LogConf struct {
+	// 日志级别: debug, info, warn, error，默认 info；debug 时输出完整提示词和模型输出
+	Level string `toml:"level" yaml:"level"`
+	// 输出格式: text 或 json
+	Format string `toml:"format" yaml:"format"`
+	// 日志文件，为空时输出到标准输出
+	File string `toml:"file" yaml:"file"`
+	// 单个日志文件的大小上限(MB)，超过后轮转，默认100
+	MaxSizeMB int `toml:"max_size_mb" yaml:"max_size_mb"`
+	// 保留的历史日志文件数，默认5
+	MaxBackups int `toml:"max_backups" yaml:"max_backups"`
+	// 写入日志文件的同时输出到标准输出
+	Stdout bool `toml:"stdout" yaml:"stdout"`
+}
+
+// MetricsConf Prometheus 监控指标配置
+type MetricsConf struct {
+	// 监听地址，例如 127.0.0.1:9090，为空时不启动
+	Listen string `toml:"listen" yaml:"listen"`
+	// 指标路径，默认 /metrics
+	Path string `toml:"path" yaml:"path"`
+}
+
+// AdminConf 管理接口配置
+type AdminConf struct {
+	// 监听地址，例如 127.0.0.1:8090，为空时不启动
+	Listen string `toml:"listen" yaml:"listen"`
+	// 访问令牌，请求头 Authorization: Bearer <token>
+	Token string `toml:"token" yaml:"token"`
+}
+
+// NotifyConf 通知配置，每个渠道按 events 订阅事件
+type NotifyConf struct {
+	// 相同通知的去重时间(分钟)，期间重复内容不再发送，0表示不去重
+	DedupWindowMin int `toml:"dedup_window_min" yaml:"dedup_window_min"`
+	// 每日汇总的发送时间 HH:MM，为空时不发送
+	DailySummaryTime string `toml:"daily_summary_time" yaml:"daily_summary_time"`
+	// 通知渠道
+	Channels []NotifyChannelConf `toml:"channels" yaml:"channels"`
+}
+
+// NotifyChannelConf 通知渠道配置
+type NotifyChannelConf struct {
+	// 渠道名称，用于日志
+	Name string `toml:"name" yaml:"name"`
+	// 渠道类型: smtp, webhook, telegram, slack, dingtalk, feishu, wecom
+	Type   string `toml:"type" yaml:"type"`
+	Enable bool   `toml:"enable" yaml:"enable"`
+	// 订阅的事件: open, close, stop_loss, error, breaker, daily_summary，为空时订阅全部
+	Events []string `toml:"events" yaml:"events"`
+	// 每小时最多发送条数，0表示不限制；breaker 事件不受限制
+	MaxPerHour int `toml:"max_per_hour" yaml:"max_per_hour"`
+	// smtp: 服务器、端口(465为SSL)、账号、发件人和收件人
+	Host     string   `toml:"host" yaml:"host"`
+	Port     int      `toml:"port" yaml:"port"`
+	Username string   `toml:"username" yaml:"username"`
+	Password string   `toml:"password" yaml:"password"`
+	From     string   `toml:"from" yaml:"from"`
+	To       []string `toml:"to" yaml:"to"`
+	// webhook/slack/dingtalk/feishu/wecom: 机器人地址；telegram: 接口地址，为空时使用 https://api.telegram.org
+	URL string `toml:"url" yaml:"url"`
+	// 签名密钥: dingtalk/feishu 的加签密钥，webhook 的 HMAC-SHA256 密钥(请求头 X-Signature)
+	Secret string `toml:"secret" yaml:"secret"`
+	// telegram: 机器人令牌和会话ID
+	BotToken string `toml:"bot_token" yaml:"bot_token"`
+	ChatID   string `toml:"chat_id" yaml:"chat_id"`
+}
+
+// CalendarConf 交易日历配置
+type CalendarConf struct {
+	// 时区，例如 Asia/Shanghai，为空时使用服务器本地时区
+	Timezone string `toml:"timezone" yaml:"timezone"`
+	// 每周交易时段
+	Sessions []SessionConf `toml:"sessions" yaml:"sessions"`
+	// 休市日期，格式 2006-01-02，当天所有时段不交易
+	Holidays []string `toml:"holidays" yaml:"holidays"`
+	// 重大事件(CPI、FOMC等)文件路径，JSON数组 [{"name":"CPI","time":"2026-11-12T20:30:00+08:00"}]
+	EventsFile string `toml:"events_file" yaml:"events_file"`
+	// 事件前后禁止开新仓的缓冲时间(分钟)
+	EventBufferBeforeMin int `toml:"event_buffer_before_min" yaml:"event_buffer_before_min"`
+	EventBufferAfterMin  int `toml:"event_buffer_after_min" yaml:"event_buffer_after_min"`
+	// 距离交易时段结束不足N分钟时不再开新仓，0表示不限制
+	NoNewPositionMin int `toml:"no_new_position_min" yaml:"no_new_position_min"`
+}
+
+// SessionConf 交易时段，weekdays 取值 0-6 (0为周日)，时间格式 HH:MM，结束时间可为 24:00
+type SessionConf struct {
+	Weekdays []int  `toml:"weekdays" yaml:"weekdays"`
+	Start    string `toml:"start" yaml:"start"`
+	End      string `toml:"end" yaml:"end"`
+}
+
+// TriggerConf 事件触发配置，满足条件时提前唤醒交易周期
+type TriggerConf struct {
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 检查间隔(秒)
+	IntervalSec int `toml:"interval_sec" yaml:"interval_sec"`
+	// 上次交易周期结束到事件触发下一周期的最小间隔(秒)
+	MinIntervalSec int `toml:"min_interval_sec" yaml:"min_interval_sec"`
+	// 同类事件的去抖时间(秒)，期间重复出现不再触发
+	DebounceSec int `toml:"debounce_sec" yaml:"debounce_sec"`
+	// 价格相对上次周期的变动超过N倍ATR时触发，0表示不启用
+	AtrMultiple float64 `toml:"atr_multiple" yaml:"atr_multiple"`
+	// 3分钟K线出现巨量时触发
+	VolumeSpike bool `toml:"volume_spike" yaml:"volume_spike"`
+	// 最近5分钟出现单笔成交额超过该值(USDT)的大单时触发，0表示不启用
+	WhaleNotional float64 `toml:"whale_notional" yaml:"whale_notional"`
+	// 资金费率正负翻转时触发
+	FundingFlip bool `toml:"funding_flip" yaml:"funding_flip"`
+	// 持仓收益率(未实现盈亏/初始保证金，%)高于止盈阈值或低于亏损阈值时触发，0表示不启用
+	PnlUpPct   float64 `toml:"pnl_up_pct" yaml:"pnl_up_pct"`
+	PnlDownPct float64 `toml:"pnl_down_pct" yaml:"pnl_down_pct"`
+}
+
+// EnsembleConf 多模型投票配置
+type EnsembleConf struct {
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 参与投票的模型名称(对应 llm.model)
+	Models []string `toml:"models" yaml:"models"`
+	// 只在无持仓(开仓决策)时投票，持仓时仍使用单模型
+	EntryOnly bool `toml:"entry_only" yaml:"entry_only"`
+	// 最少有效票数，不足时输出HOLD
+	MinVotes int `toml:"min_votes" yaml:"min_votes"`
+	// 多数方向的最低占比(0-1)，不足时视为分歧输出HOLD
+	MinAgreement float64 `toml:"min_agreement" yaml:"min_agreement"`
+	// 按置信度加权计票，否则一票一权
+	ConfidenceWeighted bool `toml:"confidence_weighted" yaml:"confidence_weighted"`
+}
+
+// MemoryConf 交易记忆配置
+type MemoryConf struct {
+	// 最多保留的记忆条数，超出时先删除最早更新的非保护记忆
+	MaxEntries int `toml:"max_entries" yaml:"max_entries"`
+	// 模型未指定有效期时的默认有效期(小时)，0表示不过期
+	DefaultTTLHours float64 `toml:"default_ttl_hours" yaml:"default_ttl_hours"`
+	// 持仓期间模型不能删除的记忆类型: thesis/level/invalidation/rationale/note
+	ProtectedTypes []string `toml:"protected_types" yaml:"protected_types"`
+}
+
+// ReflectionConf 平仓复盘配置
+type ReflectionConf struct {
+	// 平仓后由模型复盘并沉淀交易经验
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 复盘使用的模型(对应 llm.model)，为空时使用开仓决策的降级链
+	Model string `toml:"model" yaml:"model"`
+	// 开仓提示词中最多注入的经验条数
+	MaxLessons int `toml:"max_lessons" yaml:"max_lessons"`
+	// 经验相关度阈值(0-1)：市场环境相同得0.5分，交易形态相同得0.25分，其余市场特征按相似度最多得0.25分
+	MinScore float64 `toml:"min_score" yaml:"min_score"`
+}
+
+// ShadowConf 影子模式配置：挑战者与实盘模型收到相同的行情提示词，信号只记录不执行，
+// 之后用真实行情模拟各自的虚拟账户并与实盘对比
+type ShadowConf struct {
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 虚拟账户初始资金(USDT)
+	InitialEquity float64 `toml:"initial_equity" yaml:"initial_equity"`
+	// 手续费率，按名义金额单边计算，例如 0.0005 表示万五
+	FeeRate     float64                `toml:"fee_rate" yaml:"fee_rate"`
+	Challengers []ShadowChallengerConf `toml:"challengers" yaml:"challengers"`
+}
+
+// ShadowChallengerConf 影子模式的挑战者
+type ShadowChallengerConf struct {
+	// 名称，用于记录和报告
+	Name string `toml:"name" yaml:"name"`
+	// 模型(对应 llm.model)，为空时与实盘相同使用降级链
+	Model string `toml:"model" yaml:"model"`
+	// 提示词版本，为空时与实盘相同
+	PromptVersion string `toml:"prompt_version" yaml:"prompt_version"`
+}
+
+// AgentConf LLM工具调用配置
+type AgentConf struct {
+	// 允许模型在决策前调用工具按需获取数据
+	Enable bool `toml:"enable" yaml:"enable"`
+	// 单次决策最多调用工具次数
+	MaxToolCalls int `toml:"max_tool_calls" yaml:"max_tool_calls"`
+	// 工具调用循环超时(秒)，超时后要求模型直接给出结论
+	TimeoutSec int `toml:"timeout_sec" yaml:"timeout_sec"`
+	// 启用工具时提示词省略订单簿、资金费率等可按需查询的数据
+	CompactPrompt bool `toml:"compact_prompt" yaml:"compact_prompt"`
+}
+
+// PipelineConf 多角色决策流程配置，按顺序执行各阶段，最后一个阶段输出交易信号
+type PipelineConf struct {
+	Enable bool                `toml:"enable" yaml:"enable"`
+	Stages []PipelineStageConf `toml:"stages" yaml:"stages"`
+}
+
+// PipelineStageConf 决策流程中的一个角色
+type PipelineStageConf struct {
+	// 角色: analyst 市场分析师, risk 风控经理, decision 交易决策
+	Role string `toml:"role" yaml:"role"`
+	// 使用的模型(对应 llm.model)，为空时按持仓状态使用降级链
+	Model string `toml:"model" yaml:"model"`
+	// 系统提示词文件，为空时使用角色内置提示词
+	PromptFile string `toml:"prompt_file" yaml:"prompt_file"`
+	// 允许该角色调用数据查询工具(需启用 agent)
+	UseTools bool `toml:"use_tools" yaml:"use_tools"`
+}
+
+// PromptConf 提示词模板配置
+type PromptConf struct {
+	// 模板目录，每个子目录是一个版本，目录中的 *.tmpl 文件修改后自动重新加载
+	Dir string `toml:"dir" yaml:"dir"`
+	// 无持仓(开仓决策)时使用的版本
+	EntryVersion string `toml:"entry_version" yaml:"entry_version"`
+	// 持仓(跟踪管理)时使用的版本，为空时与 entry_version 相同
+	TrackVersion string `toml:"track_version" yaml:"track_version"`
+	// 默认的提示词token预算，为0时不限制
+	TokenBudget int `toml:"token_budget" yaml:"token_budget"`
+	// 可裁剪段落，按重要性从高到低排列；超出预算时从最后一个开始先替换为摘要(<段落>.summary)，仍超出再删除
+	SectionPriority []string `toml:"section_priority" yaml:"section_priority"`
+}
+
+// GetLLMByModel 按模型名称获取llm配置
+func (cg *Configuration) GetLLMByModel(model string) (result LLMConf, ok bool) {
+	for _, v := range cg.LLM {
+		if v.Model == model {
+			return v, true
+		}
+	}
+	return
+}
+
 func newConfig() *Configuration {
 	result := &Configuration{}
 	err := freedom.Configure(&result, "config.toml")
@@ -0,0 +1,8 @@
+package conf
+
+import "embed"
+
+// DefaultPrompts 内置的提示词模板，模板目录中没有对应版本时使用
+//
+//go:embed prompts
+var DefaultPrompts embed.FS
@@ -1,6 +1,7 @@
 package indicators
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	binance "deeptrade/binance"
+	"deeptrade/logger"
 )
 
 // VolumeAnalysisConfig 成交量分析配置
@@ -400,7 +402,7 @@ func detectGiantVolume(klines []binance.Kline, volumes, prices, buyVolumes []flo
 	// 检测条件
 	ratio := currentVol / avgVol
 	if ratio > config.GiantVolumeRatio || currentVol > maxVol*1.8 || rank > config.GiantVolumePercentile {
-		fmt.Printf("DEBUG: 巨量检测触发 - ratio=%.2f, currentVol=%.2f, avgVol=%.2f, maxVol=%.2f, rank=%.2f\n",
+		logger.Debugf(context.Background(), "[成交量分析] 巨量检测触发 - ratio=%.2f, currentVol=%.2f, avgVol=%.2f, maxVol=%.2f, rank=%.2f",
 			ratio, currentVol, avgVol, maxVol, rank)
 		// 计算价格变化
 		priceChange := 0.0
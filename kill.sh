@@ -0,0 +1,2 @@
+# 紧急停止：撤销全部挂单、平掉全部持仓并停止交易，恢复需调用管理接口 POST /rearm
+pkill -USR1 -f './main'
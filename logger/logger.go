@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"deeptrade/conf"
+)
+
+type cycleKey struct{}
+
+// tagPattern 日志消息开头的中文标签，例如 [交易执行]
+var tagPattern = regexp.MustCompile(`^\[([^\]\s]{1,20})\]\s*`)
+
+// Init 按 [log] 配置设置默认日志：级别、text/json 格式、输出文件轮转和敏感信息脱敏。
+// 标准库 log 的输出同样经过该处理器
+func Init() {
+	cfg := conf.Get().Log
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
+		w, err := NewRotatingWriter(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			log.Printf("[日志] 打开日志文件失败，输出到标准输出: %v", err)
+		} else if cfg.Stdout {
+			out = io.MultiWriter(os.Stdout, w)
+		} else {
+			out = w
+		}
+	}
+	slog.SetDefault(slog.New(NewHandler(out, cfg.Format, level, secretsFromConfig())))
+}
+
+// NewHandler 创建日志处理器，format 为 json 时输出JSON，否则为 key=value 文本
+func NewHandler(w io.Writer, format string, level slog.Leveler, secrets []string) slog.Handler {
+	r := newRedactor(secrets)
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if sensitiveKey(a.Key) {
+				return slog.String(a.Key, redacted)
+			}
+			if a.Value.Kind() == slog.KindString {
+				return slog.String(a.Key, r.redact(a.Value.String()))
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return &handler{Handler: h, redactor: r}
+}
+
+// handler 在日志中加入交易周期ID和消息标签，并对消息脱敏
+type handler struct {
+	slog.Handler
+	redactor *redactor
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	msg := strings.TrimRight(r.Message, "\n")
+	var attrs []slog.Attr
+	if m := tagPattern.FindStringSubmatch(msg); m != nil {
+		attrs = append(attrs, slog.String("tag", m[1]))
+		msg = msg[len(m[0]):]
+	}
+	if id := CycleID(ctx); id != "" {
+		attrs = append(attrs, slog.String("cycle", id))
+	}
+	nr := slog.NewRecord(r.Time, r.Level, h.redactor.redact(msg), r.PC)
+	nr.AddAttrs(attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(a)
+		return true
+	})
+	return h.Handler.Handle(ctx, nr)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{Handler: h.Handler.WithAttrs(attrs), redactor: h.redactor}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{Handler: h.Handler.WithGroup(name), redactor: h.redactor}
+}
+
+// NewCycleID 生成交易周期ID：时间加随机后缀
+func NewCycleID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().Format("0102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// WithCycle 在 ctx 中记录交易周期ID，之后使用该 ctx 的日志都会带上 cycle 字段
+func WithCycle(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, cycleKey{}, id)
+}
+
+// CycleID 取 ctx 中的交易周期ID，不在交易周期内时为空
+func CycleID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(cycleKey{}).(string)
+	return id
+}
+
+// Debugf 调试日志，如完整提示词和模型输出
+func Debugf(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelDebug, format, args...)
+}
+
+// Infof 一般运行日志
+func Infof(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelInfo, format, args...)
+}
+
+// Warnf 可以继续运行的异常，如降级、重试、跳过
+func Warnf(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelWarn, format, args...)
+}
+
+// Errorf 操作失败
+func Errorf(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelError, format, args...)
+}
+
+func logf(ctx context.Context, level slog.Level, format string, args ...any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l := slog.Default()
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // 跳过 Callers、logf 和 Infof 等
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, args...), pcs[0])
+	_ = l.Handler().Handle(ctx, r)
+}
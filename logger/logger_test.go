@@ -0,0 +1,85 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeptrade/logger"
+)
+
+func TestHandlerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(logger.NewHandler(&buf, "json", slog.LevelInfo, []string{"my-binance-secret-key", "short"}))
+	l.Info("[币安] 请求 /fapi/v1/order?symbol=ETHUSDT&signature=abcdef0123 key=my-binance-secret-key",
+		"api_key", "plain-value", "header", "Bearer eyJhbGciOi.payload", "model_key", "sk-abcdefghijklmnopqrstu",
+		"bot_token", "plain-bot-token", "prompt_tokens", 1234, "completion_tokens", 567)
+
+	out := buf.String()
+	for _, leak := range []string{"abcdef0123", "my-binance-secret-key", "plain-value", "eyJhbGciOi", "sk-abcdefghijklmnopqrstu", "plain-bot-token"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("日志中泄露了 %q: %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, "signature=***") {
+		t.Errorf("签名未脱敏: %s", out)
+	}
+	if !strings.Contains(out, `"prompt_tokens":1234`) || !strings.Contains(out, `"completion_tokens":567`) {
+		t.Errorf("token用量不应脱敏: %s", out)
+	}
+}
+
+func TestHandlerTagAndCycle(t *testing.T) {
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(logger.NewHandler(&buf, "json", slog.LevelInfo, nil)))
+	ctx := logger.WithCycle(context.Background(), "1018-120000-abcdef")
+	logger.Infof(ctx, "[交易执行] 下单成功: %s", "BUY")
+	logger.Debugf(ctx, "[交易执行] 调试信息不输出")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("应只输出一条日志: %q", lines)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "下单成功: BUY" || entry["tag"] != "交易执行" || entry["cycle"] != "1018-120000-abcdef" || entry["level"] != "INFO" {
+		t.Errorf("日志字段错误: %v", entry)
+	}
+	if logger.CycleID(context.Background()) != "" {
+		t.Error("周期外不应有周期ID")
+	}
+}
+
+func TestRotatingWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := logger.NewRotatingWriter(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	line := []byte(strings.Repeat("x", 400<<10) + "\n")
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("缺少日志文件 %s: %v", name, err)
+		}
+		if info.Size() > 1<<20 {
+			t.Errorf("%s 超过大小上限: %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("超出保留数量的日志文件应删除")
+	}
+}
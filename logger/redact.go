@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"deeptrade/conf"
+)
+
+const redacted = "***"
+
+// sensitiveKeys 字段名(小写，- 视为 _)为这些名称时整个值脱敏；按完整名称匹配，避免 prompt_tokens 等统计字段被误伤
+var sensitiveKeys = map[string]bool{
+	"api_key": true, "apikey": true, "x_mbx_apikey": true, "secret": true, "secret_key": true, "api_secret": true,
+	"signature": true, "password": true, "token": true, "access_token": true, "bot_token": true, "admin_token": true,
+	"authorization": true,
+}
+
+// secretPatterns 消息中常见的密钥格式：请求签名、API密钥请求头、Bearer 令牌、sk- 开头的模型密钥
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(signature=)[0-9a-f]+`),
+	regexp.MustCompile(`(?i)(x-mbx-apikey["']?\s*[:=]\s*["']?)[A-Za-z0-9]+`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._\-]+`),
+	regexp.MustCompile(`()sk-[A-Za-z0-9_\-]{16,}`),
+}
+
+// sensitiveKey 字段名是否表示密钥
+func sensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ReplaceAll(strings.ToLower(key), "-", "_")]
+}
+
+// redactor 替换配置中的密钥原文和常见的密钥格式
+type redactor struct {
+	secrets *strings.Replacer
+}
+
+func newRedactor(secrets []string) *redactor {
+	// 长的先替换，避免一个密钥是另一个的前缀时只替换一部分
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	var pairs []string
+	for _, s := range secrets {
+		// 过短的值可能是占位符，替换会误伤正常内容
+		if len(s) >= 8 {
+			pairs = append(pairs, s, redacted)
+		}
+	}
+	return &redactor{secrets: strings.NewReplacer(pairs...)}
+}
+
+func (r *redactor) redact(s string) string {
+	s = r.secrets.Replace(s)
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// secretsFromConfig 配置中的全部密钥
+func secretsFromConfig() []string {
+	cfg := conf.Get()
+	secrets := []string{
+		cfg.Binance.BinanceEnvironmentTest.APIKey, cfg.Binance.BinanceEnvironmentTest.SecretKey,
+		cfg.Binance.BinanceEnvironmentProduction.APIKey, cfg.Binance.BinanceEnvironmentProduction.SecretKey,
+		cfg.Admin.Token,
+	}
+	for _, lc := range cfg.LLM {
+		secrets = append(secrets, lc.APIKey)
+	}
+	for _, ch := range cfg.Notify.Channels {
+		// 机器人地址中包含访问令牌
+		secrets = append(secrets, ch.Password, ch.Secret, ch.BotToken, ch.URL)
+	}
+	return secrets
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingWriter 按大小轮转的日志文件：超过上限时 app.log 依次改名为 app.log.1、app.log.2…，超出保留数量的删除
+type RotatingWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingWriter 打开日志文件，maxSizeMB<=0 时默认100MB，maxBackups<=0 时默认保留5个
+func NewRotatingWriter(path string, maxSizeMB, maxBackups int) (*RotatingWriter, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	if maxBackups <= 0 {
+		maxBackups = 5
+	}
+	w := &RotatingWriter{path: path, maxSize: int64(maxSizeMB) << 20, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// Write 写入一条日志，写入后超过上限时轮转
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件并依次改名，调用方需持有 mu
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		// 改名失败时重新打开原文件继续追加，避免之后的日志都写入已关闭的文件，下次写入时再尝试轮转
+		fmt.Fprintf(os.Stderr, "日志文件轮转失败: %v\n", err)
+	}
+	return w.open()
+}
+
+// Close 关闭日志文件
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
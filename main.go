@@ -2,41 +2,193 @@
 package main
 
 import (
+	"context"
+	"deeptrade/admin"
+	"deeptrade/calendar"
 	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/metrics"
+	"deeptrade/notify"
 	"deeptrade/task"
 	tradeflow "deeptrade/task/trade_flow"
-	"deeptrade/utils"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
+	logger.Init()
+	if runCommand(os.Args[1:]) {
+		return
+	}
+	// 收到 SIGINT/SIGTERM 后取消 ctx，等待当前交易周期结束后退出；再次收到信号则立即退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	// 启动日志
-	log.Println("==========================================")
-	log.Printf("启动ETH期货量化交易系统, 当前环境: %s\n", conf.Get().Binance.CurrentEnvironment)
-	log.Printf("定时器: 每%d秒执行一次\n", conf.Get().Trading.TriggerTime*60)
-	log.Println("==========================================")
-	task.InitOffSystem()
-	log.Println("[系统] 分析和准备趋势数据-大约8-10分钟")
-	tradeflow.RunFetch(task.IsWork) //拉取数据
-	for {
+	logger.Infof(ctx, "==========================================")
+	logger.Infof(ctx, "启动ETH期货量化交易系统, 当前环境: %s", conf.Get().Binance.CurrentEnvironment)
+	logger.Infof(ctx, "定时器: 每%d秒执行一次", conf.Get().Trading.TriggerTime*60)
+	logger.Infof(ctx, "==========================================")
+	go func() {
+		<-ctx.Done()
+		logger.Warnf(ctx, "[系统] 收到退出信号，等待当前交易周期结束...")
+		stop()
+	}()
+
+	if err := calendar.Init(); err != nil {
+		logger.Errorf(ctx, "[系统] %v", err)
+		os.Exit(1)
+	}
+	task.InitKillSwitch()
+	task.InitOffSystem(ctx)
+	task.InitMarginType(ctx)
+	task.StartLiquidationGuard(ctx)
+	task.StartTriggerEngine(ctx)
+	task.StartDailySummary(ctx)
+	admin.Start(ctx)
+	metrics.Start(ctx)
+	logger.Infof(ctx, "[系统] 分析和准备趋势数据-大约8-10分钟")
+	tradeflow.RunFetch(ctx, task.IsWork) //拉取数据
+	for ctx.Err() == nil {
 		working := task.IsWork()
 		if !working {
-			time.Sleep(15 * time.Minute)
+			wait := 15 * time.Minute
+			if next, opening, ok := calendar.GetOnceCalendar().NextBoundary(time.Now()); ok && opening && time.Until(next) < wait {
+				wait = time.Until(next)
+			}
+			sleep(ctx, wait)
 			continue
 		}
-		log.Println("开始新的交易周期...")
+		logger.Infof(ctx, "开始新的交易周期...")
 
 		// 直接执行量化交易
-		if err := task.RunQuantitativeTrading(); err != nil {
-			log.Printf("量化交易执行失败: %v, 30秒后重试", err)
-			utils.SendHtmlMail("DeepTrade通知", fmt.Sprintf("错误信息 %v", err))
-			time.Sleep(30 * time.Second)
+		if err := task.RunQuantitativeTrading(ctx); err != nil {
+			logger.Errorf(ctx, "量化交易执行失败: %v, 30秒后重试", err)
+			notify.Notify(ctx, notify.Message{Event: notify.EventError, Title: "DeepTrade交易周期出错", Text: fmt.Sprintf("错误信息: %v", err)})
+			sleep(ctx, 30*time.Second)
 			continue
 		}
 
-		log.Printf("本轮交易周期结束，等待%d秒...\n", task.GetSleepSec())
-		time.Sleep(time.Duration(task.GetSleepSec()) * time.Second)
+		logger.Infof(ctx, "本轮交易周期结束，等待%d秒...", task.GetSleepSec())
+		task.WaitNextCycle(ctx, time.Duration(task.GetSleepSec())*time.Second)
+	}
+
+	task.Shutdown()
+	logger.Infof(ctx, "[系统] 已安全退出")
+}
+
+// sleep 等待指定时间，ctx 取消时提前返回
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// runCommand 执行命令行子命令，不是子命令时返回false并继续启动交易程序
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	var err error
+	switch args[0] {
+	case "analytics":
+		err = runAnalytics(args[1:])
+	case "report":
+		err = runReport(args[1:])
+	default:
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s 执行失败: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// newFlagSet 创建子命令参数，-c 由配置模块读取，这里只需声明
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.String("c", "", "配置环境")
+	return fs
+}
+
+// runAnalytics 输出交易绩效: deeptrade analytics [-days 30] [-json] [-c 环境]
+func runAnalytics(args []string) error {
+	fs := newFlagSet("analytics")
+	days := fs.Int("days", 30, "统计天数")
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	a, err := task.BuildAnalytics(ctx, *days)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a)
+	}
+	fmt.Println(a.Format())
+	return nil
+}
+
+// runReport 生成交易报告: deeptrade report [-from 2026-10-01] [-to 2026-10-08] [-days 7] [-format html|md] [-o 文件] [-mail]
+func runReport(args []string) error {
+	fs := newFlagSet("report")
+	from := fs.String("from", "", "开始日期(含)，格式 2006-01-02，默认为结束日期前 days 天")
+	to := fs.String("to", "", "结束日期(含)，格式 2006-01-02，默认为当前时间")
+	days := fs.Int("days", 7, "未指定开始日期时统计的天数")
+	format := fs.String("format", task.ReportHTML, "报告格式: html 或 md")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	mail := fs.Bool("mail", false, "以HTML邮件发送报告")
+	fs.Parse(args)
+
+	until := time.Now()
+	if *to != "" {
+		day, err := time.ParseInLocation("2006-01-02", *to, time.Local)
+		if err != nil {
+			return fmt.Errorf("结束日期格式错误: %v", err)
+		}
+		until = day.AddDate(0, 0, 1)
+	}
+	since := until.AddDate(0, 0, -*days)
+	if *from != "" {
+		day, err := time.ParseInLocation("2006-01-02", *from, time.Local)
+		if err != nil {
+			return fmt.Errorf("开始日期格式错误: %v", err)
+		}
+		since = day
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("开始日期需早于结束日期")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	report, err := task.BuildReport(ctx, since, until)
+	if err != nil {
+		return err
+	}
+	if *mail {
+		if err := task.MailReport(ctx, report); err != nil {
+			return fmt.Errorf("发送邮件失败: %v", err)
+		}
+	}
+	content, err := report.Render(*format)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(content), 0644)
+	}
+	if !*mail {
+		fmt.Print(content)
 	}
+	return nil
 }
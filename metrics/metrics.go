@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "deeptrade"
+
+var (
+	// CycleDuration 交易周期耗时
+	CycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cycle_duration_seconds",
+		Help:      "交易周期耗时",
+		Buckets:   []float64{1, 5, 10, 20, 30, 60, 120, 300, 600},
+	})
+
+	// BinanceRequestDuration 币安接口请求耗时，按接口路径
+	BinanceRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "binance_request_duration_seconds",
+		Help:      "币安接口请求耗时",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
+	}, []string{"endpoint"})
+
+	// BinanceErrors 币安接口错误次数，按错误代码
+	BinanceErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "binance_errors_total",
+		Help:      "币安接口错误次数",
+	}, []string{"endpoint", "code"})
+
+	// RateLimitWaits 请求因速率限制而等待的次数
+	RateLimitWaits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "binance_rate_limit_waits_total",
+		Help:      "请求因速率限制而等待的次数",
+	})
+
+	// LLMLatency 大模型调用耗时，按模型
+	LLMLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "大模型调用耗时",
+		Buckets:   []float64{1, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model"})
+
+	// LLMTokens 大模型消耗的token数，type 为 prompt/completion
+	LLMTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "大模型消耗的token数",
+	}, []string{"model", "type"})
+
+	// LLMCost 大模型调用费用，单位为 [llm_cost] 配置的币种
+	LLMCost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cost_total",
+		Help:      "大模型调用费用",
+	}, []string{"model"})
+
+	// SignalActions 交易信号次数，按动作
+	SignalActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signal_actions_total",
+		Help:      "交易信号次数",
+	}, []string{"action"})
+
+	// Orders 下单次数，按订单类型和结果：成功时为订单状态，失败时为错误代码
+	Orders = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_total",
+		Help:      "下单次数",
+	}, []string{"type", "outcome"})
+
+	// PositionNotional 持仓名义价值，按持仓方向
+	PositionNotional = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "position_notional_usdt",
+		Help:      "持仓名义价值",
+	}, []string{"side"})
+
+	// UnrealizedPnl 未实现盈亏
+	UnrealizedPnl = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unrealized_pnl_usdt",
+		Help:      "未实现盈亏",
+	})
+
+	// WalletBalance 钱包余额
+	WalletBalance = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "wallet_balance_usdt",
+		Help:      "钱包余额",
+	})
+
+	// TradeFlowCacheSize 成交流缓存中的成交笔数
+	TradeFlowCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "trade_flow_cache_size",
+		Help:      "成交流缓存中的成交笔数",
+	})
+)
+
+// Start 启动监控指标服务，监听地址为空时不启动，ctx 取消时关闭服务
+func Start(ctx context.Context) {
+	cfg := conf.Get().Metrics
+	if cfg.Listen == "" {
+		return
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/metrics"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.Handler())
+
+	srv := &http.Server{Addr: cfg.Listen, Handler: mux}
+	go func() {
+		logger.Infof(ctx, "[监控指标] 监听 %s%s", cfg.Listen, path)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf(ctx, "[监控指标] 服务异常退出: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf(ctx, "[监控指标] 关闭服务失败: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+)
+
+// Event 通知事件类型
+type Event string
+
+// 通知事件
+const (
+	EventOpen         Event = "open"          // 开仓、加仓
+	EventClose        Event = "close"         // 平仓、止盈触发
+	EventStopLoss     Event = "stop_loss"     // 止损触发
+	EventError        Event = "error"         // 交易周期出错
+	EventBreaker      Event = "breaker"       // 紧急停止、强平监控、费用上限等风控熔断
+	EventDailySummary Event = "daily_summary" // 每日汇总
+)
+
+// Events 全部通知事件
+var Events = []Event{EventOpen, EventClose, EventStopLoss, EventError, EventBreaker, EventDailySummary}
+
+// sendTimeout 后台发送一条通知的超时时间
+const sendTimeout = 30 * time.Second
+
+// Message 一条通知
+type Message struct {
+	Event Event
+	Title string
+	Text  string // 纯文本正文，聊天类渠道使用
+	HTML  string // HTML正文，邮件优先使用，为空时由 Text 转换
+	Key   string // 去重键，为空时按事件、标题和正文去重
+}
+
+// dedupKey 去重键
+func (m Message) dedupKey() string {
+	if m.Key != "" {
+		return string(m.Event) + "|" + m.Key
+	}
+	return string(m.Event) + "|" + m.Title + "|" + m.Text
+}
+
+// content 聊天类渠道的正文：标题加纯文本
+func (m Message) content() string {
+	if m.Text == "" {
+		return m.Title
+	}
+	return m.Title + "\n" + m.Text
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// New 按渠道配置创建通知渠道
+func New(cfg conf.NotifyChannelConf) (Notifier, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+	switch cfg.Type {
+	case "smtp":
+		if cfg.Host == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("通知渠道%s缺少 host 或 to", name)
+		}
+		return &SMTPNotifier{name: name, cfg: cfg}, nil
+	case "telegram":
+		if cfg.BotToken == "" || cfg.ChatID == "" {
+			return nil, fmt.Errorf("通知渠道%s缺少 bot_token 或 chat_id", name)
+		}
+		return &TelegramNotifier{name: name, cfg: cfg}, nil
+	case "webhook", "slack", "dingtalk", "feishu", "wecom":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("通知渠道%s缺少 url", name)
+		}
+		return &WebhookNotifier{name: name, kind: cfg.Type, url: cfg.URL, secret: cfg.Secret}, nil
+	}
+	return nil, fmt.Errorf("不支持的通知渠道类型: %s", cfg.Type)
+}
+
+// parseEvents 解析渠道订阅的事件，为空时订阅全部
+func parseEvents(names []string) ([]Event, error) {
+	if len(names) == 0 {
+		return Events, nil
+	}
+	var events []Event
+	for _, name := range names {
+		e := Event(strings.TrimSpace(name))
+		known := false
+		for _, k := range Events {
+			known = known || k == e
+		}
+		if !known {
+			return nil, fmt.Errorf("未知的通知事件: %s", name)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+var (
+	router      *Router
+	routerMutex sync.Mutex
+)
+
+// GetOnceRouter 按 [notify] 配置创建的路由，配置有误的渠道记录日志后跳过
+func GetOnceRouter() *Router {
+	routerMutex.Lock()
+	defer routerMutex.Unlock()
+	if router != nil {
+		return router
+	}
+	cfg := conf.Get().Notify
+	router = NewRouter(time.Duration(cfg.DedupWindowMin) * time.Minute)
+	for _, ch := range cfg.Channels {
+		if !ch.Enable {
+			continue
+		}
+		n, err := New(ch)
+		if err == nil {
+			var events []Event
+			if events, err = parseEvents(ch.Events); err == nil {
+				router.Add(n, events, ch.MaxPerHour)
+				continue
+			}
+		}
+		logger.Errorf(context.Background(), "[通知] 渠道配置错误: %v", err)
+	}
+	return router
+}
+
+// Notify 在后台发送通知，不阻塞交易流程，发送失败只记录日志
+func Notify(ctx context.Context, msg Message) {
+	r := GetOnceRouter()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+		defer cancel()
+		if err := r.Dispatch(ctx, msg); err != nil {
+			logger.Errorf(ctx, "[通知] 发送%s通知失败: %v", msg.Event, err)
+		}
+	}()
+}
+
+// SendMail 通过全部启用的邮件渠道发送HTML邮件，不经过事件路由，用于手动发送报告
+func SendMail(ctx context.Context, subject, html string) error {
+	var sent bool
+	for _, ch := range conf.Get().Notify.Channels {
+		if !ch.Enable || ch.Type != "smtp" {
+			continue
+		}
+		n, err := New(ch)
+		if err != nil {
+			return err
+		}
+		if err := n.Send(ctx, Message{Title: subject, HTML: html}); err != nil {
+			return fmt.Errorf("%s发送失败: %v", n.Name(), err)
+		}
+		sent = true
+	}
+	if !sent {
+		return fmt.Errorf("未配置启用的邮件通知渠道")
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/notify"
+)
+
+type fakeNotifier struct {
+	name string
+	sent []notify.Message
+	err  error
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Send(_ context.Context, msg notify.Message) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+func TestRouterRouting(t *testing.T) {
+	r := notify.NewRouter(0)
+	mail := &fakeNotifier{name: "mail"}
+	chat := &fakeNotifier{name: "chat", err: errors.New("网络错误")}
+	r.Add(mail, notify.Events, 0)
+	r.Add(chat, []notify.Event{notify.EventStopLoss}, 0)
+
+	if err := r.Dispatch(context.Background(), notify.Message{Event: notify.EventOpen, Title: "开仓"}); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Dispatch(context.Background(), notify.Message{Event: notify.EventStopLoss, Title: "止损"})
+	if err == nil || !strings.Contains(err.Error(), "chat") {
+		t.Errorf("应返回渠道错误: %v", err)
+	}
+	if len(mail.sent) != 2 || len(chat.sent) != 1 || chat.sent[0].Title != "止损" {
+		t.Errorf("路由错误: mail=%d chat=%d", len(mail.sent), len(chat.sent))
+	}
+}
+
+func TestRouterDedupAndRateLimit(t *testing.T) {
+	r := notify.NewRouter(time.Hour)
+	n := &fakeNotifier{name: "chat"}
+	r.Add(n, notify.Events, 2)
+	ctx := context.Background()
+
+	r.Dispatch(ctx, notify.Message{Event: notify.EventError, Title: "出错", Text: "超时"})
+	r.Dispatch(ctx, notify.Message{Event: notify.EventError, Title: "出错", Text: "超时"})
+	if len(n.sent) != 1 {
+		t.Fatalf("重复通知应去重: %d", len(n.sent))
+	}
+	r.Dispatch(ctx, notify.Message{Event: notify.EventError, Title: "出错", Text: "连接断开"})
+	r.Dispatch(ctx, notify.Message{Event: notify.EventOpen, Title: "开仓"})
+	if len(n.sent) != 2 {
+		t.Fatalf("超过每小时限制应忽略: %d", len(n.sent))
+	}
+	r.Dispatch(ctx, notify.Message{Event: notify.EventBreaker, Title: "紧急停止"})
+	if len(n.sent) != 3 {
+		t.Errorf("熔断通知不受限流影响: %d", len(n.sent))
+	}
+}
+
+func TestRouterDedupAfterFailure(t *testing.T) {
+	r := notify.NewRouter(time.Hour)
+	mail := &fakeNotifier{name: "mail"}
+	chat := &fakeNotifier{name: "chat", err: errors.New("网络错误")}
+	r.Add(mail, notify.Events, 0)
+	r.Add(chat, notify.Events, 0)
+	ctx := context.Background()
+	msg := notify.Message{Event: notify.EventStopLoss, Title: "止损", Key: "1001"}
+
+	if err := r.Dispatch(ctx, msg); err == nil {
+		t.Fatal("应返回渠道错误")
+	}
+	chat.err = nil
+	if err := r.Dispatch(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(mail.sent) != 1 || len(chat.sent) != 2 {
+		t.Errorf("发送失败的渠道应重试，已成功的渠道应去重: mail=%d chat=%d", len(mail.sent), len(chat.sent))
+	}
+	r.Dispatch(ctx, msg)
+	if len(chat.sent) != 2 {
+		t.Errorf("成功发送后应去重: %d", len(chat.sent))
+	}
+}
+
+// blockingNotifier 在 release 关闭前阻塞发送
+type blockingNotifier struct {
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingNotifier) Name() string { return "slow" }
+
+func (b *blockingNotifier) Send(_ context.Context, _ notify.Message) error {
+	if b.calls.Add(1) == 1 {
+		close(b.started)
+	}
+	<-b.release
+	return nil
+}
+
+func TestRouterDedupWhileSending(t *testing.T) {
+	r := notify.NewRouter(time.Hour)
+	n := &blockingNotifier{started: make(chan struct{}), release: make(chan struct{})}
+	r.Add(n, notify.Events, 0)
+	ctx := context.Background()
+	msg := notify.Message{Event: notify.EventError, Title: "出错", Text: "超时"}
+
+	done := make(chan error)
+	go func() { done <- r.Dispatch(ctx, msg) }()
+	<-n.started
+	// 第一条仍在发送中，相同通知应被去重
+	second := make(chan error)
+	go func() { second <- r.Dispatch(ctx, msg) }()
+	select {
+	case err := <-second:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("发送中的相同通知不应再次发送")
+	}
+	close(n.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if c := n.calls.Load(); c != 1 {
+		t.Errorf("相同通知应只发送一次: %d", c)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	cases := []conf.NotifyChannelConf{
+		{Type: "smtp", Host: "smtp.example.com"},
+		{Type: "telegram", BotToken: "token"},
+		{Type: "dingtalk"},
+		{Type: "sms", URL: "http://example.com"},
+	}
+	for _, c := range cases {
+		if _, err := notify.New(c); err == nil {
+			t.Errorf("配置 %+v 应报错", c)
+		}
+	}
+}
+
+func TestWebhookPayloads(t *testing.T) {
+	var got map[string]any
+	var query, signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = nil
+		json.Unmarshal(body, &got)
+		query, signature = r.URL.RawQuery, r.Header.Get("X-Signature")
+		switch {
+		case strings.Contains(r.URL.Path, "fail"):
+			w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+		case strings.Contains(r.URL.Path, "sendMessage"):
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+	msg := notify.Message{Event: notify.EventStopLoss, Title: "止损触发", Text: "触发价: 2500"}
+	ctx := context.Background()
+
+	send := func(cfg conf.NotifyChannelConf) error {
+		n, err := notify.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.Send(ctx, msg)
+	}
+
+	if err := send(conf.NotifyChannelConf{Type: "dingtalk", URL: srv.URL + "/robot?access_token=abc", Secret: "SECxyz"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["msgtype"] != "markdown" || !strings.Contains(query, "access_token=abc") || !strings.Contains(query, "sign=") {
+		t.Errorf("钉钉消息错误: %v %s", got, query)
+	}
+
+	if err := send(conf.NotifyChannelConf{Type: "feishu", URL: srv.URL + "/hook", Secret: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["msg_type"] != "text" || got["sign"] == nil {
+		t.Errorf("飞书消息错误: %v", got)
+	}
+
+	if err := send(conf.NotifyChannelConf{Type: "webhook", URL: srv.URL + "/hook", Secret: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["event"] != "stop_loss" || got["title"] != "止损触发" || len(signature) != 64 {
+		t.Errorf("webhook消息错误: %v %s", got, signature)
+	}
+
+	if err := send(conf.NotifyChannelConf{Type: "telegram", URL: srv.URL, BotToken: "123:abc", ChatID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["chat_id"] != "42" || !strings.Contains(got["text"].(string), "触发价") {
+		t.Errorf("Telegram消息错误: %v", got)
+	}
+
+	if err := send(conf.NotifyChannelConf{Type: "wecom", URL: srv.URL + "/fail"}); err == nil || !strings.Contains(err.Error(), "310000") {
+		t.Errorf("应返回机器人错误码: %v", err)
+	}
+}
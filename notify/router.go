@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"deeptrade/logger"
+)
+
+// route 一个渠道及其订阅的事件和发送限制
+type route struct {
+	notifier   Notifier
+	events     map[Event]bool
+	maxPerHour int
+	sent       []time.Time          // 最近一小时的发送时间
+	seen       map[string]time.Time // 去重键及最近发送（含发送中）的时间
+}
+
+// Router 按事件类型把通知分发到订阅的渠道，相同内容在去重时间内每个渠道只成功发送一次，各渠道按每小时条数限流
+type Router struct {
+	mu          sync.Mutex
+	routes      []*route
+	dedupWindow time.Duration
+}
+
+// NewRouter 创建路由，dedupWindow<=0 时不去重
+func NewRouter(dedupWindow time.Duration) *Router {
+	return &Router{dedupWindow: dedupWindow}
+}
+
+// Add 添加渠道，events 为订阅的事件，maxPerHour<=0 表示不限流
+func (r *Router) Add(n Notifier, events []Event, maxPerHour int) {
+	rt := &route{notifier: n, events: make(map[Event]bool), maxPerHour: maxPerHour, seen: make(map[string]time.Time)}
+	for _, e := range events {
+		rt.events[e] = true
+	}
+	r.mu.Lock()
+	r.routes = append(r.routes, rt)
+	r.mu.Unlock()
+}
+
+// Dispatch 发送通知到订阅该事件的渠道，返回各渠道的发送错误；发送失败的渠道撤销去重记录，下次相同通知仍会发送
+func (r *Router) Dispatch(ctx context.Context, msg Message) error {
+	now := time.Now()
+	key := msg.dedupKey()
+	targets := r.targets(ctx, msg, now)
+	var errs []error
+	for _, rt := range targets {
+		if err := rt.notifier.Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", rt.notifier.Name(), err))
+			if r.dedupWindow > 0 {
+				r.mu.Lock()
+				if t, ok := rt.seen[key]; ok && t.Equal(now) {
+					delete(rt.seen, key)
+				}
+				r.mu.Unlock()
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// targets 去重和限流后需要发送的渠道，记录本次发送次数并预占去重键，避免并发的相同通知重复发送
+func (r *Router) targets(ctx context.Context, msg Message, now time.Time) []*route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := msg.dedupKey()
+	var targets []*route
+	for _, rt := range r.routes {
+		if !rt.events[msg.Event] {
+			continue
+		}
+		if r.dedupWindow > 0 {
+			for k, t := range rt.seen {
+				if now.Sub(t) >= r.dedupWindow {
+					delete(rt.seen, k)
+				}
+			}
+			if _, ok := rt.seen[key]; ok {
+				logger.Debugf(ctx, "[通知] %s重复通知已忽略: %s", rt.notifier.Name(), msg.Title)
+				continue
+			}
+		}
+		recent := rt.sent[:0]
+		for _, t := range rt.sent {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		rt.sent = recent
+		// 熔断通知必须送达，不受限流影响
+		if rt.maxPerHour > 0 && len(rt.sent) >= rt.maxPerHour && msg.Event != EventBreaker {
+			logger.Warnf(ctx, "[通知] %s超过每小时%d条的限制，忽略通知: %s", rt.notifier.Name(), rt.maxPerHour, msg.Title)
+			continue
+		}
+		rt.sent = append(rt.sent, now)
+		if r.dedupWindow > 0 {
+			rt.seen[key] = now
+		}
+		targets = append(targets, rt)
+	}
+	return targets
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"gopkg.in/gomail.v2"
+
+	"deeptrade/conf"
+)
+
+// SMTPNotifier 邮件通知
+type SMTPNotifier struct {
+	name string
+	cfg  conf.NotifyChannelConf
+}
+
+// Name 渠道名称
+func (n *SMTPNotifier) Name() string {
+	return n.name
+}
+
+// Send 发送HTML邮件，消息没有HTML正文时转换纯文本
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	body := msg.HTML
+	if body == "" {
+		body = strings.ReplaceAll(html.EscapeString(msg.Text), "\n", "<br>")
+	}
+	from := n.cfg.From
+	if from == "" {
+		from = n.cfg.Username
+	}
+	port := n.cfg.Port
+	if port == 0 {
+		port = 465
+	}
+
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", from, "DeepTrade")
+	m.SetHeader("To", n.cfg.To...)
+	m.SetHeader("Subject", msg.Title)
+	m.SetBody("text/html", body)
+	return gomail.NewDialer(n.cfg.Host, port, n.cfg.Username, n.cfg.Password).DialAndSend(m)
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"deeptrade/conf"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// telegramMaxLen Telegram 单条消息的最大长度
+const telegramMaxLen = 4096
+
+// TelegramNotifier Telegram 机器人通知
+type TelegramNotifier struct {
+	name string
+	cfg  conf.NotifyChannelConf
+}
+
+// Name 渠道名称
+func (n *TelegramNotifier) Name() string {
+	return n.name
+}
+
+// Send 调用 sendMessage 发送纯文本消息
+func (n *TelegramNotifier) Send(ctx context.Context, msg Message) error {
+	base := n.cfg.URL
+	if base == "" {
+		base = telegramAPI
+	}
+	text := []rune(msg.content())
+	if len(text) > telegramMaxLen {
+		text = append(text[:telegramMaxLen-3], []rune("...")...)
+	}
+	data, err := json.Marshal(map[string]any{"chat_id": n.cfg.ChatID, "text": string(text)})
+	if err != nil {
+		return err
+	}
+	body, err := postJSON(ctx, strings.TrimRight(base, "/")+"/bot"+n.cfg.BotToken+"/sendMessage", data, nil)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("发送失败: %s", resp.Description)
+	}
+	return nil
+}
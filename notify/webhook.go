@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// WebhookNotifier 通用 webhook 和 Slack、钉钉、飞书、企业微信机器人
+type WebhookNotifier struct {
+	name   string
+	kind   string // webhook, slack, dingtalk, feishu, wecom
+	url    string
+	secret string
+}
+
+// Name 渠道名称
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+// Send 按机器人类型组装消息并发送
+func (n *WebhookNotifier) Send(ctx context.Context, msg Message) error {
+	target := n.url
+	headers := map[string]string{}
+	var payload any
+	switch n.kind {
+	case "slack":
+		payload = map[string]any{"text": "*" + msg.Title + "*\n" + msg.Text}
+	case "dingtalk":
+		payload = map[string]any{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": msg.Title, "text": "### " + msg.Title + "\n\n" + msg.Text},
+		}
+		if n.secret != "" {
+			// 加签: timestamp+"\n"+secret 以 secret 为密钥做 HMAC-SHA256
+			ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			target = appendQuery(target, url.Values{"timestamp": {ts}, "sign": {hmacBase64(n.secret, ts+"\n"+n.secret)}})
+		}
+	case "feishu":
+		body := map[string]any{"msg_type": "text", "content": map[string]string{"text": msg.content()}}
+		if n.secret != "" {
+			// 加签: 以 timestamp+"\n"+secret 为密钥对空串做 HMAC-SHA256
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			body["timestamp"] = ts
+			body["sign"] = hmacBase64(ts+"\n"+n.secret, "")
+		}
+		payload = body
+	case "wecom":
+		payload = map[string]any{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": "### " + msg.Title + "\n" + msg.Text},
+		}
+	default:
+		payload = map[string]any{"event": msg.Event, "title": msg.Title, "text": msg.Text, "time": time.Now().Format(time.RFC3339)}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if n.kind == "webhook" && n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(data)
+		headers["X-Signature"] = hex.EncodeToString(mac.Sum(nil))
+	}
+	resp, err := postJSON(ctx, target, data, headers)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(resp)
+}
+
+// postJSON 发送JSON请求，非2xx状态码返回错误
+func postJSON(ctx context.Context, target string, data []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+	return body, nil
+}
+
+// checkBotResponse 钉钉、企业微信返回 errcode，飞书返回 code，非0为失败；其他响应不检查
+func checkBotResponse(body []byte) error {
+	var r struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(body, &r) != nil {
+		return nil
+	}
+	if r.ErrCode != nil && *r.ErrCode != 0 {
+		return fmt.Errorf("错误码%d: %s", *r.ErrCode, r.ErrMsg)
+	}
+	if r.Code != nil && *r.Code != 0 {
+		return fmt.Errorf("错误码%d: %s", *r.Code, r.Msg)
+	}
+	return nil
+}
+
+func hmacBase64(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// appendQuery 在地址上追加查询参数
+func appendQuery(target string, values url.Values) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	for k, v := range values {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,171 @@
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// 段落在预算裁剪后的状态
+const (
+	SectionFull    = "full"    // 完整保留
+	SectionSummary = "summary" // 替换为摘要
+	SectionDropped = "dropped" // 删除
+)
+
+// SectionUsage 段落的token估算
+type SectionUsage struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+	Mode   string `json:"mode"`
+}
+
+// Built 按预算构建的提示词
+type Built struct {
+	Text     string
+	Tokens   int            // 整体估算token
+	Sections []SectionUsage // 各段落的估算token，按模板中出现的顺序
+}
+
+// EstimateTokens 粗略估算文本的token数：ASCII约3个字符一个token，其他字符(中文、符号)各算一个token
+func EstimateTokens(text string) int {
+	var ascii, other int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+2)/3 + other
+}
+
+// Build 渲染模板，估算的token超出 budget 时按 priority 从后往前先将段落替换为摘要，仍超出再删除段落；
+// budget 不大于0时不限制。模板中通过 {{section "名称" .}} 引用的段落才参与裁剪
+func (s *Set) Build(name string, data any, priority []string, budget int) (*Built, error) {
+	// 先完整渲染一次，记录各段落的内容
+	texts := map[string]string{}
+	var order []string
+	full, err := s.renderWithSections(name, data, func(t *template.Template, section string, d any) (string, error) {
+		text, err := execute(t, section, d)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := texts[section]; !ok {
+			order = append(order, section)
+		}
+		texts[section] = text
+		return text, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	built := &Built{Text: full, Tokens: EstimateTokens(full)}
+	usage := map[string]*SectionUsage{}
+	for _, section := range order {
+		usage[section] = &SectionUsage{Name: section, Tokens: EstimateTokens(texts[section]), Mode: SectionFull}
+	}
+
+	if budget > 0 && built.Tokens > budget {
+		total := built.Tokens
+		// 低优先级段落先替换为摘要
+		for i := len(priority) - 1; i >= 0 && total > budget; i-- {
+			u, ok := usage[priority[i]]
+			if !ok || !s.Has(priority[i]+".summary") {
+				continue
+			}
+			summary, err := execute(s.tmpl, priority[i]+".summary", data)
+			if err != nil {
+				return nil, err
+			}
+			tokens := EstimateTokens(summary)
+			if tokens >= u.Tokens {
+				continue
+			}
+			total += tokens - u.Tokens
+			texts[u.Name], u.Tokens, u.Mode = summary, tokens, SectionSummary
+		}
+		// 仍超出时删除低优先级段落
+		for i := len(priority) - 1; i >= 0 && total > budget; i-- {
+			u, ok := usage[priority[i]]
+			if !ok {
+				continue
+			}
+			total -= u.Tokens
+			texts[u.Name], u.Tokens, u.Mode = "", 0, SectionDropped
+		}
+
+		built.Text, err = s.renderWithSections(name, data, func(_ *template.Template, section string, _ any) (string, error) {
+			return texts[section], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		built.Tokens = EstimateTokens(built.Text)
+	}
+
+	for _, section := range order {
+		built.Sections = append(built.Sections, *usage[section])
+	}
+	return built, nil
+}
+
+// FormatUsage 格式化段落token估算，用于日志
+func (b *Built) FormatUsage() string {
+	parts := make([]string, 0, len(b.Sections))
+	for _, u := range b.Sections {
+		part := fmt.Sprintf("%s=%d", u.Name, u.Tokens)
+		if u.Mode != SectionFull {
+			part += "(" + u.Mode + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderWithSections 使用指定的段落渲染函数渲染模板
+func (s *Set) renderWithSections(name string, data any, section func(t *template.Template, section string, data any) (string, error)) (string, error) {
+	t, err := s.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{"section": func(name string, data any) (string, error) {
+		return section(t, name, data)
+	}})
+	text, err := execute(t, name, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染提示词%s/%s失败: %v", s.Version, name, err)
+	}
+	return text, nil
+}
+
+// execute 执行命名模板
+func execute(t *template.Template, name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs 模板中可用的函数，section 在 Build 时替换为按预算裁剪后的内容
+func templateFuncs(t **template.Template) template.FuncMap {
+	return template.FuncMap{
+		"section": func(name string, data any) (string, error) {
+			return execute(*t, name, data)
+		},
+		"head": head,
+	}
+}
+
+// head 取文本的前 n 行
+func head(n int, text string) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[:n], "\n") + "\n..."
+}
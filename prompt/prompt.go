@@ -0,0 +1,189 @@
+package prompt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+)
+
+// 模板名称
+const (
+	System  = "system"  // 交易决策系统提示词
+	User    = "user"    // 交易决策用户消息
+	Analyst = "analyst" // 市场分析师系统提示词
+	Risk    = "risk"    // 风控经理系统提示词
+	Reflect = "reflect" // 平仓复盘系统提示词
+)
+
+// defaultVersion 未配置版本时使用的版本
+const defaultVersion = "v1"
+
+// Set 一个版本的提示词模板
+type Set struct {
+	Version string // 版本，即模板目录名
+	Hash    string // 模板内容哈希，模板有任何改动都会变化
+	tmpl    *template.Template
+	sig     string // 文件名、大小和修改时间签名，用于判断是否需要重新加载
+}
+
+var (
+	mutex sync.Mutex
+	sets  = map[string]*Set{}
+)
+
+// ForRole 获取开仓或持仓跟踪使用的模板
+func ForRole(hasPosition bool) (*Set, error) {
+	cfg := conf.Get().Prompt
+	version := cfg.EntryVersion
+	if hasPosition && cfg.TrackVersion != "" {
+		version = cfg.TrackVersion
+	}
+	return Get(version)
+}
+
+// Get 获取配置目录下指定版本的模板
+func Get(version string) (*Set, error) {
+	return Load(conf.Get().Prompt.Dir, version)
+}
+
+// Load 加载 dir 下指定版本的模板，dir 中不存在该版本时使用内置模板；模板文件变化时自动重新加载
+func Load(dir, version string) (*Set, error) {
+	if version == "" {
+		version = defaultVersion
+	}
+	fsys, root := source(dir, version)
+	sig, err := signature(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	key := dir + "|" + version
+	mutex.Lock()
+	defer mutex.Unlock()
+	old, ok := sets[key]
+	if ok && old.sig == sig {
+		return old, nil
+	}
+
+	set, err := load(fsys, root, version)
+	if err != nil {
+		if ok {
+			// 热加载失败时继续使用上一次成功加载的模板
+			logger.Errorf(context.Background(), "[提示词] 重新加载版本%s失败，继续使用%s: %v", version, old.Hash, err)
+			return old, nil
+		}
+		return nil, err
+	}
+	set.sig = sig
+	if ok {
+		logger.Infof(context.Background(), "[提示词] 版本%s已重新加载: %s -> %s", version, old.Hash, set.Hash)
+	}
+	sets[key] = set
+	return set, nil
+}
+
+// Render 渲染命名模板，段落完整保留
+func (s *Set) Render(name string, data any) (string, error) {
+	text, err := execute(s.tmpl, name, data)
+	if err != nil {
+		return "", fmt.Errorf("渲染提示词%s/%s失败: %v", s.Version, name, err)
+	}
+	return text, nil
+}
+
+// Has 是否定义了命名模板
+func (s *Set) Has(name string) bool {
+	return s.tmpl.Lookup(name) != nil
+}
+
+// ID 版本和哈希，用于日志和决策记录
+func (s *Set) ID() string {
+	return s.Version + "@" + s.Hash
+}
+
+// source 确定模板来源：配置目录中存在该版本时读取磁盘，否则使用内置模板
+func source(dir, version string) (fs.FS, string) {
+	if dir != "" {
+		if info, err := os.Stat(filepath.Join(dir, version)); err == nil && info.IsDir() {
+			return os.DirFS(dir), version
+		}
+	}
+	return conf.DefaultPrompts, path.Join("prompts", version)
+}
+
+// templateFiles 列出目录下的模板文件
+func templateFiles(fsys fs.FS, root string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("读取提示词目录%s失败: %v", root, err)
+	}
+	var files []fs.DirEntry
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".tmpl") {
+			files = append(files, e)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("提示词目录%s中没有模板文件", root)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// signature 计算模板文件的签名
+func signature(fsys fs.FS, root string) (string, error) {
+	files, err := templateFiles(fsys, root)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(fmt.Sprintf("%s:%d:%d;", f.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	return b.String(), nil
+}
+
+// load 解析目录下所有模板文件并计算内容哈希
+func load(fsys fs.FS, root, version string) (*Set, error) {
+	files, err := templateFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := template.New(version).Option("missingkey=error")
+	tmpl.Funcs(templateFuncs(&tmpl))
+	hash := sha256.New()
+	for _, f := range files {
+		data, err := fs.ReadFile(fsys, path.Join(root, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		hash.Write([]byte(f.Name()))
+		hash.Write([]byte{0})
+		hash.Write(data)
+		if _, err := tmpl.New(f.Name()).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("解析提示词模板%s/%s失败: %v", version, f.Name(), err)
+		}
+	}
+	for _, name := range []string{System, User} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("提示词版本%s缺少模板%s", version, name)
+		}
+	}
+	return &Set{Version: version, Hash: hex.EncodeToString(hash.Sum(nil))[:12], tmpl: tmpl}, nil
+}
@@ -0,0 +1,149 @@
+package prompt_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"deeptrade/prompt"
+)
+
+func TestLoadDefault(t *testing.T) {
+	set, err := prompt.Load("", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{prompt.System, prompt.User, prompt.Analyst, prompt.Risk, prompt.Reflect} {
+		if !set.Has(name) {
+			t.Errorf("内置模板缺少 %s", name)
+		}
+	}
+
+	data := map[string]any{
+		"Time": "2026-10-18 10:00:00", "Price": 3000.5, "PriceChange": -1.2, "Position": "无持仓",
+		"WalletBalance": 1000.0, "AvailableBalance": 800.0, "MarginBalance": 1000.0,
+		"Technical": "RSI 50", "Volume": "平量", "TradeFlow": "买盘占优", "Memory": "k:v", "Lessons": "", "Trades": "",
+		"Funding": "费率0.01%", "BookTicker": "买一3000", "OrderBook": "买1: 3000",
+		"Tools": false, "Compact": false,
+	}
+	msg, err := set.Render(prompt.User, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[当前时间: 2026-10-18 10:00:00]", "价格: 3000.50 (-1.20%)", "## 技术指标\nRSI 50", "## 原始订单簿数据\n买1: 3000"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("用户消息缺少 %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "可用工具") || strings.Contains(msg, "历史交易经验") {
+		t.Error("未启用工具或没有经验时不应包含对应段落")
+	}
+
+	data["Tools"], data["Compact"], data["Lessons"] = true, true, "- 不追高"
+	msg, _ = set.Render(prompt.User, data)
+	if strings.Contains(msg, "买1: 3000") || !strings.Contains(msg, "get_order_book") || !strings.Contains(msg, "可用工具") || !strings.Contains(msg, "- 不追高") {
+		t.Errorf("精简模式渲染错误:\n%s", msg)
+	}
+}
+
+func TestHotReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "v2", "main.tmpl")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, mtime, mtime)
+	}
+
+	now := time.Now()
+	write(`{{define "system"}}A{{end}}{{define "user"}}{{.}}{{end}}`, now.Add(-time.Minute))
+	first, err := prompt.Load(dir, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := first.Render(prompt.System, nil); out != "A" {
+		t.Fatalf("渲染结果错误: %q", out)
+	}
+
+	write(`{{define "system"}}B{{end}}{{define "user"}}{{.}}{{end}}`, now)
+	second, err := prompt.Load(dir, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := second.Render(prompt.System, nil); out != "B" || second.Hash == first.Hash {
+		t.Fatalf("未重新加载: %q %s %s", out, first.Hash, second.Hash)
+	}
+
+	// 模板有误时继续使用上一次的模板
+	write(`{{define "system"}}{{end`, now.Add(time.Minute))
+	third, err := prompt.Load(dir, "v2")
+	if err != nil || third.Hash != second.Hash {
+		t.Fatalf("解析失败时应保留旧模板: %v", err)
+	}
+
+	if _, err := prompt.Load(dir, "missing"); err == nil {
+		t.Error("不存在的版本应返回错误")
+	}
+}
+
+func TestBuildBudget(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "b1"), 0755)
+	tmpl := `{{define "system"}}S{{end}}` +
+		`{{define "user"}}{{section "head" .}}|{{section "a" .}}|{{section "b" .}}|{{section "c" .}}{{end}}` +
+		`{{define "head"}}HEAD{{end}}` +
+		`{{define "a"}}{{.A}}{{end}}` +
+		`{{define "b"}}{{.B}}{{end}}` +
+		`{{define "b.summary"}}{{head 1 .B}}{{end}}` +
+		`{{define "c"}}{{.C}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "b1", "main.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := prompt.Load(dir, "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{
+		"A": strings.Repeat("甲", 100),
+		"B": "第一行\n" + strings.Repeat("乙", 100),
+		"C": strings.Repeat("丙", 100),
+	}
+	priority := []string{"a", "b", "c"}
+
+	full, err := set.Build(prompt.User, data, priority, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Sections) != 4 || full.Tokens < 300 {
+		t.Fatalf("不限预算时应完整保留: %+v", full.Sections)
+	}
+
+	// b先替换为摘要，仍超出时删除c
+	built, err := set.Build(prompt.User, data, priority, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := map[string]string{}
+	for _, u := range built.Sections {
+		modes[u.Name] = u.Mode
+	}
+	if modes["head"] != prompt.SectionFull || modes["a"] != prompt.SectionFull || modes["b"] != prompt.SectionSummary || modes["c"] != prompt.SectionDropped {
+		t.Errorf("裁剪结果错误: %s", built.FormatUsage())
+	}
+	if built.Tokens > 150 || !strings.HasPrefix(built.Text, "HEAD|") || strings.Contains(built.Text, "丙") {
+		t.Errorf("裁剪后的提示词错误(%d): %s", built.Tokens, built.Text)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if n := prompt.EstimateTokens("abcdef"); n != 2 {
+		t.Errorf("ASCII估算错误: %d", n)
+	}
+	if n := prompt.EstimateTokens("价格3000"); n != 4 {
+		t.Errorf("中英混合估算错误: %d", n)
+	}
+}
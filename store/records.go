@@ -0,0 +1,280 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/utils"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Decision 一次交易决策
+type Decision struct {
+	Time          time.Time       `json:"time"`
+	Mode          string          `json:"mode"`
+	Model         string          `json:"model"`
+	PromptVersion string          `json:"prompt_version"`
+	Action        string          `json:"action"`
+	Score         int             `json:"score"`
+	Confidence    float64         `json:"confidence"`
+	Reasoning     string          `json:"reasoning"`
+	Error         string          `json:"error,omitempty"`
+	Record        json.RawMessage `json:"record,omitempty"` // 完整的决策记录，含提示词和模型输出
+}
+
+// Order 订单
+type Order struct {
+	OrderID      int64     `json:"order_id"`
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	PositionSide string    `json:"position_side"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status"`
+	Price        float64   `json:"price"`
+	StopPrice    float64   `json:"stop_price"`
+	OrigQty      float64   `json:"orig_qty"`
+	ExecutedQty  float64   `json:"executed_qty"`
+	QuoteQty     float64   `json:"quote_qty"` // 累计成交金额
+	Time         time.Time `json:"time"`
+	UpdateTime   time.Time `json:"update_time"`
+}
+
+// Fill 成交
+type Fill struct {
+	TradeID         int64     `json:"trade_id"`
+	OrderID         int64     `json:"order_id"`
+	Symbol          string    `json:"symbol"`
+	Side            string    `json:"side"`
+	PositionSide    string    `json:"position_side"`
+	Price           float64   `json:"price"`
+	Qty             float64   `json:"qty"`
+	RealizedPnl     float64   `json:"realized_pnl"`
+	Commission      float64   `json:"commission"`
+	CommissionAsset string    `json:"commission_asset"`
+	Maker           bool      `json:"maker"`
+	Time            time.Time `json:"time"`
+}
+
+// FundingPayment 资金费用，正数为收入
+type FundingPayment struct {
+	TranID int64     `json:"tran_id"`
+	Symbol string    `json:"symbol"`
+	Amount float64   `json:"amount"`
+	Asset  string    `json:"asset"`
+	Time   time.Time `json:"time"`
+}
+
+// SLTPChange 一次止盈止损设置
+type SLTPChange struct {
+	Time         time.Time `json:"time"`
+	Symbol       string    `json:"symbol"`
+	PositionSide string    `json:"position_side"`
+	StopLoss     float64   `json:"stop_loss"`   // 为0表示未设置或挂单失败
+	TakeProfit   float64   `json:"take_profit"` // 为0表示未设置或挂单失败
+	Source       string    `json:"source"`      // 触发来源，如 OPEN_LONG、ADJUST_SL_TP
+}
+
+// RoundTrip 一笔已平仓的完整交易：从开仓到持仓归零，包含中途加仓和部分平仓
+type RoundTrip struct {
+	ID           int64     `json:"id"` // 开仓成交ID
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`          // LONG/SHORT
+	PositionSide string    `json:"position_side"` // 双向持仓时为 LONG/SHORT，单向持仓时为 BOTH
+	EntryTime    time.Time `json:"entry_time"`
+	ExitTime     time.Time `json:"exit_time"`
+	EntryPrice   float64   `json:"entry_price"` // 开仓成交均价(VWAP)
+	ExitPrice    float64   `json:"exit_price"`  // 平仓成交均价(VWAP)
+	Qty          float64   `json:"qty"`         // 累计开仓数量
+	Entries      int       `json:"entries"`     // 开仓和加仓的成交笔数
+	Exits        int       `json:"exits"`       // 部分平仓和最终平仓的成交笔数
+	RealizedPnl  float64   `json:"realized_pnl"`
+	Commission   float64   `json:"commission"`
+	Funding      float64   `json:"funding"`
+	NetPnl       float64   `json:"net_pnl"` // 已实现盈亏 - 手续费 + 资金费用
+	MAE          float64   `json:"mae"`     // 持仓期间最大不利偏移(%)，相对开仓均价
+	MFE          float64   `json:"mfe"`     // 持仓期间最大有利偏移(%)，相对开仓均价
+	Fills        []int64   `json:"fills"`   // 成交ID
+}
+
+// HoldTime 持仓时长
+func (r RoundTrip) HoldTime() time.Duration {
+	return r.ExitTime.Sub(r.EntryTime)
+}
+
+// OrderFromBinance 转换交易所订单
+func OrderFromBinance(o binance.Order) Order {
+	return Order{
+		OrderID: o.OrderID, Symbol: o.Symbol, Side: string(o.Side), PositionSide: o.PositionSide,
+		Type: string(o.Type), Status: string(o.Status),
+		Price:       utils.ParseFloatSafe(o.Price, 0),
+		StopPrice:   utils.ParseFloatSafe(o.StopPrice, 0),
+		OrigQty:     utils.ParseFloatSafe(o.OrigQty, 0),
+		ExecutedQty: utils.ParseFloatSafe(o.ExecutedQty, 0),
+		QuoteQty:    utils.ParseFloatSafe(o.CumulativeQuoteQty, 0),
+		Time:        time.UnixMilli(o.Time),
+		UpdateTime:  time.UnixMilli(o.UpdateTime),
+	}
+}
+
+// FillFromBinance 转换交易所成交
+func FillFromBinance(t binance.UserTrade) Fill {
+	return Fill{
+		TradeID: t.ID, OrderID: t.OrderID, Symbol: t.Symbol, Side: t.Side, PositionSide: t.PositionSide,
+		Price:           utils.ParseFloatSafe(t.Price, 0),
+		Qty:             utils.ParseFloatSafe(t.Qty, 0),
+		RealizedPnl:     utils.ParseFloatSafe(t.RealizedPnl, 0),
+		Commission:      utils.ParseFloatSafe(t.Commission, 0),
+		CommissionAsset: t.CommissionAsset,
+		Maker:           t.Maker,
+		Time:            time.UnixMilli(t.Time),
+	}
+}
+
+// UserTrade 转换回交易所成交格式，便于复用按成交统计的函数
+func (f Fill) UserTrade() binance.UserTrade {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return binance.UserTrade{
+		Symbol: f.Symbol, ID: f.TradeID, OrderID: f.OrderID, Side: f.Side, PositionSide: f.PositionSide,
+		Price: format(f.Price), Qty: format(f.Qty), RealizedPnl: format(f.RealizedPnl),
+		Commission: format(f.Commission), CommissionAsset: f.CommissionAsset,
+		Time: f.Time.UnixMilli(), Maker: f.Maker, Buyer: f.Side == string(binance.OrderSideBuy),
+	}
+}
+
+// FundingFromBinance 转换资金费用流水
+func FundingFromBinance(in binance.Income) FundingPayment {
+	return FundingPayment{TranID: in.TranID, Symbol: in.Symbol, Amount: utils.ParseFloatSafe(in.Income, 0), Asset: in.Asset, Time: time.UnixMilli(in.Time)}
+}
+
+// PutDecision 保存交易决策
+func (d *DB) PutDecision(dec Decision) error {
+	return put(d, bucketDecisions, []Decision{dec}, func(x Decision) []byte { return timeKey(x.Time, 0) })
+}
+
+// Decisions 查询时间范围内的交易决策
+func (d *DB) Decisions(since, until time.Time) ([]Decision, error) {
+	return scanRange[Decision](d, bucketDecisions, since, until)
+}
+
+// LastDecisions 最近 n 条交易决策
+func (d *DB) LastDecisions(n int) ([]Decision, error) {
+	return scanLast[Decision](d, bucketDecisions, n)
+}
+
+// PutOrders 保存订单，订单状态变化时覆盖
+func (d *DB) PutOrders(orders []Order) error {
+	return put(d, bucketOrders, orders, func(x Order) []byte { return idKey(x.OrderID) })
+}
+
+// Orders 查询创建时间在范围内的订单，按时间正序
+func (d *DB) Orders(since, until time.Time) ([]Order, error) {
+	var result []Order
+	if d == nil {
+		return result, nil
+	}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOrders).ForEach(func(_, v []byte) error {
+			var o Order
+			if json.Unmarshal(v, &o) == nil && !o.Time.Before(since) && (until.IsZero() || o.Time.Before(until)) {
+				result = append(result, o)
+			}
+			return nil
+		})
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, err
+}
+
+// PutFills 保存成交，重复的成交覆盖
+func (d *DB) PutFills(fills []Fill) error {
+	return put(d, bucketFills, fills, func(x Fill) []byte { return timeKey(x.Time, x.TradeID) })
+}
+
+// Fills 查询时间范围内的成交
+func (d *DB) Fills(since, until time.Time) ([]Fill, error) {
+	return scanRange[Fill](d, bucketFills, since, until)
+}
+
+// FillsByOrder 查询订单的成交，since 为订单创建时间
+func (d *DB) FillsByOrder(orderID int64, since time.Time) ([]Fill, error) {
+	fills, err := d.Fills(since, time.Time{})
+	var result []Fill
+	for _, f := range fills {
+		if f.OrderID == orderID {
+			result = append(result, f)
+		}
+	}
+	return result, err
+}
+
+// PutFunding 保存资金费用
+func (d *DB) PutFunding(items []FundingPayment) error {
+	return put(d, bucketFunding, items, func(x FundingPayment) []byte { return timeKey(x.Time, x.TranID) })
+}
+
+// Funding 查询时间范围内的资金费用
+func (d *DB) Funding(since, until time.Time) ([]FundingPayment, error) {
+	return scanRange[FundingPayment](d, bucketFunding, since, until)
+}
+
+// PutSLTPChange 保存止盈止损设置
+func (d *DB) PutSLTPChange(c SLTPChange) error {
+	return put(d, bucketSLTP, []SLTPChange{c}, func(x SLTPChange) []byte { return timeKey(x.Time, 0) })
+}
+
+// SLTPChanges 查询时间范围内的止盈止损设置
+func (d *DB) SLTPChanges(since, until time.Time) ([]SLTPChange, error) {
+	return scanRange[SLTPChange](d, bucketSLTP, since, until)
+}
+
+// PutRoundTrips 保存已平仓的完整交易
+func (d *DB) PutRoundTrips(items []RoundTrip) error {
+	return put(d, bucketRoundTrips, items, func(x RoundTrip) []byte { return timeKey(x.ExitTime, x.ID) })
+}
+
+// RoundTrips 查询平仓时间在范围内的完整交易
+func (d *DB) RoundTrips(since, until time.Time) ([]RoundTrip, error) {
+	return scanRange[RoundTrip](d, bucketRoundTrips, since, until)
+}
+
+// LastRoundTrips 最近 n 笔完整交易
+func (d *DB) LastRoundTrips(n int) ([]RoundTrip, error) {
+	return scanLast[RoundTrip](d, bucketRoundTrips, n)
+}
+
+// NetPnlSince 统计时间之后的净盈亏：成交已实现盈亏 - 手续费 + 资金费用
+func (d *DB) NetPnlSince(since time.Time) (float64, error) {
+	fills, err := d.Fills(since, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	funding, err := d.Funding(since, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, f := range fills {
+		total += f.RealizedPnl - f.Commission
+	}
+	for _, f := range funding {
+		total += f.Amount
+	}
+	return total, nil
+}
+
+// ConsecutiveLosses 最近连续亏损的完整交易笔数
+func (d *DB) ConsecutiveLosses() (int, error) {
+	trips, err := d.LastRoundTrips(50)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(trips) - 1; i >= 0 && trips[i].NetPnl < 0; i-- {
+		n++
+	}
+	return n, nil
+}
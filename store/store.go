@@ -0,0 +1,199 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const dbFile = "journal.db"
+
+// 数据桶
+var (
+	bucketDecisions  = []byte("decisions")   // 交易决策，键: 时间
+	bucketOrders     = []byte("orders")      // 订单，键: 订单ID
+	bucketFills      = []byte("fills")       // 成交，键: 时间+成交ID
+	bucketFunding    = []byte("funding")     // 资金费用，键: 时间+流水ID
+	bucketSLTP       = []byte("sltp")        // 止盈止损变更，键: 时间
+	bucketRoundTrips = []byte("round_trips") // 已平仓的完整交易，键: 平仓时间+开仓成交ID
+	bucketMeta       = []byte("meta")        // 同步进度等元数据
+
+	allBuckets = [][]byte{bucketDecisions, bucketOrders, bucketFills, bucketFunding, bucketSLTP, bucketRoundTrips, bucketMeta}
+)
+
+// DB 本地交易日志数据库，基于 bbolt，值为JSON；为nil时所有操作为空操作
+type DB struct {
+	bolt *bolt.DB
+}
+
+var (
+	dbOnce sync.Once
+	db     *DB
+)
+
+// GetOnceDB 打开数据目录下的交易日志数据库，打开失败时返回nil
+func GetOnceDB() *DB {
+	dbOnce.Do(func() {
+		d, err := Open(conf.Get().Storage.Path(dbFile))
+		if err != nil {
+			logger.Errorf(context.Background(), "[交易日志] 打开数据库失败: %v", err)
+			return
+		}
+		db = d
+	})
+	return db
+}
+
+// Open 打开数据库并创建数据桶
+func Open(path string) (*DB, error) {
+	b, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = b.Update(func(tx *bolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return &DB{bolt: b}, nil
+}
+
+// Close 关闭数据库
+func (d *DB) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.bolt.Close()
+}
+
+// timeKey 时间在前的键，按时间顺序遍历；id 用于区分同一时间的记录
+// Unix纪元之前的时间(包括零值)统一取0，避免负数转换后排在最后
+func timeKey(t time.Time, id int64) []byte {
+	key := make([]byte, 16)
+	var nano int64
+	if t.After(time.Unix(0, 0)) {
+		nano = t.UnixNano()
+	}
+	binary.BigEndian.PutUint64(key, uint64(nano))
+	binary.BigEndian.PutUint64(key[8:], uint64(id))
+	return key
+}
+
+// idKey 按ID排序的键
+func idKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// put 写入一批记录，键相同时覆盖
+func put[T any](d *DB, bucket []byte, items []T, key func(T) []byte) error {
+	if d == nil || len(items) == 0 {
+		return nil
+	}
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key(item), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanRange 按时间顺序读取 [since, until) 内的记录，until 为零值时不限制
+func scanRange[T any](d *DB, bucket []byte, since, until time.Time) ([]T, error) {
+	var result []T
+	if d == nil {
+		return result, nil
+	}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		var end []byte
+		if !until.IsZero() {
+			end = timeKey(until, 0)
+		}
+		for k, v := c.Seek(timeKey(since, 0)); k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			var item T
+			if err := json.Unmarshal(v, &item); err != nil {
+				continue
+			}
+			result = append(result, item)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// scanLast 倒序读取最后 n 条记录，返回结果按时间正序
+func scanLast[T any](d *DB, bucket []byte, n int) ([]T, error) {
+	var result []T
+	if d == nil || n <= 0 {
+		return result, nil
+	}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.Last(); k != nil && len(result) < n; k, v = c.Prev() {
+			var item T
+			if err := json.Unmarshal(v, &item); err != nil {
+				continue
+			}
+			result = append(result, item)
+		}
+		return nil
+	})
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, err
+}
+
+// Cursor 获取同步进度
+func (d *DB) Cursor(name string) time.Time {
+	var t time.Time
+	if d == nil {
+		return t
+	}
+	d.bolt.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketMeta).Get([]byte("cursor:" + name)); len(v) == 8 {
+			t = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+		}
+		return nil
+	})
+	return t
+}
+
+// SetCursor 保存同步进度
+func (d *DB) SetCursor(name string, t time.Time) error {
+	if d == nil {
+		return nil
+	}
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(t.UnixNano()))
+		return tx.Bucket(bucketMeta).Put([]byte("cursor:"+name), v)
+	})
+}
@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"deeptrade/store"
+)
+
+func TestJournalQueries(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "journal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	fills := []store.Fill{
+		{TradeID: 1, OrderID: 10, Side: "BUY", Price: 3000, Qty: 1, Commission: 1, Time: start},
+		{TradeID: 2, OrderID: 11, Side: "SELL", Price: 3010, Qty: 1, RealizedPnl: 10, Commission: 1, Time: start.Add(time.Hour)},
+		{TradeID: 2, OrderID: 11, Side: "SELL", Price: 3010, Qty: 1, RealizedPnl: 10, Commission: 1, Time: start.Add(time.Hour)}, // 重复同步
+	}
+	if err := db.PutFills(fills); err != nil {
+		t.Fatal(err)
+	}
+	db.PutFunding([]store.FundingPayment{{TranID: 5, Amount: -0.5, Time: start.Add(30 * time.Minute)}})
+
+	got, _ := db.Fills(start, time.Time{})
+	if len(got) != 2 {
+		t.Fatalf("重复成交应覆盖: %+v", got)
+	}
+	if got, _ := db.Fills(time.Time{}, time.Time{}); len(got) != 2 {
+		t.Errorf("起始时间为零值时应返回全部成交: %+v", got)
+	}
+	if got, _ := db.Fills(start.Add(time.Minute), start.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("时间范围应左闭右开: %+v", got)
+	}
+	if got, _ := db.FillsByOrder(11, start); len(got) != 1 || got[0].UserTrade().RealizedPnl != "10" {
+		t.Errorf("按订单查询错误: %+v", got)
+	}
+	if pnl, _ := db.NetPnlSince(start); pnl != 10-2-0.5 {
+		t.Errorf("净盈亏错误: %v", pnl)
+	}
+
+	db.PutRoundTrips([]store.RoundTrip{
+		{ID: 1, ExitTime: start, NetPnl: 5},
+		{ID: 3, ExitTime: start.Add(time.Hour), NetPnl: -1},
+		{ID: 5, ExitTime: start.Add(2 * time.Hour), NetPnl: -2},
+	})
+	if n, _ := db.ConsecutiveLosses(); n != 2 {
+		t.Errorf("连续亏损应为2: %d", n)
+	}
+	if last, _ := db.LastRoundTrips(2); len(last) != 2 || last[0].ID != 3 || last[1].ID != 5 {
+		t.Errorf("最近交易应按时间正序: %+v", last)
+	}
+
+	if !db.Cursor("fills").IsZero() {
+		t.Error("未同步时进度应为零值")
+	}
+	db.SetCursor("fills", start)
+	if !db.Cursor("fills").Equal(start) {
+		t.Error("同步进度读写不一致")
+	}
+
+	var empty *store.DB
+	if err := empty.PutFills(fills); err != nil {
+		t.Errorf("未打开数据库时应为空操作: %v", err)
+	}
+}
@@ -0,0 +1,413 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/indicators"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+var (
+	// toolKlineIntervals 工具支持的K线周期
+	toolKlineIntervals = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "12h", "1d", "1w"}
+	// toolDataPeriods 持仓量、多空比等统计数据支持的周期
+	toolDataPeriods = []string{"5m", "15m", "30m", "1h", "2h", "4h", "6h", "12h", "1d"}
+	// toolIndicators 可计算的指标
+	toolIndicators = []string{"RSI", "EMA", "SMA", "ATR", "MACD", "BOLL", "CCI", "WILLR", "ROC", "STOCH"}
+)
+
+// agentTool 由函数实现的工具
+type agentTool struct {
+	info *schema.ToolInfo
+	run  func(ctx context.Context, args toolArgs) (string, error)
+}
+
+// Info 工具定义
+func (t *agentTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun 解析参数并执行工具
+func (t *agentTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	args := toolArgs{}
+	if s := strings.TrimSpace(argumentsInJSON); s != "" {
+		if err := json.Unmarshal([]byte(s), &args); err != nil {
+			return "", fmt.Errorf("解析参数失败: %v", err)
+		}
+	}
+	return t.run(ctx, args)
+}
+
+// toolArgs 工具调用参数
+type toolArgs map[string]any
+
+// String 获取字符串参数
+func (a toolArgs) String(key, def string) string {
+	if v, ok := a[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Int 获取整数参数，限制在 [1, max] 范围内
+func (a toolArgs) Int(key string, def, max int) int {
+	n := def
+	switch v := a[key].(type) {
+	case float64:
+		n = int(v)
+	case string:
+		if i, err := strconv.Atoi(v); err == nil {
+			n = i
+		}
+	}
+	if n <= 0 {
+		n = def
+	}
+	if n > max {
+		n = max
+	}
+	return n
+}
+
+// newAgentToolLoop 根据配置创建工具调用循环，未启用时返回nil
+func newAgentToolLoop() *utils.ToolLoop {
+	cfg := conf.Get().Agent
+	if !cfg.Enable {
+		return nil
+	}
+	maxCalls := cfg.MaxToolCalls
+	if maxCalls <= 0 {
+		maxCalls = 6
+	}
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	return &utils.ToolLoop{Tools: AgentTools(), MaxCalls: maxCalls, Timeout: timeout}
+}
+
+// AgentTools 提供给模型按需查询数据的工具
+func AgentTools() []tool.InvokableTool {
+	symbol := binance.ETHUSDT_PERP
+	return []tool.InvokableTool{
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_klines",
+				Desc: "获取ETHUSDT永续合约任意周期的K线",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"interval": {Type: schema.String, Desc: "K线周期", Enum: toolKlineIntervals, Required: true},
+					"limit":    {Type: schema.Integer, Desc: "K线数量，最多200，默认50"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				interval := args.String("interval", "1h")
+				klines, err := binance.GetOnceFuturesClient().GetKlines(ctx, symbol, binance.KlineInterval(interval), args.Int("limit", 50, 200))
+				if err != nil {
+					return "", err
+				}
+				return FormatToolKlines(klines), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_order_book",
+				Desc: "获取订单簿深度",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"depth": {Type: schema.Integer, Desc: "档位数量，可选5/10/20/50/100，默认20"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				depth := binance.DepthLevel20
+				for _, level := range []binance.DepthLevel{binance.DepthLevel5, binance.DepthLevel10, binance.DepthLevel20, binance.DepthLevel50, binance.DepthLevel100} {
+					if args.Int("depth", 20, 100) <= int(level) {
+						depth = level
+						break
+					}
+				}
+				book, err := binance.GetOnceFuturesClient().GetDepth(ctx, symbol, depth)
+				if err != nil {
+					return "", err
+				}
+				return formatToolOrderBook(book), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_funding_history",
+				Desc: "获取历史资金费率",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"limit": {Type: schema.Integer, Desc: "记录数量，最多100，默认20"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				history, err := binance.GetOnceFuturesClient().GetFundingRateHistory(ctx, symbol, args.Int("limit", 20, 100), 0, 0)
+				if err != nil {
+					return "", err
+				}
+				return CSVData(history), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_open_interest_history",
+				Desc: "获取持仓量历史",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"period": {Type: schema.String, Desc: "统计周期", Enum: toolDataPeriods, Required: true},
+					"limit":  {Type: schema.Integer, Desc: "记录数量，最多100，默认30"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				history, err := binance.GetOnceFuturesClient().GetOpenInterestHistory(ctx, symbol, args.String("period", "1h"), args.Int("limit", 30, 100))
+				if err != nil {
+					return "", err
+				}
+				var b strings.Builder
+				b.WriteString("时间,持仓量(ETH),持仓价值(USDT)\n")
+				for _, h := range history {
+					b.WriteString(fmt.Sprintf("%s,%s,%s\n", formatToolTime(h.Timestamp), h.SumOpenInterest, h.SumOpenInterestValue))
+				}
+				return b.String(), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_long_short_ratio",
+				Desc: "获取大户多空比，position为持仓量多空比，account为账户数多空比",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"type":   {Type: schema.String, Desc: "多空比类型", Enum: []string{"position", "account"}, Required: true},
+					"period": {Type: schema.String, Desc: "统计周期", Enum: toolDataPeriods, Required: true},
+					"limit":  {Type: schema.Integer, Desc: "记录数量，最多100，默认30"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				client := binance.GetOnceFuturesClient()
+				period, limit := args.String("period", "1h"), args.Int("limit", 30, 100)
+				var b strings.Builder
+				b.WriteString("时间,多空比,多头占比,空头占比\n")
+				if args.String("type", "position") == "account" {
+					ratios, err := client.GetTopLongShortAccountRatio(ctx, symbol, period, limit)
+					if err != nil {
+						return "", err
+					}
+					for _, r := range ratios {
+						b.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", formatToolTime(r.Timestamp), r.LongShortRatio, r.LongAccount, r.ShortAccount))
+					}
+					return b.String(), nil
+				}
+				ratios, err := client.GetTopLongShortPositionRatio(ctx, symbol, period, limit)
+				if err != nil {
+					return "", err
+				}
+				for _, r := range ratios {
+					b.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", formatToolTime(r.Timestamp), r.LongShortRatio, r.LongAccount, r.ShortAccount))
+				}
+				return b.String(), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "get_trade_stats",
+				Desc: "获取本地交易日志中最近成交的交易统计：平仓次数、胜率、盈亏、手续费",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"days": {Type: schema.Integer, Desc: "统计最近几天，最多90，默认7"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				trades, err := journalTrades(time.Now().AddDate(0, 0, -args.Int("days", 7, 90)), time.Time{})
+				if err != nil {
+					return "", err
+				}
+				data, _ := json.Marshal(ComputeTradeStats(trades))
+				return string(data), nil
+			},
+		},
+		&agentTool{
+			info: &schema.ToolInfo{
+				Name: "compute_indicator",
+				Desc: "基于指定周期K线计算技术指标，返回最近5个值",
+				ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+					"name":     {Type: schema.String, Desc: "指标名称", Enum: toolIndicators, Required: true},
+					"interval": {Type: schema.String, Desc: "K线周期", Enum: toolKlineIntervals, Required: true},
+					"period":   {Type: schema.Integer, Desc: "指标周期，默认14，MACD固定12/26/9"},
+				}),
+			},
+			run: func(ctx context.Context, args toolArgs) (string, error) {
+				klines, err := binance.GetOnceFuturesClient().GetKlines(ctx, symbol, binance.KlineInterval(args.String("interval", "1h")), 300)
+				if err != nil {
+					return "", err
+				}
+				return ComputeIndicator(args.String("name", "RSI"), klines, args.Int("period", 14, 200))
+			},
+		},
+	}
+}
+
+// TradeStats 成交统计
+type TradeStats struct {
+	Trades       int     `json:"trades"`        // 成交笔数
+	Closes       int     `json:"closes"`        // 平仓成交笔数
+	Wins         int     `json:"wins"`          // 盈利笔数
+	Losses       int     `json:"losses"`        // 亏损笔数
+	WinRate      float64 `json:"win_rate"`      // 胜率(%)
+	RealizedPnl  float64 `json:"realized_pnl"`  // 已实现盈亏
+	Commission   float64 `json:"commission"`    // 手续费
+	NetPnl       float64 `json:"net_pnl"`       // 扣除手续费后的盈亏
+	AvgWin       float64 `json:"avg_win"`       // 平均盈利
+	AvgLoss      float64 `json:"avg_loss"`      // 平均亏损
+	ProfitFactor float64 `json:"profit_factor"` // 盈亏比(总盈利/总亏损)
+}
+
+// ComputeTradeStats 统计成交记录，已实现盈亏不为0的成交视为平仓
+func ComputeTradeStats(trades []binance.UserTrade) TradeStats {
+	var st TradeStats
+	var grossWin, grossLoss float64
+	for _, t := range trades {
+		st.Trades++
+		st.Commission += utils.ParseFloatSafe(t.Commission, 0)
+		pnl := utils.ParseFloatSafe(t.RealizedPnl, 0)
+		if pnl == 0 {
+			continue
+		}
+		st.Closes++
+		st.RealizedPnl += pnl
+		if pnl > 0 {
+			st.Wins++
+			grossWin += pnl
+		} else {
+			st.Losses++
+			grossLoss -= pnl
+		}
+	}
+	st.NetPnl = st.RealizedPnl - st.Commission
+	if st.Closes > 0 {
+		st.WinRate = float64(st.Wins) / float64(st.Closes) * 100
+	}
+	if st.Wins > 0 {
+		st.AvgWin = grossWin / float64(st.Wins)
+	}
+	if st.Losses > 0 {
+		st.AvgLoss = grossLoss / float64(st.Losses)
+	}
+	if grossLoss > 0 {
+		st.ProfitFactor = grossWin / grossLoss
+	}
+	return st
+}
+
+// ComputeIndicator 计算指标并返回最近5个值
+func ComputeIndicator(name string, klines []binance.Kline, period int) (string, error) {
+	highs, lows, closes := klineSeries(klines)
+	if period <= 0 {
+		period = 14
+	}
+	if len(closes) < period+1 {
+		return "", fmt.Errorf("K线数量%d不足以计算周期%d的指标", len(closes), period)
+	}
+
+	name = strings.ToUpper(name)
+	switch name {
+	case "RSI":
+		return formatIndicatorTail(name, indicators.RSI(closes, period)), nil
+	case "EMA":
+		return formatIndicatorTail(name, indicators.EMA(closes, period)), nil
+	case "SMA":
+		return formatIndicatorTail(name, indicators.SMA(closes, period)), nil
+	case "ATR":
+		return formatIndicatorTail(name, indicators.ATR(highs, lows, closes, period)), nil
+	case "CCI":
+		return formatIndicatorTail(name, indicators.CCI(highs, lows, closes, period)), nil
+	case "WILLR":
+		return formatIndicatorTail(name, indicators.WilliamsR(highs, lows, closes, period)), nil
+	case "ROC":
+		return formatIndicatorTail(name, indicators.ROC(closes, period)), nil
+	case "MACD":
+		r := indicators.MACD(closes, 12, 26, 9)
+		if r == nil {
+			return "", fmt.Errorf("K线数量不足以计算MACD")
+		}
+		return strings.Join([]string{
+			formatIndicatorTail("DIF", r.MACDLine),
+			formatIndicatorTail("DEA", r.SignalLine),
+			formatIndicatorTail("HIST", r.Histogram),
+		}, "\n"), nil
+	case "BOLL":
+		r := indicators.BollingerBands(closes, period, 2)
+		if r == nil {
+			return "", fmt.Errorf("K线数量不足以计算布林带")
+		}
+		return strings.Join([]string{
+			formatIndicatorTail("UPPER", r.UpperBand),
+			formatIndicatorTail("MID", r.MA),
+			formatIndicatorTail("LOWER", r.LowerBand),
+		}, "\n"), nil
+	case "STOCH":
+		r := indicators.Stochastic(highs, lows, closes, period, 3, 3)
+		if r == nil {
+			return "", fmt.Errorf("K线数量不足以计算随机指标")
+		}
+		return strings.Join([]string{
+			formatIndicatorTail("K", r.K),
+			formatIndicatorTail("D", r.D),
+		}, "\n"), nil
+	}
+	return "", fmt.Errorf("不支持的指标: %s，可选%v", name, toolIndicators)
+}
+
+// formatIndicatorTail 格式化指标序列的最近5个值，从旧到新
+func formatIndicatorTail(name string, values []float64) string {
+	if len(values) > 5 {
+		values = values[len(values)-5:]
+	}
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		parts = append(parts, strconv.FormatFloat(v, 'f', 4, 64))
+	}
+	return fmt.Sprintf("%s: %s", name, strings.Join(parts, ", "))
+}
+
+// FormatToolKlines 精简格式的K线，减少token消耗
+func FormatToolKlines(klines []binance.Kline) string {
+	var b strings.Builder
+	b.WriteString("开盘时间,开,高,低,收,成交量,主动买入量\n")
+	for _, k := range klines {
+		b.WriteString(fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s\n", formatToolTime(k.OpenTime), k.Open, k.High, k.Low, k.Close, k.Volume, k.TakerBuyBaseAssetVolume))
+	}
+	return b.String()
+}
+
+// formatToolOrderBook 格式化订单簿
+func formatToolOrderBook(book *binance.Depth) string {
+	var b strings.Builder
+	var bidVolume, askVolume float64
+	b.WriteString("买单(价格,数量)\n")
+	for _, e := range book.Bids {
+		bidVolume += utils.ParseFloatSafe(e.Quantity, 0)
+		b.WriteString(fmt.Sprintf("%s,%s\n", e.Price, e.Quantity))
+	}
+	b.WriteString("卖单(价格,数量)\n")
+	for _, e := range book.Asks {
+		askVolume += utils.ParseFloatSafe(e.Quantity, 0)
+		b.WriteString(fmt.Sprintf("%s,%s\n", e.Price, e.Quantity))
+	}
+	b.WriteString(fmt.Sprintf("买量合计: %.3f ETH, 卖量合计: %.3f ETH\n", bidVolume, askVolume))
+	return b.String()
+}
+
+// formatToolTime 格式化毫秒时间戳
+func formatToolTime(ms int64) string {
+	return time.UnixMilli(ms).Format("01-02 15:04")
+}
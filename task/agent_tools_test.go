@@ -0,0 +1,67 @@
+package task_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"deeptrade/binance"
+	"deeptrade/task"
+)
+
+func TestComputeTradeStats(t *testing.T) {
+	trades := []binance.UserTrade{
+		{RealizedPnl: "0", Commission: "0.5"},
+		{RealizedPnl: "30", Commission: "0.5"},
+		{RealizedPnl: "-10", Commission: "0.5"},
+		{RealizedPnl: "20", Commission: "0.5"},
+	}
+	st := task.ComputeTradeStats(trades)
+	if st.Trades != 4 || st.Closes != 3 || st.Wins != 2 || st.Losses != 1 {
+		t.Fatalf("统计笔数错误: %+v", st)
+	}
+	if st.RealizedPnl != 40 || st.NetPnl != 38 || st.AvgWin != 25 || st.AvgLoss != 10 || st.ProfitFactor != 5 {
+		t.Errorf("统计盈亏错误: %+v", st)
+	}
+}
+
+func TestComputeIndicator(t *testing.T) {
+	var klines []binance.Kline
+	for i := 0; i < 60; i++ {
+		price := 3000 + float64(i%10)*5
+		klines = append(klines, binance.Kline{
+			High:  fmt.Sprintf("%.2f", price+3),
+			Low:   fmt.Sprintf("%.2f", price-3),
+			Close: fmt.Sprintf("%.2f", price),
+		})
+	}
+	for _, name := range []string{"rsi", "EMA", "SMA", "ATR", "MACD", "BOLL", "CCI", "WILLR", "ROC", "STOCH"} {
+		out, err := task.ComputeIndicator(name, klines, 14)
+		if err != nil || out == "" {
+			t.Errorf("%s 计算失败: %v", name, err)
+		}
+	}
+	if _, err := task.ComputeIndicator("UNKNOWN", klines, 14); err == nil {
+		t.Error("未知指标应返回错误")
+	}
+	if _, err := task.ComputeIndicator("RSI", klines[:10], 14); err == nil {
+		t.Error("K线不足应返回错误")
+	}
+}
+
+func TestAgentToolsSchema(t *testing.T) {
+	names := map[string]bool{}
+	for _, tl := range task.AgentTools() {
+		info, err := tl.Info(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names[info.Name] {
+			t.Errorf("工具名称重复: %s", info.Name)
+		}
+		names[info.Name] = true
+		if _, err := info.ParamsOneOf.ToJSONSchema(); err != nil {
+			t.Errorf("%s 参数定义无效: %v", info.Name, err)
+		}
+	}
+}
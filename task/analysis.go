@@ -1,21 +1,21 @@
 package task
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"context"
 	"strconv"
-	"strings"
 	"time"
 
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/prompt"
 	"deeptrade/utils"
 
 	"github.com/cloudwego/eino/schema"
 )
 
 // AnalyzeWithLLM 使用LLM分析市场数据
-func AnalyzeWithLLM(marketData *MarketData) (*TradingSignal, error) {
-	log.Println("[LLM分析] 开始调用LLM分析...")
+func AnalyzeWithLLM(ctx context.Context, marketData *MarketData) (*TradingSignal, error) {
+	logger.Infof(ctx, "[LLM分析] 开始调用LLM分析...")
 
 	// 准备技术分析数据
 	technicalData := PrepareTechnicalData(marketData)
@@ -29,122 +29,163 @@ func AnalyzeWithLLM(marketData *MarketData) (*TradingSignal, error) {
 	bookTickerAnalysis := FormatBookTickerData(marketData)
 
 	positionAnalysis := FormatPositionWithSLTP(marketData.Positions, marketData.OpenOrders)
-
-	// 构建用户消息
-	currentPrice := marketData.Ticker.LastPrice
-	priceChange := marketData.Ticker.PriceChangePercent
+	toolLoop := newAgentToolLoop()
 
 	// 重新解析价格为浮点数，以便格式化（前面声明的可能基于不同的数据源）
 	var currentPriceFloat float64
-	if cp, err := strconv.ParseFloat(currentPrice, 64); err == nil {
+	if cp, err := strconv.ParseFloat(marketData.Ticker.LastPrice, 64); err == nil {
 		currentPriceFloat = cp
 	}
 
 	// 解析价格变化为浮点数，以便格式化
 	var priceChangeFloat float64
-	if pc, err := strconv.ParseFloat(priceChange, 64); err == nil {
+	if pc, err := strconv.ParseFloat(marketData.Ticker.PriceChangePercent, 64); err == nil {
 		priceChangeFloat = pc
 	}
 
-	// 添加当前时间信息
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	// 交易日志没有完整交易时，直接使用MarketData中已有的历史订单数据，避免重复API调用
+	trades := FormatJournalSummary(5)
+	if trades == "" {
+		if tradeRecords := GetTradeRecordsFromMarketData(ctx, marketData, 6); len(tradeRecords) > 0 {
+			trades = FormatTradeRecords(tradeRecords)
+			logger.Debugf(ctx, "最近订单记录: \n%v", trades)
+		}
+	}
+
+	hasPosition := marketData.PositionInfo.HasLong || marketData.PositionInfo.HasShort
+	prompts, err := prompt.ForRole(hasPosition)
+	if err != nil {
+		logger.Errorf(ctx, "[LLM分析] 加载提示词模板失败: %v", err)
+		return nil, err
+	}
 
-	// 直接使用MarketData中已有的历史订单数据，避免重复API调用
-	tradeRecords := GetTradeRecordsFromMarketData(marketData, 6)
-	tradeRecordsAnalysis := FormatTradeRecords(tradeRecords)
-	log.Printf("最近订单记录: \n%v\n", tradeRecordsAnalysis)
+	// 开仓时注入相似市场环境下的历史经验
+	var lessons string
+	if !hasPosition {
+		lessons = RelevantLessons(MarketTags(technicalData, marketData))
+	}
 
 	// 构建用户消息 - 专注于数据呈现和决策触发
-	userMsg := fmt.Sprintf(`[当前时间: %s]
-📊 完整市场数据
-## 基础信息
-价格: %.2f (%.2f%%) | 持仓: %s
-💰 账户余额详情:
-	 • 钱包余额: %.2f USDT
-	 • 可用余额: %.2f USDT (可用于开仓)
-	 • 保证金余额: %.2f USDT
-
-## 技术指标
-%s
-
-## 成交量趋势分析
-%s
-
-## 专业交易流分析
-%s
-
-## memory
-%s
-
-## 资金状况
-%s
-
-## 最优挂单信息
-%s
-
-## 原始订单簿数据
-%s
-`,
-		currentTime,
-		currentPriceFloat, priceChangeFloat, positionAnalysis,
-		balanceInfo.WalletBalance, balanceInfo.AvailableBalance,
-		balanceInfo.MarginBalance,
-		technicalAnalysis,
-		volumeAnalysis,
-		tradeFlowAnalysis,
-		GetMemory(),
-		fundingAnalysis,
-		bookTickerAnalysis,
-		FormatRawOrderBookData(marketData),
-	)
+	data := PromptData{
+		Time:             time.Now().Format("2006-01-02 15:04:05"),
+		Price:            currentPriceFloat,
+		PriceChange:      priceChangeFloat,
+		Position:         positionAnalysis,
+		WalletBalance:    balanceInfo.WalletBalance,
+		AvailableBalance: balanceInfo.AvailableBalance,
+		MarginBalance:    balanceInfo.MarginBalance,
+		Technical:        technicalAnalysis,
+		Volume:           volumeAnalysis,
+		TradeFlow:        tradeFlowAnalysis,
+		Memory:           GetMemory(ctx),
+		Lessons:          lessons,
+		Trades:           trades,
+		Funding:          fundingAnalysis,
+		BookTicker:       bookTickerAnalysis,
+		OrderBook:        FormatRawOrderBookData(marketData),
+		Tools:            toolLoop != nil,
+		// 启用工具调用时，可按需查询的数据不再放入提示词
+		Compact: toolLoop != nil && conf.Get().Agent.CompactPrompt,
+	}
+	system, err := prompts.Render(prompt.System, data)
+	if err != nil {
+		return nil, err
+	}
+	// 超出token预算时裁剪低优先级段落，系统提示词不参与裁剪
+	budget := promptTokenBudget(hasPosition)
+	systemTokens := prompt.EstimateTokens(system)
+	userBudget := 0
+	if budget > 0 {
+		userBudget = max(budget-systemTokens, 1)
+	}
+	built, err := prompts.Build(prompt.User, data, conf.Get().Prompt.SectionPriority, userBudget)
+	if err != nil {
+		return nil, err
+	}
+	userMsg := built.Text
 
 	// 创建消息
 	message := &schema.Message{
 		Role:    schema.User,
 		Content: userMsg,
 	}
-	log.Println("userMsg ", userMsg)
-	// 调用LLM
-	response, err := utils.Run(marketData.PositionInfo.HasLong || marketData.PositionInfo.HasShort, message)
-	if err != nil {
-		log.Printf("[LLM分析] LLM调用失败: %v", err)
-		return nil, err
+	logger.Infof(ctx, "[LLM分析] 提示词版本: %s, 预算: %d, 估算token: system=%d user=%d [%s]", prompts.ID(), budget, systemTokens, built.Tokens, built.FormatUsage())
+	logger.Debugf(ctx, "userMsg %s", userMsg)
+	var record *DecisionRecord
+	var signal *TradingSignal
+	switch {
+	case usePipeline():
+		// 多角色决策流程
+		record = newDecisionRecord(ctx, DecisionModePipeline, prompts, message)
+		signal, err = RunPipeline(ctx, prompts, system, message, marketData, record)
+	case useEnsemble(hasPosition):
+		// 多模型投票
+		record = newDecisionRecord(ctx, DecisionModeEnsemble, prompts, message)
+		signal, err = RunEnsemble(ctx, system, message, marketData)
+	default:
+		// 调用LLM并解析校验信号
+		record = newDecisionRecord(ctx, DecisionModeSingle, prompts, message)
+		signal, err = requestSignal(ctx, record.recordStage(RoleDecision, "", func(msgs []*schema.Message) (string, string, error) {
+			return utils.Generate(ctx, hasPosition, utils.Request{System: system, Messages: msgs, Output: signalOutput, Tools: toolLoop})
+		}), message, marketData)
 	}
-
-	// 解析JSON响应
-	log.Printf("[LLM分析] LLM原始响应: %s", response)
-	signal, err := ParseLLMResponse(response)
+	record.PromptSections = built.Sections
+	record.finish(ctx, signal, err)
+	// 影子模式：挑战者收到相同的行情数据，信号只记录不执行
+	runShadow(ctx, shadowInput{
+		cycle:       record.Time,
+		data:        data,
+		prompts:     prompts,
+		system:      system,
+		message:     message,
+		userBudget:  userBudget,
+		marketData:  marketData,
+		hasPosition: hasPosition,
+	}, signal, record, err)
 	if err != nil {
-		log.Printf("[LLM分析] 解析LLM响应失败: %v", err)
+		logger.Errorf(ctx, "[LLM分析] 获取交易信号失败: %v", err)
 		return nil, err
 	}
-	log.Printf("[LLM分析] %s (评分: %d, 置信度: %.2f%%)", signal.Action, signal.Score, signal.Confidence*100)
+	signal.decision = record
+	logger.Infof(ctx, "[LLM分析] %s (评分: %d, 置信度: %.2f%%)", signal.Action, signal.Score, signal.Confidence*100)
 	return signal, nil
 }
 
-// ParseLLMResponse 解析LLM响应（需要修改llm.go使用）
-func ParseLLMResponse(response string) (*TradingSignal, error) {
-	strings.ReplaceAll(response, "0.,", "0.0,")
-	var signal TradingSignal
-	lines := strings.Split(response, "\n")
-	var jsonStr string
-	inJson := false
-
-	for _, line := range lines {
-		if strings.Contains(line, "{") {
-			inJson = true
-		}
-		if inJson {
-			jsonStr += line + "\n"
+// promptTokenBudget 本轮提示词的token预算，取参与决策的模型中最小的预算，0表示不限制
+func promptTokenBudget(hasPosition bool) int {
+	cfg := conf.Get()
+	var models []conf.LLMConf
+	switch {
+	case usePipeline():
+		for _, stage := range pipelineStages() {
+			if lc, ok := cfg.GetLLMByModel(stage.Model); ok {
+				models = append(models, lc)
+			} else {
+				models = append(models, utils.LLMChain(hasPosition)...)
+			}
 		}
-		if strings.Contains(line, "}") {
-			break
+	case useEnsemble(hasPosition):
+		for _, name := range cfg.Ensemble.Models {
+			if lc, ok := cfg.GetLLMByModel(name); ok {
+				models = append(models, lc)
+			}
 		}
+	default:
+		models = utils.LLMChain(hasPosition)
 	}
 
-	if err := json.Unmarshal([]byte(jsonStr), &signal); err != nil {
-		return nil, fmt.Errorf("解析LLM响应失败 response: %v  err: %v", response, err)
+	budget := 0
+	for _, lc := range models {
+		b := lc.MaxPromptTokens
+		if b <= 0 {
+			b = cfg.Prompt.TokenBudget
+		}
+		if b > 0 && (budget == 0 || b < budget) {
+			budget = b
+		}
 	}
-
-	return &signal, nil
+	if budget == 0 {
+		budget = cfg.Prompt.TokenBudget
+	}
+	return budget
 }
@@ -0,0 +1,471 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/logger"
+	"deeptrade/store"
+	"deeptrade/utils"
+)
+
+const (
+	tradingDaysPerYear = 365              // 加密货币全年交易
+	entryMatchWindow   = 30 * time.Minute // 开仓成交与决策的最大时间间隔
+)
+
+// EquityPoint 权益曲线上的一个点
+type EquityPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// Breakdown 按维度分组的交易统计
+type Breakdown struct {
+	Key          string  `json:"key"`
+	Trades       int     `json:"trades"`
+	Wins         int     `json:"wins"`
+	WinRate      float64 `json:"win_rate"` // 胜率(%)
+	NetPnl       float64 `json:"net_pnl"`
+	Expectancy   float64 `json:"expectancy"`    // 每笔交易的期望盈亏
+	ProfitFactor float64 `json:"profit_factor"` // 总盈利/总亏损，没有亏损时为0
+}
+
+// Analytics 一段时间内的交易绩效
+type Analytics struct {
+	Since         time.Time     `json:"since"`
+	Until         time.Time     `json:"until"`
+	Source        string        `json:"source"` // 数据来源: journal 本地交易日志，api 交易所接口
+	StartEquity   float64       `json:"start_equity"`
+	EndEquity     float64       `json:"end_equity"`
+	NetPnl        float64       `json:"net_pnl"`
+	ReturnPct     float64       `json:"return_pct"`
+	Commission    float64       `json:"commission"`
+	Funding       float64       `json:"funding"`
+	Sharpe        float64       `json:"sharpe"`         // 年化夏普比率，按日收益计算
+	Sortino       float64       `json:"sortino"`        // 年化索提诺比率
+	Calmar        float64       `json:"calmar"`         // 年化收益率/最大回撤
+	MaxDrawdown   float64       `json:"max_drawdown"`   // 最大回撤(%)
+	DrawdownTime  string        `json:"drawdown_time"`  // 最长回撤持续时间
+	DrawdownHours float64       `json:"drawdown_hours"` // 最长回撤持续小时数
+	Trades        int           `json:"trades"`         // 完整交易笔数
+	WinRate       float64       `json:"win_rate"`       // 胜率(%)
+	AvgWin        float64       `json:"avg_win"`
+	AvgLoss       float64       `json:"avg_loss"`        // 平均亏损(正数)
+	PayoffRatio   float64       `json:"payoff_ratio"`    // 平均盈利/平均亏损
+	Expectancy    float64       `json:"expectancy"`      // 每笔交易的期望盈亏
+	ProfitFactor  float64       `json:"profit_factor"`   // 总盈利/总亏损
+	AvgHoldHours  float64       `json:"avg_hold_hours"`  // 平均持仓小时数
+	DailyReturns  []float64     `json:"daily_returns"`   // 每日收益率(%)
+	ByEntryAction []Breakdown   `json:"by_entry_action"` // 按开仓决策动作分组
+	ByExitAction  []Breakdown   `json:"by_exit_action"`  // 按平仓方式分组
+	ByModel       []Breakdown   `json:"by_model"`        // 按开仓决策模型分组
+	Equity        []EquityPoint `json:"equity"`
+}
+
+// AnalyticsInput 计算绩效所需的数据
+type AnalyticsInput struct {
+	Since, Until time.Time
+	StartEquity  float64
+	Fills        []store.Fill
+	Funding      []store.FundingPayment
+	Trips        []store.RoundTrip
+	Decisions    []store.Decision // 按时间正序
+}
+
+// ComputeAnalytics 根据成交、资金费用、完整交易和决策计算绩效指标
+func ComputeAnalytics(in AnalyticsInput) Analytics {
+	a := Analytics{Since: in.Since, Until: in.Until, StartEquity: in.StartEquity}
+	a.Equity = equityCurve(in)
+	a.EndEquity = a.Equity[len(a.Equity)-1].Equity
+	a.NetPnl = a.EndEquity - a.StartEquity
+	if a.StartEquity > 0 {
+		a.ReturnPct = a.NetPnl / a.StartEquity * 100
+	}
+	for _, f := range in.Fills {
+		a.Commission += f.Commission
+	}
+	for _, f := range in.Funding {
+		a.Funding += f.Amount
+	}
+
+	a.DailyReturns = dailyReturns(a.Equity, in.Since, in.Until)
+	a.Sharpe, a.Sortino = riskAdjusted(a.DailyReturns)
+	var span time.Duration
+	a.MaxDrawdown, span = maxDrawdown(a.Equity, in.Until)
+	a.DrawdownHours, a.DrawdownTime = span.Hours(), formatHoldTime(span)
+	if days := in.Until.Sub(in.Since).Hours() / 24; a.MaxDrawdown > 0 && days > 0 && a.StartEquity > 0 && a.EndEquity > 0 {
+		annual := math.Pow(a.EndEquity/a.StartEquity, tradingDaysPerYear/days) - 1
+		a.Calmar = annual * 100 / a.MaxDrawdown
+	}
+
+	overall := summarizeTrips("", in.Trips)
+	a.Trades, a.WinRate, a.Expectancy, a.ProfitFactor = overall.Trades, overall.WinRate, overall.Expectancy, overall.ProfitFactor
+	var grossWin, grossLoss, hold float64
+	for _, t := range in.Trips {
+		hold += t.HoldTime().Hours()
+		if t.NetPnl > 0 {
+			grossWin += t.NetPnl
+		} else {
+			grossLoss -= t.NetPnl
+		}
+	}
+	if overall.Wins > 0 {
+		a.AvgWin = grossWin / float64(overall.Wins)
+	}
+	if losses := overall.Trades - overall.Wins; losses > 0 {
+		a.AvgLoss = grossLoss / float64(losses)
+	}
+	if a.AvgLoss > 0 {
+		a.PayoffRatio = a.AvgWin / a.AvgLoss
+	}
+	if a.Trades > 0 {
+		a.AvgHoldHours = hold / float64(a.Trades)
+	}
+
+	entryAction, exitAction, model := map[string][]store.RoundTrip{}, map[string][]store.RoundTrip{}, map[string][]store.RoundTrip{}
+	for _, t := range in.Trips {
+		entry := entryDecision(t, in.Decisions)
+		action, m := "未知", "未知"
+		if entry != nil {
+			action, m = entry.Action, entry.Model
+		}
+		entryAction[action] = append(entryAction[action], t)
+		model[m] = append(model[m], t)
+		exit := exitReason(t, in.Decisions)
+		exitAction[exit] = append(exitAction[exit], t)
+	}
+	a.ByEntryAction, a.ByExitAction, a.ByModel = breakdowns(entryAction), breakdowns(exitAction), breakdowns(model)
+	return a
+}
+
+// equityCurve 以起始权益叠加成交盈亏、手续费和资金费用得到权益曲线
+func equityCurve(in AnalyticsInput) []EquityPoint {
+	type event struct {
+		t   time.Time
+		pnl float64
+	}
+	var events []event
+	for _, f := range in.Fills {
+		events = append(events, event{f.Time, f.RealizedPnl - f.Commission})
+	}
+	for _, f := range in.Funding {
+		events = append(events, event{f.Time, f.Amount})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].t.Before(events[j].t) })
+	equity := in.StartEquity
+	curve := []EquityPoint{{Time: in.Since, Equity: equity}}
+	for _, e := range events {
+		equity += e.pnl
+		curve = append(curve, EquityPoint{Time: e.t, Equity: equity})
+	}
+	return curve
+}
+
+// dailyReturns 按自然日计算收益率(%)，没有成交的日期收益为0
+func dailyReturns(curve []EquityPoint, since, until time.Time) []float64 {
+	var result []float64
+	prev, i := curve[0].Equity, 0
+	day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, since.Location())
+	for day.Before(until) {
+		next := day.AddDate(0, 0, 1)
+		equity := prev
+		for ; i < len(curve) && curve[i].Time.Before(next); i++ {
+			equity = curve[i].Equity
+		}
+		r := 0.0
+		if prev > 0 {
+			r = (equity - prev) / prev * 100
+		}
+		result = append(result, r)
+		prev, day = equity, next
+	}
+	return result
+}
+
+// riskAdjusted 计算年化夏普比率和索提诺比率，无风险利率按0计算
+func riskAdjusted(returns []float64) (sharpe, sortino float64) {
+	if len(returns) < 2 {
+		return 0, 0
+	}
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	down := math.Sqrt(downside / float64(len(returns)))
+	annual := math.Sqrt(tradingDaysPerYear)
+	if std > 0 {
+		sharpe = mean / std * annual
+	}
+	if down > 0 {
+		sortino = mean / down * annual
+	}
+	return sharpe, sortino
+}
+
+// maxDrawdown 最大回撤(%)和最长回撤持续时间(从高点到收复高点，未收复时计算到 until)
+func maxDrawdown(curve []EquityPoint, until time.Time) (float64, time.Duration) {
+	var maxDD float64
+	var longest time.Duration
+	peak, peakTime, underwater := curve[0].Equity, curve[0].Time, false
+	for _, p := range curve {
+		if p.Equity >= peak {
+			if underwater {
+				longest = max(longest, p.Time.Sub(peakTime))
+			}
+			peak, peakTime, underwater = p.Equity, p.Time, false
+			continue
+		}
+		underwater = true
+		if peak > 0 {
+			maxDD = math.Max(maxDD, (peak-p.Equity)/peak*100)
+		}
+	}
+	if underwater {
+		longest = max(longest, until.Sub(peakTime))
+	}
+	return maxDD, longest
+}
+
+// entryDecision 找到开仓前最近的开仓决策
+func entryDecision(t store.RoundTrip, decisions []store.Decision) *store.Decision {
+	want := "OPEN_" + t.Side
+	for i := len(decisions) - 1; i >= 0; i-- {
+		d := &decisions[i]
+		if d.Time.After(t.EntryTime) {
+			continue
+		}
+		if t.EntryTime.Sub(d.Time) > entryMatchWindow {
+			return nil
+		}
+		if d.Action == want || d.Action == "ADD_"+t.Side {
+			return d
+		}
+	}
+	return nil
+}
+
+// exitReason 平仓前最近的决策为平仓时视为主动平仓，否则为止盈止损等委托单触发
+func exitReason(t store.RoundTrip, decisions []store.Decision) string {
+	for i := len(decisions) - 1; i >= 0; i-- {
+		d := decisions[i]
+		if d.Time.After(t.ExitTime) {
+			continue
+		}
+		if t.ExitTime.Sub(d.Time) > entryMatchWindow || d.Time.Before(t.EntryTime) {
+			break
+		}
+		if d.Action == "CLOSE_"+t.Side {
+			return d.Action
+		}
+	}
+	return "止盈止损"
+}
+
+// summarizeTrips 统计一组完整交易
+func summarizeTrips(key string, trips []store.RoundTrip) Breakdown {
+	b := Breakdown{Key: key, Trades: len(trips)}
+	var grossWin, grossLoss float64
+	for _, t := range trips {
+		b.NetPnl += t.NetPnl
+		if t.NetPnl > 0 {
+			b.Wins++
+			grossWin += t.NetPnl
+		} else {
+			grossLoss -= t.NetPnl
+		}
+	}
+	if b.Trades > 0 {
+		b.WinRate = float64(b.Wins) / float64(b.Trades) * 100
+		b.Expectancy = b.NetPnl / float64(b.Trades)
+	}
+	if grossLoss > 0 {
+		b.ProfitFactor = grossWin / grossLoss
+	}
+	return b
+}
+
+// breakdowns 分组统计，按交易笔数倒序
+func breakdowns(groups map[string][]store.RoundTrip) []Breakdown {
+	result := make([]Breakdown, 0, len(groups))
+	for key, trips := range groups {
+		result = append(result, summarizeTrips(key, trips))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Trades != result[j].Trades {
+			return result[i].Trades > result[j].Trades
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// BuildAnalytics 统计最近 days 天的交易绩效
+func BuildAnalytics(ctx context.Context, days int) (Analytics, error) {
+	if days <= 0 {
+		days = 30
+	}
+	until := time.Now()
+	return BuildAnalyticsRange(ctx, until.AddDate(0, 0, -days), until)
+}
+
+// BuildAnalyticsRange 统计时间范围内的交易绩效
+func BuildAnalyticsRange(ctx context.Context, since, until time.Time) (Analytics, error) {
+	in, source, err := loadAnalyticsInput(ctx, since, until)
+	if err != nil {
+		return Analytics{}, err
+	}
+	a := ComputeAnalytics(in)
+	a.Source = source
+	return a, nil
+}
+
+// loadAnalyticsInput 加载时间范围内的成交、资金费用、完整交易和决策。优先使用本地交易日志，
+// 日志不可用时(如交易程序正在运行)从交易所接口拉取。起始权益按当前钱包余额倒推，不考虑期间的划转
+func loadAnalyticsInput(ctx context.Context, since, until time.Time) (AnalyticsInput, string, error) {
+	in := AnalyticsInput{Since: since, Until: until}
+	source := "journal"
+	if db := store.GetOnceDB(); db != nil {
+		var err error
+		if in.Fills, err = db.Fills(since, until); err != nil {
+			return in, source, err
+		}
+		if in.Funding, err = db.Funding(since, until); err != nil {
+			return in, source, err
+		}
+		if in.Trips, err = db.RoundTrips(since, until); err != nil {
+			return in, source, err
+		}
+		in.Decisions, _ = db.Decisions(since.Add(-entryMatchWindow), until)
+	} else {
+		source = "api"
+		if err := fetchAnalyticsInput(ctx, &in); err != nil {
+			return in, source, err
+		}
+	}
+
+	account, err := binance.GetOnceFuturesClient().GetAccountInfo(ctx)
+	if err != nil {
+		return in, source, fmt.Errorf("获取账户信息失败: %v", err)
+	}
+	in.StartEquity = utils.ParseFloatSafe(account.TotalWalletBalance, 0)
+	// 当前余额减去 since 之后的全部盈亏，截止时间早于当前时还要减去之后的盈亏
+	if time.Since(until) > time.Minute {
+		after, err := pnlAfter(ctx, until, source == "journal")
+		if err != nil {
+			return in, source, err
+		}
+		in.StartEquity -= after
+	}
+	for _, f := range in.Fills {
+		in.StartEquity -= f.RealizedPnl - f.Commission
+	}
+	for _, f := range in.Funding {
+		in.StartEquity -= f.Amount
+	}
+	return in, source, nil
+}
+
+// pnlAfter 统计时间之后的已实现盈亏、手续费和资金费用合计
+func pnlAfter(ctx context.Context, t time.Time, journal bool) (float64, error) {
+	if journal {
+		return store.GetOnceDB().NetPnlSince(t)
+	}
+	var total float64
+	for start := t; ; {
+		incomes, err := binance.GetOnceFuturesClient().GetIncomeHistory(ctx, string(binance.ETHUSDT), "", journalPageLimit, start.UnixMilli(), 0)
+		if err != nil {
+			return 0, fmt.Errorf("获取收入历史失败: %v", err)
+		}
+		for _, in := range incomes {
+			switch in.IncomeType {
+			case binance.IncomeTypeRealizedPnl, binance.IncomeTypeCommission, binance.IncomeTypeFundingFee:
+				total += utils.ParseFloatSafe(in.Income, 0)
+			}
+		}
+		if len(incomes) < journalPageLimit {
+			return total, nil
+		}
+		start = time.UnixMilli(incomes[len(incomes)-1].Time + 1)
+	}
+}
+
+// fetchAnalyticsInput 从交易所接口获取成交和资金费用，并从决策日志读取决策
+func fetchAnalyticsInput(ctx context.Context, in *AnalyticsInput) error {
+	client := binance.GetOnceFuturesClient()
+	for start := in.Since; start.Before(in.Until); {
+		end := start.Add(journalSyncWindow)
+		if end.After(in.Until) {
+			end = in.Until
+		}
+		trades, err := client.GetUserTrades(ctx, binance.ETHUSDT, journalPageLimit, 0, start.UnixMilli(), end.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("获取成交记录失败: %v", err)
+		}
+		for _, t := range trades {
+			in.Fills = append(in.Fills, store.FillFromBinance(t))
+		}
+		if len(trades) >= journalPageLimit {
+			start = in.Fills[len(in.Fills)-1].Time.Add(time.Millisecond)
+		} else {
+			start = end
+		}
+	}
+	for start := in.Since; ; {
+		incomes, err := client.GetIncomeHistory(ctx, string(binance.ETHUSDT), binance.IncomeTypeFundingFee, journalPageLimit, start.UnixMilli(), in.Until.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("获取资金费用失败: %v", err)
+		}
+		for _, income := range incomes {
+			in.Funding = append(in.Funding, store.FundingFromBinance(income))
+		}
+		if len(incomes) < journalPageLimit {
+			break
+		}
+		start = in.Funding[len(in.Funding)-1].Time.Add(time.Millisecond)
+	}
+	in.Trips, _ = BuildRoundTrips(in.Fills, in.Funding)
+	decisions, err := LoadDecisions(in.Since.Add(-entryMatchWindow), in.Until)
+	if err != nil {
+		logger.Errorf(ctx, "[绩效分析] 读取决策日志失败: %v", err)
+	}
+	in.Decisions = decisions
+	return nil
+}
+
+// Format 格式化绩效报告，用于命令行输出
+func (a Analytics) Format() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("交易绩效 %s ~ %s (数据来源: %s)\n", a.Since.Format("2006-01-02 15:04"), a.Until.Format("2006-01-02 15:04"), a.Source))
+	b.WriteString(fmt.Sprintf("权益: %.2f → %.2f USDT，净盈亏 %.2f (%.2f%%)，手续费 %.2f，资金费用 %.2f\n", a.StartEquity, a.EndEquity, a.NetPnl, a.ReturnPct, a.Commission, a.Funding))
+	b.WriteString(fmt.Sprintf("夏普 %.2f | 索提诺 %.2f | 卡玛 %.2f | 最大回撤 %.2f%% | 最长回撤 %s\n", a.Sharpe, a.Sortino, a.Calmar, a.MaxDrawdown, a.DrawdownTime))
+	b.WriteString(fmt.Sprintf("完整交易 %d 笔 | 胜率 %.1f%% | 平均盈利 %.2f | 平均亏损 %.2f | 盈亏比 %.2f | 期望 %.2f | 利润因子 %.2f | 平均持仓 %.1f小时\n",
+		a.Trades, a.WinRate, a.AvgWin, a.AvgLoss, a.PayoffRatio, a.Expectancy, a.ProfitFactor, a.AvgHoldHours))
+	for _, group := range []struct {
+		title string
+		items []Breakdown
+	}{{"按开仓决策", a.ByEntryAction}, {"按平仓方式", a.ByExitAction}, {"按模型", a.ByModel}} {
+		if len(group.items) == 0 {
+			continue
+		}
+		b.WriteString(group.title + ":\n")
+		for _, item := range group.items {
+			b.WriteString(fmt.Sprintf("  - %s: %d笔 胜率%.1f%% 净盈亏%.2f 期望%.2f 利润因子%.2f\n", item.Key, item.Trades, item.WinRate, item.NetPnl, item.Expectancy, item.ProfitFactor))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
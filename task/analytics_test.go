@@ -0,0 +1,63 @@
+package task_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"deeptrade/store"
+	"deeptrade/task"
+)
+
+func TestComputeAnalytics(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	day := func(d, h int) time.Time { return since.AddDate(0, 0, d).Add(time.Duration(h) * time.Hour) }
+	in := task.AnalyticsInput{
+		Since: since, Until: day(4, 0), StartEquity: 1000,
+		Fills: []store.Fill{
+			{TradeID: 1, Side: "BUY", Qty: 1, Price: 3000, Commission: 1, Time: day(0, 1)},
+			{TradeID: 2, Side: "SELL", Qty: 1, Price: 3100, RealizedPnl: 100, Commission: 1, Time: day(0, 5)},
+			{TradeID: 3, Side: "SELL", Qty: 1, Price: 3100, Commission: 1, Time: day(1, 1)},
+			{TradeID: 4, Side: "BUY", Qty: 1, Price: 3150, RealizedPnl: -50, Commission: 1, Time: day(1, 2)},
+			{TradeID: 5, Side: "BUY", Qty: 1, Price: 3000, Commission: 1, Time: day(2, 1)},
+			{TradeID: 6, Side: "SELL", Qty: 1, Price: 3080, RealizedPnl: 80, Commission: 1, Time: day(3, 1)},
+		},
+		Funding: []store.FundingPayment{{Amount: -2, Time: day(2, 8)}},
+		Decisions: []store.Decision{
+			{Time: day(0, 1).Add(-5 * time.Minute), Action: "OPEN_LONG", Model: "a"},
+			{Time: day(1, 1).Add(-5 * time.Minute), Action: "OPEN_SHORT", Model: "b"},
+			{Time: day(1, 2).Add(-5 * time.Minute), Action: "CLOSE_SHORT", Model: "b"},
+			{Time: day(2, 1).Add(-5 * time.Minute), Action: "OPEN_LONG", Model: "a"},
+		},
+	}
+	in.Trips, _ = task.BuildRoundTrips(in.Fills, in.Funding)
+	a := task.ComputeAnalytics(in)
+
+	if a.EndEquity != 1000+100-50+80-6-2 || a.Commission != 6 || a.Funding != -2 {
+		t.Fatalf("权益错误: %+v", a)
+	}
+	if a.Trades != 3 || math.Abs(a.WinRate-200.0/3) > 1e-9 {
+		t.Errorf("交易统计错误: %d %v", a.Trades, a.WinRate)
+	}
+	// 净盈亏: 98, -52, 76
+	if math.Abs(a.ProfitFactor-174.0/52) > 1e-9 || math.Abs(a.PayoffRatio-87.0/52) > 1e-9 || math.Abs(a.Expectancy-122.0/3) > 1e-9 {
+		t.Errorf("盈亏比或期望错误: %+v", a)
+	}
+	if len(a.DailyReturns) != 4 || a.Sharpe <= 0 || a.Sortino <= a.Sharpe || a.Calmar <= 0 {
+		t.Errorf("风险调整收益错误: %v %v %v %v", a.DailyReturns, a.Sharpe, a.Sortino, a.Calmar)
+	}
+	// 最大回撤从 day0 5点的高点1098算起
+	if math.Abs(a.MaxDrawdown-55.0/1098*100) > 1e-9 || a.DrawdownHours != 68 {
+		t.Errorf("回撤错误: %v %v", a.MaxDrawdown, a.DrawdownHours)
+	}
+	if len(a.ByModel) != 2 || a.ByModel[0].Key != "a" || a.ByModel[0].Trades != 2 {
+		t.Errorf("按模型分组错误: %+v", a.ByModel)
+	}
+	exits := map[string]int{}
+	for _, b := range a.ByExitAction {
+		exits[b.Key] = b.Trades
+	}
+	if exits["CLOSE_SHORT"] != 1 || exits["止盈止损"] != 2 {
+		t.Errorf("按平仓方式分组错误: %+v", a.ByExitAction)
+	}
+}
@@ -0,0 +1,235 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/utils"
+)
+
+// PauseState 暂停状态：暂停期间跳过交易周期，不撤单也不平仓，持仓仍由止盈止损和强平防护保护
+type PauseState struct {
+	Paused   bool      `json:"paused"`
+	Reason   string    `json:"reason"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+const pauseStateFile = "paused.json"
+
+// tradingMutex 交易锁：交易周期的下单阶段、手动平仓、调整止盈止损、紧急停止和强平监控的减仓清仓互斥，
+// 避免交易周期按过期的持仓状态重新开仓或挂单
+var tradingMutex sync.Mutex
+
+var (
+	pauseMutex  sync.Mutex
+	pauseState  PauseState
+	pauseLoaded bool
+)
+
+// loadPauseState 首次使用时加载持久化的暂停状态，调用方需持有 pauseMutex
+func loadPauseState() {
+	if pauseLoaded {
+		return
+	}
+	pauseLoaded = true
+	data, err := os.ReadFile(conf.Get().Storage.Path(pauseStateFile))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &pauseState); err != nil {
+		logger.Errorf(context.Background(), "[控制] 解析暂停状态失败: %v", err)
+	}
+}
+
+// GetPauseState 获取暂停状态
+func GetPauseState() PauseState {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	loadPauseState()
+	return pauseState
+}
+
+// IsPaused 是否暂停交易
+func IsPaused() bool {
+	return GetPauseState().Paused
+}
+
+// Pause 暂停交易，重启后仍然生效
+func Pause(ctx context.Context, reason string) error {
+	logger.Infof(ctx, "[控制] 暂停交易: %s", reason)
+	return savePauseState(PauseState{Paused: true, Reason: reason, PausedAt: time.Now()})
+}
+
+// Resume 恢复交易
+func Resume(ctx context.Context) error {
+	logger.Infof(ctx, "[控制] 恢复交易")
+	return savePauseState(PauseState{})
+}
+
+// savePauseState 更新并持久化暂停状态
+func savePauseState(state PauseState) error {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	pauseLoaded = true
+	pauseState = state
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(conf.Get().Storage.Path(pauseStateFile), data, 0644)
+}
+
+// RequestCycle 立即唤醒等待中的交易周期，只在交易时段内生效
+func RequestCycle(reason string) error {
+	switch {
+	case IsHalted():
+		return fmt.Errorf("系统处于紧急停止状态")
+	case IsPaused():
+		return fmt.Errorf("交易已暂停")
+	case !IsWork():
+		return fmt.Errorf("当前不在交易时段")
+	case cycleRunning():
+		return fmt.Errorf("交易周期进行中")
+	}
+	select {
+	case triggerWake <- TriggerEvent{Kind: "manual", Reason: reason, Time: time.Now()}:
+		return nil
+	default:
+		return fmt.Errorf("已有待处理的唤醒事件")
+	}
+}
+
+// LastCycleTime 上一个交易周期的开始时间
+func LastCycleTime() time.Time {
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+	return triggerLastCycle
+}
+
+// PositionStatus 当前持仓及其止盈止损委托
+type PositionStatus struct {
+	Positions  []binance.Position `json:"positions"`
+	StopLoss   []binance.Order    `json:"stop_loss"`
+	TakeProfit []binance.Order    `json:"take_profit"`
+	Summary    string             `json:"summary"` // 与提示词相同的持仓描述
+}
+
+// GetPositionStatus 查询当前持仓和止盈止损委托
+func GetPositionStatus(ctx context.Context) (*PositionStatus, error) {
+	client, err := binance.GetFuturesClient()
+	if err != nil {
+		return nil, fmt.Errorf("创建期货客户端失败: %v", err)
+	}
+	positions, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓信息失败: %v", err)
+	}
+	orders, err := client.GetOpenOrders(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		return nil, fmt.Errorf("获取挂单信息失败: %v", err)
+	}
+	status := &PositionStatus{Positions: []binance.Position{}, StopLoss: []binance.Order{}, TakeProfit: []binance.Order{}}
+	for _, pos := range positions {
+		if amt, _ := strconv.ParseFloat(pos.PositionAmt, 64); amt != 0 {
+			status.Positions = append(status.Positions, pos)
+		}
+	}
+	for _, o := range orders {
+		switch o.Type {
+		case binance.OrderTypeStopMarket, binance.OrderTypeStop:
+			status.StopLoss = append(status.StopLoss, o)
+		case binance.OrderTypeTakeProfitMarket, binance.OrderTypeTakeProfit:
+			status.TakeProfit = append(status.TakeProfit, o)
+		}
+	}
+	status.Summary = FormatPositionWithSLTP(positions, orders)
+	return status, nil
+}
+
+// ClosePositions 手动市价平仓并删除对应的止盈止损委托，side 为 LONG/SHORT 时只平该方向，为空时全部平仓
+func ClosePositions(ctx context.Context, side string, reason string) error {
+	tradingMutex.Lock()
+	defer tradingMutex.Unlock()
+	client, err := binance.GetFuturesClient()
+	if err != nil {
+		return fmt.Errorf("创建期货客户端失败: %v", err)
+	}
+	positions, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		return fmt.Errorf("获取持仓信息失败: %v", err)
+	}
+	var targets []binance.Position
+	for _, pos := range positions {
+		amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+		posSide := string(pos.PositionSide)
+		if pos.PositionSide == binance.PositionSideBoth {
+			posSide = "LONG"
+			if amt < 0 {
+				posSide = "SHORT"
+			}
+		}
+		if amt != 0 && (side == "" || side == posSide) {
+			targets = append(targets, pos)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("没有可平仓的持仓")
+	}
+	dualSide, err := client.GetPositionMode(ctx)
+	if err != nil {
+		logger.Warnf(ctx, "[控制] 获取持仓模式失败，按单向模式继续: %v", err)
+		dualSide = false
+	}
+	logger.Infof(ctx, "[控制] 手动平仓(%s): %s", side, reason)
+	return flattenPositions(ctx, client, targets, dualSide)
+}
+
+// AdjustSLTP 手动调整当前持仓的止盈止损，与模型输出的 ADJUST_SL_TP 信号经过相同的校验和执行流程
+func AdjustSLTP(ctx context.Context, stopLoss, takeProfit float64, reason string) error {
+	tradingMutex.Lock()
+	defer tradingMutex.Unlock()
+	marketData, err := GetMarketData(ctx)
+	if err != nil {
+		return fmt.Errorf("获取市场数据失败: %v", err)
+	}
+	if !marketData.PositionInfo.HasLong && !marketData.PositionInfo.HasShort {
+		return fmt.Errorf("当前没有持仓")
+	}
+	var currentPrice float64
+	if marketData.Ticker != nil {
+		currentPrice, _ = strconv.ParseFloat(marketData.Ticker.LastPrice, 64)
+	}
+	signal := &TradingSignal{Action: "ADJUST_SL_TP", StopLoss: stopLoss, TakeProfit: takeProfit, Reasoning: reason}
+	if err := ValidateSignal(signal, currentPrice, marketData.PositionInfo); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "[控制] 手动调整止损止盈: 止损%.2f 止盈%.2f", stopLoss, takeProfit)
+	return ExecuteTrade(ctx, signal, marketData)
+}
+
+// positionChanged 重新查询持仓，判断持仓方向与分析时的市场数据是否一致，查询失败时视为未变化
+func positionChanged(ctx context.Context, marketData *MarketData) bool {
+	positions, err := binance.GetOnceFuturesClient().GetPositions(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		logger.Warnf(ctx, "[量化交易] 下单前查询持仓失败: %v", err)
+		return false
+	}
+	current := GetPositionInfo(positions)
+	return current.HasLong != marketData.PositionInfo.HasLong || current.HasShort != marketData.PositionInfo.HasShort
+}
+
+// SetModelOverride 运行时指定角色的首选模型；多模型投票模式下各模型固定参与投票，不支持切换
+func SetModelOverride(hasPosition bool, model string) error {
+	if model != "" && !usePipeline() && useEnsemble(hasPosition) {
+		return fmt.Errorf("当前角色使用多模型投票，不支持切换首选模型")
+	}
+	return utils.SetModelOverride(hasPosition, model)
+}
@@ -0,0 +1,66 @@
+package task_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"deeptrade/conf"
+	"deeptrade/task"
+	"deeptrade/utils"
+)
+
+// testConfig 加载仓库中的配置文件，数据目录指向临时目录
+func testConfig(t *testing.T) *conf.Configuration {
+	t.Helper()
+	t.Setenv("FREEDOM_PROJECT_CONFIG", "../conf")
+	cfg := conf.Get()
+	cfg.Storage.DataDir = t.TempDir()
+	return cfg
+}
+
+func TestPauseResume(t *testing.T) {
+	cfg := testConfig(t)
+	if err := task.Pause(context.Background(), "维护"); err != nil {
+		t.Fatal(err)
+	}
+	if state := task.GetPauseState(); !state.Paused || state.Reason != "维护" {
+		t.Errorf("暂停状态错误: %+v", state)
+	}
+	if _, err := os.Stat(cfg.Storage.Path("paused.json")); err != nil {
+		t.Errorf("暂停状态未持久化: %v", err)
+	}
+	if err := task.RequestCycle("手动"); err == nil {
+		t.Error("暂停期间不应唤醒交易周期")
+	}
+	if err := task.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if task.IsPaused() {
+		t.Error("恢复后仍处于暂停状态")
+	}
+}
+
+func TestSetModelOverride(t *testing.T) {
+	cfg := testConfig(t)
+	ensemble, pipeline := cfg.Ensemble, cfg.Pipeline
+	defer func() { cfg.Ensemble, cfg.Pipeline = ensemble, pipeline }()
+	model := cfg.LLM[0].Model
+
+	cfg.Pipeline.Enable = false
+	cfg.Ensemble = conf.EnsembleConf{Enable: true, Models: []string{model}, EntryOnly: true}
+	if err := task.SetModelOverride(false, model); err == nil {
+		t.Error("多模型投票模式下应拒绝切换首选模型")
+	}
+	// 只在开仓时投票，持仓角色仍可切换
+	if err := task.SetModelOverride(true, model); err != nil {
+		t.Fatal(err)
+	}
+	defer utils.SetModelOverride(true, "")
+	if utils.ModelOverride(true) != model {
+		t.Errorf("首选模型未生效: %s", utils.ModelOverride(true))
+	}
+	if err := task.SetModelOverride(true, "not-configured"); err == nil {
+		t.Error("未配置的模型应报错")
+	}
+}
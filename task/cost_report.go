@@ -0,0 +1,43 @@
+package task
+
+import (
+	"time"
+
+	"deeptrade/utils"
+)
+
+// CostReport LLM费用与交易结果对比
+type CostReport struct {
+	Days         int     `json:"days"`           // 统计天数
+	LLMCost      float64 `json:"llm_cost"`       // LLM费用
+	Trades       int     `json:"trades"`         // 平仓笔数
+	RealizedPnl  float64 `json:"realized_pnl"`   // 扣除手续费后的盈亏
+	CostPerTrade float64 `json:"cost_per_trade"` // 每笔平仓的LLM费用
+	CostPerPnl   float64 `json:"cost_per_pnl"`   // 每单位盈亏的LLM费用，盈亏不为正时为0
+}
+
+// NewCostReport 根据LLM费用和成交统计计算单笔费用和单位盈亏费用
+func NewCostReport(cost float64, stats TradeStats, days int) CostReport {
+	report := CostReport{Days: days, LLMCost: cost, Trades: stats.Closes, RealizedPnl: stats.NetPnl}
+	if stats.Closes > 0 {
+		report.CostPerTrade = cost / float64(stats.Closes)
+	}
+	if stats.NetPnl > 0 {
+		report.CostPerPnl = cost / stats.NetPnl
+	}
+	return report
+}
+
+// BuildCostReport 统计最近 days 天(默认7天，最多90天)的LLM费用与本地交易日志中的交易结果
+func BuildCostReport(days int) (CostReport, error) {
+	if days <= 0 || days > 90 {
+		days = 7
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -days)
+	trades, err := journalTrades(start, end)
+	if err != nil {
+		return CostReport{}, err
+	}
+	return NewCostReport(utils.LLMCostBetween(start, end), ComputeTradeStats(trades), days), nil
+}
@@ -0,0 +1,17 @@
+package task_test
+
+import (
+	"testing"
+
+	"deeptrade/task"
+)
+
+func TestNewCostReport(t *testing.T) {
+	r := task.NewCostReport(2, task.TradeStats{Closes: 4, NetPnl: 10}, 7)
+	if r.CostPerTrade != 0.5 || r.CostPerPnl != 0.2 || r.Trades != 4 {
+		t.Errorf("费用报告错误: %+v", r)
+	}
+	if r := task.NewCostReport(2, task.TradeStats{NetPnl: -3}, 7); r.CostPerTrade != 0 || r.CostPerPnl != 0 {
+		t.Errorf("无平仓或亏损时不应计算单位费用: %+v", r)
+	}
+}
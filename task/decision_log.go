@@ -0,0 +1,132 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"deeptrade/logger"
+	"deeptrade/prompt"
+	"deeptrade/store"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 决策模式
+const (
+	DecisionModeSingle   = "single"   // 单模型
+	DecisionModeEnsemble = "ensemble" // 多模型投票
+	DecisionModePipeline = "pipeline" // 多角色决策流程
+)
+
+// StageTranscript 决策中一次模型调用的输入输出
+type StageTranscript struct {
+	Role       string `json:"role"`
+	Model      string `json:"model"`
+	Input      string `json:"input,omitempty"` // 行情数据之外该角色收到的内容
+	Output     string `json:"output"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DecisionRecord 一次交易决策的记录
+type DecisionRecord struct {
+	Time           time.Time             `json:"time"`
+	CycleID        string                `json:"cycle_id,omitempty"` // 交易周期ID，与日志中的 cycle 字段对应
+	Mode           string                `json:"mode"`
+	PromptVersion  string                `json:"prompt_version"`            // 提示词模板版本
+	PromptHash     string                `json:"prompt_hash"`               // 提示词模板内容哈希
+	Prompt         string                `json:"prompt"`                    // 行情数据提示词
+	PromptSections []prompt.SectionUsage `json:"prompt_sections,omitempty"` // 各段落的估算token
+	Stages         []StageTranscript     `json:"stages,omitempty"`
+	Signal         *TradingSignal        `json:"signal,omitempty"`
+	Error          string                `json:"error,omitempty"`
+}
+
+// newDecisionRecord 创建决策记录
+func newDecisionRecord(ctx context.Context, mode string, prompts *prompt.Set, message *schema.Message) *DecisionRecord {
+	return &DecisionRecord{Time: time.Now(), CycleID: logger.CycleID(ctx), Mode: mode, PromptVersion: prompts.Version, PromptHash: prompts.Hash, Prompt: message.Content}
+}
+
+// recordStage 包装模型调用，记录每次调用的输入输出，input 为行情数据之外的输入
+func (r *DecisionRecord) recordStage(role, input string, call func(msgs []*schema.Message) (string, string, error)) func(msgs []*schema.Message) (string, error) {
+	return func(msgs []*schema.Message) (string, error) {
+		tr := StageTranscript{Role: role, Input: input}
+		if len(msgs) > 1 {
+			// 修正轮次只记录追加的修正要求
+			tr.Input = msgs[len(msgs)-1].Content
+		}
+		startTime := time.Now()
+		output, model, err := call(msgs)
+		tr.Model, tr.Output = model, output
+		tr.DurationMs = time.Since(startTime).Milliseconds()
+		if err != nil {
+			tr.Error = err.Error()
+		}
+		r.Stages = append(r.Stages, tr)
+		return output, err
+	}
+}
+
+// finish 记录决策结果并写入交易日志
+func (r *DecisionRecord) finish(ctx context.Context, signal *TradingSignal, err error) {
+	r.Signal = signal
+	if err != nil {
+		r.Error = err.Error()
+	}
+	saveDecisionRecord(ctx, r)
+}
+
+// journalDecision 转换为交易日志中的决策，raw 为完整的决策记录
+func journalDecision(r *DecisionRecord, raw []byte) store.Decision {
+	d := store.Decision{Time: r.Time, Mode: r.Mode, PromptVersion: r.PromptVersion, Error: r.Error, Record: raw}
+	if n := len(r.Stages); n > 0 {
+		d.Model = r.Stages[n-1].Model
+	}
+	if s := r.Signal; s != nil {
+		d.Action, d.Score, d.Confidence, d.Reasoning = s.Action, s.Score, s.Confidence, s.Reasoning
+	}
+	return d
+}
+
+// saveDecisionRecord 保存完整的决策记录到本地交易日志
+func saveDecisionRecord(ctx context.Context, r *DecisionRecord) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		logger.Errorf(ctx, "[决策日志] 序列化决策记录失败: %v", err)
+		return
+	}
+	if err := store.GetOnceDB().PutDecision(journalDecision(r, raw)); err != nil {
+		logger.Errorf(ctx, "[交易日志] 保存决策失败: %v", err)
+	}
+}
+
+// LoadDecisions 从交易日志读取时间范围内的决策摘要，按时间正序；只有非观望的决策保留完整记录
+func LoadDecisions(since, until time.Time) ([]store.Decision, error) {
+	decisions, err := store.GetOnceDB().Decisions(since, until)
+	if err != nil {
+		return nil, err
+	}
+	for i := range decisions {
+		if decisions[i].Action == "" || decisions[i].Action == "HOLD" {
+			decisions[i].Record = nil
+		}
+	}
+	return decisions, nil
+}
+
+// LastDecisionRecords 从交易日志读取最近 n 条完整的决策记录，包含提示词和各阶段模型输出，最新的在前
+func LastDecisionRecords(n int) ([]DecisionRecord, error) {
+	decisions, err := store.GetOnceDB().LastDecisions(n)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]DecisionRecord, 0, len(decisions))
+	for i := len(decisions) - 1; i >= 0; i-- {
+		var r DecisionRecord
+		if err := json.Unmarshal(decisions[i].Record, &r); err == nil {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package task_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"deeptrade/store"
+	"deeptrade/task"
+)
+
+func TestLastDecisionRecords(t *testing.T) {
+	testConfig(t)
+	db := store.GetOnceDB()
+	if db == nil {
+		t.Fatal("打开交易日志失败")
+	}
+	// 交易日志为进程内单例，写入晚于已有记录的决策
+	start := time.Now().Add(time.Hour)
+	if decisions, err := task.LoadDecisions(start, start.Add(time.Hour)); err != nil || len(decisions) != 0 {
+		t.Fatalf("没有决策时应返回空: %v %v", decisions, err)
+	}
+	for i := 1; i <= 4; i++ {
+		r := task.DecisionRecord{Time: start.Add(time.Duration(i) * time.Minute), CycleID: fmt.Sprintf("c%d", i), Mode: "single"}
+		raw, _ := json.Marshal(r)
+		if i == 3 {
+			raw = []byte(`"not a record"`)
+		}
+		if err := db.PutDecision(store.Decision{Time: r.Time, Mode: r.Mode, Record: raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := task.LastDecisionRecords(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].CycleID != "c4" || records[1].CycleID != "c2" {
+		t.Errorf("应按时间倒序返回最近的决策并跳过无法解析的记录: %+v", records)
+	}
+
+	decisions, err := task.LoadDecisions(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 4 || decisions[0].Record != nil {
+		t.Errorf("观望或无动作的决策不应保留完整记录: %+v", decisions)
+	}
+}
@@ -0,0 +1,247 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const ensembleLogFile = "ensemble_votes.jsonl"
+
+// EnsembleVote 单个模型的投票
+type EnsembleVote struct {
+	Model  string         `json:"model"`
+	Signal *TradingSignal `json:"signal,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// EnsembleResult 投票结果
+type EnsembleResult struct {
+	Time      time.Time      `json:"time"`
+	Votes     []EnsembleVote `json:"votes"`
+	Action    string         `json:"action"`    // 多数方向
+	Agreement float64        `json:"agreement"` // 多数方向占比
+	Final     *TradingSignal `json:"final"`
+}
+
+var ensembleLogMutex sync.Mutex
+
+// useEnsemble 当前是否使用多模型投票
+func useEnsemble(hasPosition bool) bool {
+	cfg := conf.Get().Ensemble
+	if !cfg.Enable || len(cfg.Models) == 0 {
+		return false
+	}
+	return !(hasPosition && cfg.EntryOnly)
+}
+
+// RunEnsemble 并行询问多个模型并聚合投票结果
+func RunEnsemble(ctx context.Context, system string, message *schema.Message, marketData *MarketData) (*TradingSignal, error) {
+	cfg := conf.Get().Ensemble
+	votes := make([]EnsembleVote, len(cfg.Models))
+
+	var wg sync.WaitGroup
+	for i, name := range cfg.Models {
+		votes[i].Model = name
+		llmconf, ok := conf.Get().GetLLMByModel(name)
+		if !ok {
+			votes[i].Error = "模型未配置"
+			continue
+		}
+		wg.Add(1)
+		go func(i int, llmconf conf.LLMConf) {
+			defer wg.Done()
+			signal, err := requestSignal(ctx, func(msgs []*schema.Message) (string, error) {
+				return utils.GenerateModel(ctx, llmconf, utils.Request{System: system, Messages: msgs, Output: signalOutput})
+			}, message, marketData)
+			if err != nil {
+				votes[i].Error = err.Error()
+				return
+			}
+			votes[i].Signal = signal
+		}(i, llmconf)
+	}
+	wg.Wait()
+
+	result := AggregateVotes(votes, cfg)
+	for _, v := range votes {
+		if v.Signal != nil {
+			logger.Infof(ctx, "[模型投票] %s: %s (评分: %d, 置信度: %.2f)", v.Model, v.Signal.Action, v.Signal.Score, v.Signal.Confidence)
+		} else {
+			logger.Infof(ctx, "[模型投票] %s: 无效票 %s", v.Model, v.Error)
+		}
+	}
+	logger.Infof(ctx, "[模型投票] 多数方向: %s, 占比: %.0f%%, 最终动作: %s", result.Action, result.Agreement*100, result.Final.Action)
+	saveEnsembleResult(ctx, result)
+	return result.Final, nil
+}
+
+// AggregateVotes 按多数方向聚合投票，票数或占比不足时输出HOLD
+func AggregateVotes(votes []EnsembleVote, cfg conf.EnsembleConf) *EnsembleResult {
+	result := &EnsembleResult{Time: time.Now(), Votes: votes}
+
+	weights := map[string]float64{}
+	var total float64
+	var valid int
+	for _, v := range votes {
+		if v.Signal == nil {
+			continue
+		}
+		valid++
+		w := voteWeight(v.Signal, cfg)
+		weights[v.Signal.Action] += w
+		total += w
+	}
+
+	if valid == 0 || total <= 0 {
+		result.Final = holdSignal("所有模型均未给出有效信号")
+		return result
+	}
+
+	actions := make([]string, 0, len(weights))
+	for action := range weights {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		if weights[action] > weights[result.Action] {
+			result.Action = action
+		}
+	}
+	result.Agreement = weights[result.Action] / total
+
+	var agree []*TradingSignal
+	for _, v := range votes {
+		if v.Signal != nil && v.Signal.Action == result.Action {
+			agree = append(agree, v.Signal)
+		}
+	}
+
+	minVotes := cfg.MinVotes
+	if minVotes <= 0 {
+		minVotes = 1
+	}
+	switch {
+	case valid < minVotes:
+		result.Final = holdSignal(fmt.Sprintf("有效票数%d少于%d", valid, minVotes))
+		return result
+	case result.Agreement < cfg.MinAgreement:
+		result.Final = holdSignal(fmt.Sprintf("模型分歧: %s占比%.0f%%低于%.0f%%", describeVotes(votes), result.Agreement*100, cfg.MinAgreement*100))
+		return result
+	}
+
+	result.Final = mergeSignals(agree, cfg)
+	if result.Final.Action != "HOLD" {
+		result.Final.Reasoning = fmt.Sprintf("[模型投票 %s，占比%.0f%%] %s", describeVotes(votes), result.Agreement*100, result.Final.Reasoning)
+	}
+	return result
+}
+
+// mergeSignals 合并同方向的信号，止损止盈和仓位按权重平均
+func mergeSignals(signals []*TradingSignal, cfg conf.EnsembleConf) *TradingSignal {
+	merged := &TradingSignal{Action: signals[0].Action}
+	var totalWeight, score, confidence, stopLoss, takeProfit, size float64
+	var slWeight, tpWeight float64
+	var reasons []string
+	best := signals[0]
+	for _, s := range signals {
+		w := voteWeight(s, cfg)
+		totalWeight += w
+		score += float64(s.Score) * w
+		confidence += s.Confidence
+		size += float64(s.PositionSize) * w
+		if s.StopLoss > 0 {
+			stopLoss += s.StopLoss * w
+			slWeight += w
+		}
+		if s.TakeProfit > 0 {
+			takeProfit += s.TakeProfit * w
+			tpWeight += w
+		}
+		if s.Confidence > best.Confidence {
+			best = s
+		}
+		if s.Reasoning != "" {
+			reasons = append(reasons, s.Reasoning)
+		}
+	}
+
+	merged.Score = int(math.Round(score / totalWeight))
+	merged.Confidence = confidence / float64(len(signals))
+	merged.PositionSize = int(math.Round(size / totalWeight))
+	if slWeight > 0 {
+		merged.StopLoss = math.Round(stopLoss/slWeight*100) / 100
+	}
+	if tpWeight > 0 {
+		merged.TakeProfit = math.Round(takeProfit/tpWeight*100) / 100
+	}
+	merged.Reasoning = strings.Join(reasons, " | ")
+	merged.Memory = best.Memory
+	return merged
+}
+
+// voteWeight 计算单票权重
+func voteWeight(s *TradingSignal, cfg conf.EnsembleConf) float64 {
+	if !cfg.ConfidenceWeighted {
+		return 1
+	}
+	if s.Confidence <= 0 {
+		return 0.01
+	}
+	return s.Confidence
+}
+
+// describeVotes 汇总各动作的票数，例如 OPEN_LONG:2 HOLD:1
+func describeVotes(votes []EnsembleVote) string {
+	counts := map[string]int{}
+	for _, v := range votes {
+		if v.Signal != nil {
+			counts[v.Signal.Action]++
+		}
+	}
+	actions := make([]string, 0, len(counts))
+	for action := range counts {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	parts := make([]string, 0, len(actions))
+	for _, action := range actions {
+		parts = append(parts, fmt.Sprintf("%s:%d", action, counts[action]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// holdSignal 生成HOLD信号
+func holdSignal(reason string) *TradingSignal {
+	return &TradingSignal{Action: "HOLD", Reasoning: reason}
+}
+
+// saveEnsembleResult 追加记录投票结果
+func saveEnsembleResult(ctx context.Context, result *EnsembleResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf(ctx, "[模型投票] 序列化投票结果失败: %v", err)
+		return
+	}
+	ensembleLogMutex.Lock()
+	defer ensembleLogMutex.Unlock()
+	f, err := os.OpenFile(conf.Get().Storage.Path(ensembleLogFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[模型投票] 记录投票结果失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
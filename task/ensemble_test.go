@@ -0,0 +1,48 @@
+package task_test
+
+import (
+	"testing"
+
+	"deeptrade/conf"
+	"deeptrade/task"
+)
+
+func TestAggregateVotes(t *testing.T) {
+	cfg := conf.EnsembleConf{MinVotes: 2, MinAgreement: 0.6, ConfidenceWeighted: true}
+	vote := func(model, action string, confidence, sl, tp float64, size int) task.EnsembleVote {
+		return task.EnsembleVote{Model: model, Signal: &task.TradingSignal{
+			Action: action, Score: 6, Confidence: confidence, StopLoss: sl, TakeProfit: tp, PositionSize: size,
+		}}
+	}
+
+	// 多数做多，止损止盈按置信度加权
+	result := task.AggregateVotes([]task.EnsembleVote{
+		vote("a", "OPEN_LONG", 0.8, 2900, 3200, 20),
+		vote("b", "OPEN_LONG", 0.6, 2950, 3150, 10),
+		vote("c", "HOLD", 0.3, 0, 0, 0),
+	}, cfg)
+	if result.Final.Action != "OPEN_LONG" {
+		t.Fatalf("期望OPEN_LONG，实际%s: %s", result.Final.Action, result.Final.Reasoning)
+	}
+	if sl := result.Final.StopLoss; sl < 2921 || sl > 2922 {
+		t.Errorf("加权止损错误: %.2f", sl)
+	}
+
+	// 多空分歧输出HOLD
+	result = task.AggregateVotes([]task.EnsembleVote{
+		vote("a", "OPEN_LONG", 0.7, 2900, 3200, 20),
+		vote("b", "OPEN_SHORT", 0.7, 3100, 2800, 20),
+	}, cfg)
+	if result.Final.Action != "HOLD" {
+		t.Errorf("分歧时期望HOLD，实际%s", result.Final.Action)
+	}
+
+	// 有效票数不足输出HOLD
+	result = task.AggregateVotes([]task.EnsembleVote{
+		vote("a", "OPEN_LONG", 0.9, 2900, 3200, 20),
+		{Model: "b", Error: "timeout"},
+	}, cfg)
+	if result.Final.Action != "HOLD" {
+		t.Errorf("票数不足时期望HOLD，实际%s", result.Final.Action)
+	}
+}
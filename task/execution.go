@@ -1,35 +1,49 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
 	"strconv"
+	"time"
 
 	"deeptrade/binance"
+	"deeptrade/calendar"
 	"deeptrade/indicators"
+	"deeptrade/logger"
+	"deeptrade/store"
 	"deeptrade/utils"
 )
 
-// ExecuteTrade 执行交易（同时支持单向/双向持仓）
-func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
-	log.Printf("[交易执行] 准备执行交易: %s", signal.Action)
+// ExecuteTrade 执行交易（同时支持单向/双向持仓），调用方需持有 tradingMutex，使停止状态检查与紧急停止互斥
+func ExecuteTrade(ctx context.Context, signal *TradingSignal, marketData *MarketData) error {
+	logger.Infof(ctx, "[交易执行] 准备执行交易: %s", signal.Action)
 
 	// 基本校验
 	if signal == nil {
 		return fmt.Errorf("交易信号为空")
 	}
 	if signal.Action == "HOLD" {
-		log.Println("[交易执行] 信号为HOLD，跳过交易")
+		logger.Infof(ctx, "[交易执行] 信号为HOLD，跳过交易")
 		return nil
 	}
+	if IsHalted() {
+		logger.Warnf(ctx, "[交易执行] 系统处于紧急停止状态，拒绝执行: %s", signal.Action)
+		return nil
+	}
+	if isOpenOrAddAction(signal.Action) {
+		if ok, reason := calendar.GetOnceCalendar().CanOpenPosition(time.Now()); !ok {
+			logger.Warnf(ctx, "[交易执行] 交易日历限制开仓(%s)，跳过: %s", reason, signal.Action)
+			return nil
+		}
+	}
 	if utils.InSlice([]string{"CLOSE_LONG", "CLOSE_SHORT", "ADJUST_SL_TP"}, signal.Action) {
 		//平仓调仓需要重新拉取持仓，llm处理时间较长可能已经被止损止盈。
-		marketData.Positions, _ = binance.GetOnceFuturesClient().GetPositions(binance.ETHUSDT_PERP)
+		marketData.Positions, _ = binance.GetOnceFuturesClient().GetPositions(ctx, binance.ETHUSDT_PERP)
 		marketData.PositionInfo = GetPositionInfo(marketData.Positions)
 		if !marketData.PositionInfo.HasLong && !marketData.PositionInfo.HasShort {
-			log.Println("[交易执行] 持仓已不存在，跳过交易")
+			logger.Warnf(ctx, "[交易执行] 持仓已不存在，跳过交易")
 			return nil
 		}
 	}
@@ -39,8 +53,8 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 	// 处理动态调整止损止盈的情况
 
 	if isAdjustSLTPAction(signal.Action) {
-		log.Println("[交易执行] 信号为ADJUST_SL_TP，开始调整止损止盈")
-		return handleAdjustSLTP(signal, marketData, technicalData)
+		logger.Infof(ctx, "[交易执行] 信号为ADJUST_SL_TP，开始调整止损止盈")
+		return handleAdjustSLTP(ctx, signal, marketData, technicalData)
 	}
 
 	// 从MarketData中提取所需数据
@@ -59,44 +73,38 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 	// 客户端与交易参数
 	client, err := binance.GetFuturesClient()
 	if err != nil {
-		log.Printf("[交易执行] 创建期货客户端失败: %v", err)
+		logger.Errorf(ctx, "[交易执行] 创建期货客户端失败: %v", err)
 		return err
 	}
 	symbol := binance.ETHUSDT_PERP
 
 	// 检测持仓模式：dualSide=true 为双向（hedge），false 为单向（one-way）
-	dualSide, err := client.GetPositionMode()
+	dualSide, err := client.GetPositionMode(ctx)
 	if err != nil {
-		log.Printf("[交易执行] 获取持仓模式失败，按单向模式继续: %v", err)
+		logger.Warnf(ctx, "[交易执行] 获取持仓模式失败，按单向模式继续: %v", err)
 		dualSide = false
 	} else {
 		if dualSide {
-			log.Println("[交易执行] 当前为双向持仓模式")
+			logger.Infof(ctx, "[交易执行] 当前为双向持仓模式")
 		} else {
-			log.Println("[交易执行] 当前为单向持仓模式")
+			logger.Infof(ctx, "[交易执行] 当前为单向持仓模式")
 		}
 	}
 
 	// 仓位百分比 - 处理可能的百分号格式
 	positionPercent := float64(signal.PositionSize)
 	if err != nil {
-		log.Printf("[交易执行] 设置仓位百分比: %v, source:%v", err, signal.PositionSize)
+		logger.Infof(ctx, "[交易执行] 设置仓位百分比: %v, source:%v", err, signal.PositionSize)
 		return err
 	}
 
 	// 设置杠杆
-	leverage := 2
-	if signal.Confidence*100 >= 85 && math.Abs(float64(signal.Score)) >= 8 {
-		//当评分大于等于8，信心大于等于85 开启10倍杠杆
-		leverage = 10
-	} else if signal.Confidence*100 >= 75 && math.Abs(float64(signal.Score)) >= 7 {
-		leverage = 5
-	}
+	leverage := signalLeverage(signal)
 	if !utils.InSlice([]string{"CLOSE_LONG", "CLOSE_SHORT", "ADJUST_SL_TP"}, signal.Action) {
 		//非平仓和调整止损止盈需要设置杠杆
-		log.Printf("[交易执行] 设置杠杆倍数: %dx", leverage)
-		if err := client.SetLeverage(symbol, leverage); err != nil {
-			log.Printf("[交易执行] 设置杠杆失败: %v", err)
+		logger.Infof(ctx, "[交易执行] 设置杠杆倍数: %dx", leverage)
+		if err := client.SetLeverage(ctx, symbol, leverage); err != nil {
+			logger.Errorf(ctx, "[交易执行] 设置杠杆失败: %v", err)
 			return err
 		}
 	}
@@ -119,7 +127,7 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 	if isCloseAction(signal.Action) {
 		if err := ValidatePositionForClose(signal.Action, positionInfo); err != nil {
 			jdata, _ := json.Marshal(positionInfo)
-			log.Printf("[交易执行] 错误: %v 持仓数据: %v", err, jdata)
+			logger.Errorf(ctx, "[交易执行] 错误: %v 持仓数据: %v", err, jdata)
 			return nil // 不是错误，跳过即可
 		}
 		openQty, _ = GetCloseQuantity(signal.Action, positionInfo)
@@ -127,7 +135,7 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 
 	// 对开/加仓，若低于最小步进则不下单
 	if isOpenOrAddAction(signal.Action) && openQty < 0.001 {
-		log.Printf("[交易执行] 计算得到下单数量过小(%.3f)，跳过", openQty)
+		logger.Warnf(ctx, "[交易执行] 计算得到下单数量过小(%.3f)，跳过", openQty)
 		return nil
 	}
 
@@ -137,7 +145,7 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 		return fmt.Errorf("准备订单参数失败: %v", err)
 	}
 
-	log.Printf("[交易执行] 交易参数 - 操作: %s, 数量: %s ETH, 当前价格: %.2f, 可用余额: %.2f (钱包: %.2f, 保证金: %.2f), reduceOnly=%v, positionSide=%s",
+	logger.Infof(ctx, "[交易执行] 交易参数 - 操作: %s, 数量: %s ETH, 当前价格: %.2f, 可用余额: %.2f (钱包: %.2f, 保证金: %.2f), reduceOnly=%v, positionSide=%s",
 		orderParams.Description, toQuantityString(orderParams.Quantity), currentPrice, availableBalance,
 		balanceInfo.WalletBalance, balanceInfo.MarginBalance,
 		orderParams.ReduceOnly, orderParams.PositionSide)
@@ -160,35 +168,35 @@ func ExecuteTrade(signal *TradingSignal, marketData *MarketData) error {
 	}
 
 	// 下单前先删除可能存在的同方向止盈止损委托单（包含开/加仓与平仓）
-	if err := cancelStopLossAndTakeProfitOrders(client, symbol, dualSide, orderParams.PositionSide); err != nil {
-		log.Printf("[交易执行] 删除现有止盈止损委托失败: %v", err)
+	if err := cancelStopLossAndTakeProfitOrders(ctx, client, symbol, dualSide, orderParams.PositionSide); err != nil {
+		logger.Errorf(ctx, "[交易执行] 删除现有止盈止损委托失败: %v", err)
 		// 不返回错误，继续执行交易
 	}
 
-	orderResult, err := client.NewOrder(order, finalPosSide)
+	orderResult, err := client.NewOrder(ctx, order, finalPosSide)
 	if err != nil {
-		log.Printf("[交易执行] 下单失败: %v", err)
+		logger.Errorf(ctx, "[交易执行] 下单失败: %v", err)
 		return err
 	}
-	log.Printf("[交易执行] 订单执行成功 - 订单ID: %d, 状态: %s", orderResult.OrderID, orderResult.Status)
+	logger.Infof(ctx, "[交易执行] 订单执行成功 - 订单ID: %d, 状态: %s", orderResult.OrderID, orderResult.Status)
 
 	// 平仓后删除所有相关的止盈止损委托单
 	if orderParams.ReduceOnly {
-		if err := cancelStopLossAndTakeProfitOrders(client, symbol, dualSide, orderParams.PositionSide); err != nil {
-			log.Printf("[交易执行] 平仓后删除止盈止损委托失败: %v", err)
+		if err := cancelStopLossAndTakeProfitOrders(ctx, client, symbol, dualSide, orderParams.PositionSide); err != nil {
+			logger.Errorf(ctx, "[交易执行] 平仓后删除止盈止损委托失败: %v", err)
 			// 不返回错误，因为平仓已经成功
 		}
 	}
 
 	// 仅在开/加仓时设置止损/止盈；平仓不需要
 	if !orderParams.ReduceOnly {
-		if err := setStopLossAndTakeProfit(signal, marketData, currentPrice, orderParams.Side, technicalData, dualSide, orderParams.PositionSide); err != nil {
+		if err := setStopLossAndTakeProfit(ctx, signal, marketData, currentPrice, orderParams.Side, technicalData, dualSide, orderParams.PositionSide); err != nil {
 			// 不返回错误，因为主订单已经成功
 			return err
 		}
 	}
 
-	log.Println("[交易执行] 交易执行完成")
+	logger.Infof(ctx, "[交易执行] 交易执行完成")
 	return nil
 }
 
@@ -277,7 +285,7 @@ func prepareOrderParams(signal *TradingSignal, currentPrice float64, quantity fl
 }
 
 // setStopLossAndTakeProfit 设置止损止盈
-func setStopLossAndTakeProfit(signal *TradingSignal, marketData *MarketData, currentPrice float64, side binance.OrderSide, technicalData *TechnicalAnalysisData, dualSide bool, positionSide binance.PositionSide) (e error) {
+func setStopLossAndTakeProfit(ctx context.Context, signal *TradingSignal, marketData *MarketData, currentPrice float64, side binance.OrderSide, technicalData *TechnicalAnalysisData, dualSide bool, positionSide binance.PositionSide) (e error) {
 	// 根据波动率动态计算止损止盈
 	var finalStopLoss, finalTakeProfit float64
 
@@ -353,6 +361,9 @@ func setStopLossAndTakeProfit(signal *TradingSignal, marketData *MarketData, cur
 	}
 	symbol := binance.ETHUSDT_PERP
 
+	// 记录实际挂单成功的止损止盈价格
+	var placedStopLoss, placedTakeProfit float64
+
 	// 设置止损
 	if finalStopLoss > 0.0 {
 		var slSide binance.OrderSide
@@ -375,11 +386,12 @@ func setStopLossAndTakeProfit(signal *TradingSignal, marketData *MarketData, cur
 		} else {
 			slFinalPosSide = ""
 		}
-		if _, err := client.NewOrder(slOrder, slFinalPosSide); err != nil {
-			log.Printf("[交易执行] 设置止损单失败: %v", err)
+		if _, err := client.NewOrder(ctx, slOrder, slFinalPosSide); err != nil {
+			logger.Errorf(ctx, "[交易执行] 设置止损单失败: %v", err)
 			e = fmt.Errorf("[交易执行] 设置止损单失败: %v", err)
 		} else {
-			log.Printf("[交易执行] 止损单设置成功，价格: %s (基于波动率%.2f%%)", slOrder.StopPrice, volatilityPct)
+			placedStopLoss = finalStopLoss
+			logger.Infof(ctx, "[交易执行] 止损单设置成功，价格: %s (基于波动率%.2f%%)", slOrder.StopPrice, volatilityPct)
 		}
 	}
 
@@ -405,27 +417,40 @@ func setStopLossAndTakeProfit(signal *TradingSignal, marketData *MarketData, cur
 		} else {
 			tpFinalPosSide = ""
 		}
-		if _, err := client.NewOrder(tpOrder, tpFinalPosSide); err != nil {
-			log.Printf("[交易执行] 设置止盈单失败: %v", err)
+		if _, err := client.NewOrder(ctx, tpOrder, tpFinalPosSide); err != nil {
+			logger.Errorf(ctx, "[交易执行] 设置止盈单失败: %v", err)
 			e = fmt.Errorf("[交易执行] 设置止盈单失败: %v", err)
 		} else {
-			log.Printf("[交易执行] 止盈单设置成功，价格: %s (基于波动率%.2f%%)", tpOrder.StopPrice, volatilityPct)
+			placedTakeProfit = finalTakeProfit
+			logger.Infof(ctx, "[交易执行] 止盈单设置成功，价格: %s (基于波动率%.2f%%)", tpOrder.StopPrice, volatilityPct)
 		}
 	}
 
+	// 只把挂单成功的止损止盈记录到交易日志，失败的一侧记为0
+	if placedStopLoss == 0 && placedTakeProfit == 0 {
+		return
+	}
+	holdSide := "LONG"
+	if side == binance.OrderSideSell {
+		holdSide = "SHORT"
+	}
+	store.GetOnceDB().PutSLTPChange(store.SLTPChange{
+		Time: time.Now(), Symbol: string(symbol), PositionSide: holdSide,
+		StopLoss: placedStopLoss, TakeProfit: placedTakeProfit, Source: signal.Action,
+	})
 	return
 }
 
 // cancelStopLossAndTakeProfitOrders 删除指定方向的止损止盈委托单
-func cancelStopLossAndTakeProfitOrders(client *binance.FuturesClient, symbol binance.Symbol, dualSide bool, positionSide binance.PositionSide) error {
+func cancelStopLossAndTakeProfitOrders(ctx context.Context, client *binance.FuturesClient, symbol binance.Symbol, dualSide bool, positionSide binance.PositionSide) error {
 	// 获取当前所有挂单
-	orders, err := client.GetOpenOrders(symbol)
+	orders, err := client.GetOpenOrders(ctx, symbol)
 	if err != nil {
 		return fmt.Errorf("获取挂单失败: %v", err)
 	}
 
 	if len(orders) == 0 {
-		log.Println("[交易执行] 没有挂单需要删除")
+		logger.Infof(ctx, "[交易执行] 没有挂单需要删除")
 		return nil
 	}
 
@@ -443,11 +468,11 @@ func cancelStopLossAndTakeProfitOrders(client *binance.FuturesClient, symbol bin
 			}
 
 			// 取消单个订单
-			_, err := client.CancelOrder(symbol, order.OrderID, "")
+			_, err := client.CancelOrder(ctx, symbol, order.OrderID, "")
 			if err != nil {
-				log.Printf("[交易执行] 取消订单失败 (ID: %d, Type: %s): %v", order.OrderID, order.Type, err)
+				logger.Errorf(ctx, "[交易执行] 取消订单失败 (ID: %d, Type: %s): %v", order.OrderID, order.Type, err)
 			} else {
-				log.Printf("[交易执行] 成功取消订单 (ID: %d, Type: %s, Side: %s, Price: %s)",
+				logger.Infof(ctx, "[交易执行] 成功取消订单 (ID: %d, Type: %s, Side: %s, Price: %s)",
 					order.OrderID, order.Type, order.Side, order.StopPrice)
 				cancelledCount++
 			}
@@ -455,17 +480,17 @@ func cancelStopLossAndTakeProfitOrders(client *binance.FuturesClient, symbol bin
 	}
 
 	if cancelledCount > 0 {
-		log.Printf("[交易执行] 共删除 %d 个止盈止损委托单", cancelledCount)
+		logger.Infof(ctx, "[交易执行] 共删除 %d 个止盈止损委托单", cancelledCount)
 	} else {
-		log.Println("[交易执行] 没有找到需要删除的止盈止损委托单")
+		logger.Infof(ctx, "[交易执行] 没有找到需要删除的止盈止损委托单")
 	}
 
 	return nil
 }
 
 // handleAdjustSLTP 处理动态调整止损止盈的操作
-func handleAdjustSLTP(signal *TradingSignal, marketData *MarketData, technicalData *TechnicalAnalysisData) error {
-	log.Printf("[止损止盈调整] 开始处理动态调整止损止盈: %s", signal.Reasoning)
+func handleAdjustSLTP(ctx context.Context, signal *TradingSignal, marketData *MarketData, technicalData *TechnicalAnalysisData) error {
+	logger.Infof(ctx, "[止损止盈调整] 开始处理动态调整止损止盈: %s", signal.Reasoning)
 
 	// 基本校验
 	if signal.StopLoss == 0 && signal.TakeProfit == 0 {
@@ -480,9 +505,9 @@ func handleAdjustSLTP(signal *TradingSignal, marketData *MarketData, technicalDa
 	symbol := binance.ETHUSDT_PERP
 
 	// 检测持仓模式：dualSide=true 为双向（hedge），false 为单向（one-way）
-	dualSide, err := client.GetPositionMode()
+	dualSide, err := client.GetPositionMode(ctx)
 	if err != nil {
-		log.Printf("[止损止盈调整] 获取持仓模式失败，按单向模式继续: %v", err)
+		logger.Warnf(ctx, "[止损止盈调整] 获取持仓模式失败，按单向模式继续: %v", err)
 		dualSide = false
 	}
 
@@ -491,7 +516,7 @@ func handleAdjustSLTP(signal *TradingSignal, marketData *MarketData, technicalDa
 
 	// 检查是否有持仓
 	if !positionInfo.HasLong && !positionInfo.HasShort {
-		log.Println("[止损止盈调整] 没有持仓，无法调整止损止盈")
+		logger.Warnf(ctx, "[止损止盈调整] 没有持仓，无法调整止损止盈")
 		return nil
 	}
 
@@ -503,37 +528,49 @@ func handleAdjustSLTP(signal *TradingSignal, marketData *MarketData, technicalDa
 
 	// 处理多头持仓的止损止盈调整
 	if positionInfo.HasLong {
-		log.Printf("[止损止盈调整] 调整多头持仓止损止盈")
+		logger.Infof(ctx, "[止损止盈调整] 调整多头持仓止损止盈")
 
 		// 删除现有的多头止损止盈订单
-		if err := cancelStopLossAndTakeProfitOrders(client, symbol, dualSide, binance.PositionSideLong); err != nil {
-			log.Printf("[止损止盈调整] 删除多头现有止损止盈委托失败: %v", err)
+		if err := cancelStopLossAndTakeProfitOrders(ctx, client, symbol, dualSide, binance.PositionSideLong); err != nil {
+			logger.Errorf(ctx, "[止损止盈调整] 删除多头现有止损止盈委托失败: %v", err)
 			// 继续执行，不返回错误
 		}
 
-		if err := setStopLossAndTakeProfit(signal, marketData, currentPrice, binance.OrderSideBuy, technicalData, dualSide, binance.PositionSideLong); err != nil {
-			log.Printf("[止损止盈调整] 设置多头新止损止盈失败: %v", err)
+		if err := setStopLossAndTakeProfit(ctx, signal, marketData, currentPrice, binance.OrderSideBuy, technicalData, dualSide, binance.PositionSideLong); err != nil {
+			logger.Errorf(ctx, "[止损止盈调整] 设置多头新止损止盈失败: %v", err)
 			return err
 		}
 	}
 
 	// 处理空头持仓的止损止盈调整
 	if positionInfo.HasShort {
-		log.Printf("[止损止盈调整] 调整空头持仓止损止盈")
+		logger.Infof(ctx, "[止损止盈调整] 调整空头持仓止损止盈")
 
 		// 删除现有的空头止损止盈订单
-		if err := cancelStopLossAndTakeProfitOrders(client, symbol, dualSide, binance.PositionSideShort); err != nil {
-			log.Printf("[止损止盈调整] 删除空头现有止损止盈委托失败: %v", err)
+		if err := cancelStopLossAndTakeProfitOrders(ctx, client, symbol, dualSide, binance.PositionSideShort); err != nil {
+			logger.Errorf(ctx, "[止损止盈调整] 删除空头现有止损止盈委托失败: %v", err)
 			// 继续执行，不返回错误
 		}
 
-		if err := setStopLossAndTakeProfit(signal, marketData, currentPrice, binance.OrderSideSell, technicalData, dualSide, binance.PositionSideShort); err != nil {
-			log.Printf("[止损止盈调整] 设置空头新止损止盈失败: %v", err)
+		if err := setStopLossAndTakeProfit(ctx, signal, marketData, currentPrice, binance.OrderSideSell, technicalData, dualSide, binance.PositionSideShort); err != nil {
+			logger.Errorf(ctx, "[止损止盈调整] 设置空头新止损止盈失败: %v", err)
 			// 继续执行，不返回错误
 			return err
 		}
 	}
 
-	log.Println("[止损止盈调整] 动态调整止损止盈完成")
+	logger.Infof(ctx, "[止损止盈调整] 动态调整止损止盈完成")
 	return nil
 }
+
+// signalLeverage 根据信号的评分和信心度确定杠杆倍数
+func signalLeverage(signal *TradingSignal) int {
+	switch {
+	case signal.Confidence*100 >= 85 && math.Abs(float64(signal.Score)) >= 8:
+		//当评分大于等于8，信心大于等于85 开启10倍杠杆
+		return 10
+	case signal.Confidence*100 >= 75 && math.Abs(float64(signal.Score)) >= 7:
+		return 5
+	}
+	return 2
+}
@@ -0,0 +1,187 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/logger"
+	"deeptrade/store"
+)
+
+const (
+	journalSyncWindow   = 7 * 24 * time.Hour // 成交接口单次查询的最大时间范围
+	journalInitLookback = 7 * 24 * time.Hour // 首次同步回溯的时间
+	journalPageLimit    = 1000
+)
+
+// SyncJournal 同步订单、成交和资金费用到本地交易日志，并生成已平仓的完整交易
+func SyncJournal(ctx context.Context, orders []binance.Order) {
+	db := store.GetOnceDB()
+	if db == nil {
+		return
+	}
+	client, err := binance.GetFuturesClient()
+	if err != nil {
+		return
+	}
+	if len(orders) > 0 {
+		items := make([]store.Order, 0, len(orders))
+		for _, o := range orders {
+			items = append(items, store.OrderFromBinance(o))
+		}
+		if err := db.PutOrders(items); err != nil {
+			logger.Errorf(ctx, "[交易日志] 保存订单失败: %v", err)
+		}
+	}
+	if err := syncFills(ctx, client, db); err != nil {
+		logger.Errorf(ctx, "[交易日志] 同步成交失败: %v", err)
+	}
+	if err := syncFunding(ctx, client, db); err != nil {
+		logger.Errorf(ctx, "[交易日志] 同步资金费用失败: %v", err)
+	}
+	if err := syncRoundTrips(ctx, db); err != nil {
+		logger.Errorf(ctx, "[交易日志] 生成完整交易失败: %v", err)
+	}
+}
+
+// syncFills 从上次同步位置开始按时间窗口增量拉取成交
+func syncFills(ctx context.Context, client *binance.FuturesClient, db *store.DB) error {
+	start := db.Cursor("fills")
+	if start.IsZero() {
+		start = time.Now().Add(-journalInitLookback)
+	}
+	for start.Before(time.Now()) {
+		end := start.Add(journalSyncWindow)
+		if now := time.Now(); end.After(now) {
+			end = now
+		}
+		trades, err := client.GetUserTrades(ctx, binance.ETHUSDT, journalPageLimit, 0, start.UnixMilli(), end.UnixMilli())
+		if err != nil {
+			return err
+		}
+		fills := make([]store.Fill, 0, len(trades))
+		for _, t := range trades {
+			fills = append(fills, store.FillFromBinance(t))
+		}
+		if err := db.PutFills(fills); err != nil {
+			return err
+		}
+		// 达到单页上限时从最后一笔成交继续，否则进入下一个时间窗口
+		next := end
+		if len(trades) >= journalPageLimit {
+			next = fills[len(fills)-1].Time.Add(time.Millisecond)
+		}
+		if err := db.SetCursor("fills", next); err != nil {
+			return err
+		}
+		start = next
+	}
+	return nil
+}
+
+// syncFunding 增量拉取资金费用流水
+func syncFunding(ctx context.Context, client *binance.FuturesClient, db *store.DB) error {
+	start := db.Cursor("funding")
+	if start.IsZero() {
+		start = time.Now().Add(-journalInitLookback)
+	}
+	for {
+		incomes, err := client.GetIncomeHistory(ctx, string(binance.ETHUSDT), binance.IncomeTypeFundingFee, journalPageLimit, start.UnixMilli(), 0)
+		if err != nil {
+			return err
+		}
+		items := make([]store.FundingPayment, 0, len(incomes))
+		for _, in := range incomes {
+			items = append(items, store.FundingFromBinance(in))
+		}
+		if err := db.PutFunding(items); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		start = items[len(items)-1].Time.Add(time.Millisecond)
+		if err := db.SetCursor("funding", start); err != nil {
+			return err
+		}
+		if len(items) < journalPageLimit {
+			return nil
+		}
+	}
+}
+
+// syncRoundTrips 从上次未平仓交易的开仓时间重新拼接成交，保存新平仓的完整交易。
+// 同一笔交易的键不变，重复保存会覆盖
+func syncRoundTrips(ctx context.Context, db *store.DB) error {
+	since := db.Cursor("round_trips")
+	if since.IsZero() {
+		since = time.Now().Add(-journalInitLookback)
+	}
+	fills, err := db.Fills(since, time.Time{})
+	if err != nil || len(fills) == 0 {
+		return err
+	}
+	funding, err := db.Funding(since, time.Time{})
+	if err != nil {
+		return err
+	}
+	trips, resume := BuildRoundTrips(fills, funding)
+	if resume.IsZero() {
+		resume = fills[len(fills)-1].Time.Add(time.Millisecond)
+	}
+	if len(trips) > 0 {
+		candles, err := fetchCandles(ctx, binance.KlineInterval1m, trips[0].EntryTime, trips[len(trips)-1].ExitTime)
+		if err != nil {
+			logger.Warnf(ctx, "[交易日志] 获取K线失败，未计算MAE/MFE: %v", err)
+		}
+		for i := range trips {
+			ApplyExcursions(&trips[i], candles, time.Minute)
+		}
+		if err := db.PutRoundTrips(trips); err != nil {
+			return err
+		}
+	}
+	return db.SetCursor("round_trips", resume)
+}
+
+// journalTrades 从本地交易日志读取 [since, until) 内的成交，until 为零值时不限制
+func journalTrades(since, until time.Time) ([]binance.UserTrade, error) {
+	db := store.GetOnceDB()
+	if db == nil {
+		return nil, fmt.Errorf("本地交易日志不可用")
+	}
+	fills, err := db.Fills(since, until)
+	if err != nil {
+		return nil, err
+	}
+	trades := make([]binance.UserTrade, 0, len(fills))
+	for _, f := range fills {
+		trades = append(trades, f.UserTrade())
+	}
+	return trades, nil
+}
+
+// FormatJournalSummary 格式化本地交易日志中最近的完整交易和今日盈亏供提示词使用
+func FormatJournalSummary(limit int) string {
+	db := store.GetOnceDB()
+	if db == nil {
+		return ""
+	}
+	trips, err := db.LastRoundTrips(limit)
+	if err != nil {
+		return ""
+	}
+	now := time.Now()
+	today, _ := db.NetPnlSince(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	losses, _ := db.ConsecutiveLosses()
+	if len(trips) == 0 && today == 0 {
+		return ""
+	}
+	summary := fmt.Sprintf("今日净盈亏: %.2f USDT，连续亏损: %d笔", today, losses)
+	if len(trips) == 0 {
+		return summary
+	}
+	return summary + "\n" + FormatRoundTrips(trips)
+}
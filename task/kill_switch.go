@@ -0,0 +1,162 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/notify"
+)
+
+// HaltState 紧急停止状态，持久化到数据目录，重启后仍然生效
+type HaltState struct {
+	Halted   bool      `json:"halted"`    // 是否已停止交易
+	Reason   string    `json:"reason"`    // 触发原因
+	HaltedAt time.Time `json:"halted_at"` // 触发时间
+}
+
+const haltStateFile = "halted.json"
+
+var (
+	haltMutex sync.Mutex
+	haltState HaltState
+)
+
+// InitKillSwitch 加载持久化的停止状态，并监听 SIGUSR1 信号和哨兵文件
+func InitKillSwitch() {
+	if data, err := os.ReadFile(conf.Get().Storage.Path(haltStateFile)); err == nil {
+		haltMutex.Lock()
+		if err := json.Unmarshal(data, &haltState); err != nil {
+			logger.Errorf(context.Background(), "[紧急停止] 解析停止状态失败: %v", err)
+		}
+		haltMutex.Unlock()
+	}
+	if IsHalted() {
+		logger.Infof(context.Background(), "[紧急停止] 系统处于停止状态(%s)，需要重新启用后才会交易", GetHaltState().Reason)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+	go func() {
+		for range sigChan {
+			TriggerKillSwitch(context.Background(), "收到SIGUSR1信号")
+		}
+	}()
+
+	sentinel := conf.Get().KillSwitch.SentinelFile
+	if sentinel == "" {
+		return
+	}
+	interval := time.Duration(conf.Get().KillSwitch.PollSec) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	go func() {
+		for {
+			if _, err := os.Stat(sentinel); err == nil && !IsHalted() {
+				TriggerKillSwitch(context.Background(), fmt.Sprintf("检测到哨兵文件%s", sentinel))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// IsHalted 是否处于紧急停止状态
+func IsHalted() bool {
+	haltMutex.Lock()
+	defer haltMutex.Unlock()
+	return haltState.Halted
+}
+
+// GetHaltState 获取紧急停止状态
+func GetHaltState() HaltState {
+	haltMutex.Lock()
+	defer haltMutex.Unlock()
+	return haltState
+}
+
+// TriggerKillSwitch 紧急停止：撤销全部挂单、市价平掉全部持仓并停止交易
+func TriggerKillSwitch(ctx context.Context, reason string) error {
+	logger.Warnf(ctx, "[紧急停止] 触发紧急停止: %s", reason)
+	RecordRiskEvent(ctx, RiskEventKillSwitch, reason)
+	if err := saveHaltState(HaltState{Halted: true, Reason: reason, HaltedAt: time.Now()}); err != nil {
+		logger.Errorf(ctx, "[紧急停止] 保存停止状态失败: %v", err)
+	}
+
+	// 先设置停止状态再取交易锁：正在下单的交易周期完成后由下面的清仓处理，之后的交易周期在锁内检查到停止状态不再下单
+	tradingMutex.Lock()
+	defer tradingMutex.Unlock()
+
+	// 紧急停止不随调用方取消(程序退出信号或管理请求断开)，保留上下文中的日志字段并单独设置超时
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	client := binance.GetOnceFuturesClient()
+	symbol := binance.ETHUSDT_PERP
+	var errs []error
+	if _, err := client.CancelAllOpenOrders(ctx, symbol); err != nil {
+		errs = append(errs, fmt.Errorf("撤销挂单失败: %v", err))
+	}
+
+	positions, err := client.GetPositions(ctx, symbol)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("获取持仓失败: %v", err))
+	} else if HasRealPosition(positions) {
+		dualSide, err := client.GetPositionMode(ctx)
+		if err != nil {
+			logger.Warnf(ctx, "[紧急停止] 获取持仓模式失败，按单向模式继续: %v", err)
+			dualSide = false
+		}
+		if err := flattenPositions(ctx, client, positions, dualSide); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	CloseFetchPosition()
+
+	text := fmt.Sprintf("原因: %s\n时间: %s", reason, time.Now().Format("2006-01-02 15:04:05"))
+	if len(errs) > 0 {
+		text += fmt.Sprintf("\n错误: %v", errs)
+	}
+	notify.Notify(ctx, notify.Message{Event: notify.EventBreaker, Title: "DeepTrade紧急停止", Text: text})
+
+	if len(errs) > 0 {
+		logger.Errorf(ctx, "[紧急停止] 执行过程中出现错误: %v", errs)
+		return fmt.Errorf("紧急停止执行失败: %v", errs)
+	}
+	logger.Infof(ctx, "[紧急停止] 已撤销全部挂单并平掉全部持仓，交易已停止")
+	return nil
+}
+
+// Rearm 重新启用交易，同时删除哨兵文件
+func Rearm(ctx context.Context) error {
+	if sentinel := conf.Get().KillSwitch.SentinelFile; sentinel != "" {
+		if err := os.Remove(sentinel); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除哨兵文件失败: %v", err)
+		}
+	}
+	if err := saveHaltState(HaltState{}); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "[紧急停止] 交易已重新启用")
+	return nil
+}
+
+// saveHaltState 更新并持久化停止状态
+func saveHaltState(state HaltState) error {
+	haltMutex.Lock()
+	haltState = state
+	haltMutex.Unlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(conf.Get().Storage.Path(haltStateFile), data, 0644)
+}
@@ -0,0 +1,52 @@
+package task_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"deeptrade/task"
+)
+
+func TestKillSwitchStateAndRearm(t *testing.T) {
+	cfg := testConfig(t)
+	// 不启动哨兵文件轮询，避免测试中触发真实的撤单和平仓
+	cfg.KillSwitch.SentinelFile = ""
+	saved := task.HaltState{Halted: true, Reason: "测试停止", HaltedAt: time.Now().Truncate(time.Second)}
+	data, _ := json.Marshal(saved)
+	if err := os.WriteFile(cfg.Storage.Path("halted.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task.InitKillSwitch()
+	state := task.GetHaltState()
+	if !task.IsHalted() || state.Reason != saved.Reason || !state.HaltedAt.Equal(saved.HaltedAt) {
+		t.Fatalf("重启后应恢复停止状态: %+v", state)
+	}
+
+	sentinel := filepath.Join(cfg.Storage.DataDir, "KILL")
+	if err := os.WriteFile(sentinel, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.KillSwitch.SentinelFile = sentinel
+	if err := task.Rearm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if task.IsHalted() {
+		t.Error("重新启用后仍处于停止状态")
+	}
+	if _, err := os.Stat(sentinel); !os.IsNotExist(err) {
+		t.Errorf("重新启用应删除哨兵文件: %v", err)
+	}
+	data, err := os.ReadFile(cfg.Storage.Path("halted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var persisted task.HaltState
+	if err := json.Unmarshal(data, &persisted); err != nil || persisted.Halted {
+		t.Errorf("重新启用后的状态未持久化: %s %v", data, err)
+	}
+}
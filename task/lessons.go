@@ -0,0 +1,274 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/indicators"
+	"deeptrade/logger"
+	"deeptrade/utils"
+)
+
+const lessonsFile = "lessons.jsonl"
+
+// Lesson 复盘沉淀的一条交易经验
+type Lesson struct {
+	Time        time.Time `json:"time"`
+	Side        string    `json:"side"`         // LONG/SHORT
+	Setup       string    `json:"setup"`        // 交易形态
+	Tags        []string  `json:"tags"`         // 开仓时的市场特征
+	NetPnl      float64   `json:"net_pnl"`      // 交易净盈亏
+	Lesson      string    `json:"lesson"`       // 经验
+	AppliesWhen string    `json:"applies_when"` // 适用条件
+}
+
+var (
+	lessonsMutex  sync.Mutex
+	lessonsLoaded bool
+	lessons       []Lesson
+)
+
+// loadLessons 首次使用时从经验库加载，调用方需持有 lessonsMutex
+func loadLessons() {
+	if lessonsLoaded {
+		return
+	}
+	lessonsLoaded = true
+	f, err := os.Open(conf.Get().Storage.Path(lessonsFile))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var l Lesson
+		if err := json.Unmarshal(scanner.Bytes(), &l); err == nil {
+			lessons = append(lessons, l)
+		}
+	}
+}
+
+// saveLessons 追加经验到经验库
+func saveLessons(ctx context.Context, items []Lesson) {
+	lessonsMutex.Lock()
+	defer lessonsMutex.Unlock()
+	loadLessons()
+	lessons = append(lessons, items...)
+
+	f, err := os.OpenFile(conf.Get().Storage.Path(lessonsFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[交易复盘] 写入经验库失败: %v", err)
+		return
+	}
+	defer f.Close()
+	for _, l := range items {
+		if data, err := json.Marshal(l); err == nil {
+			f.Write(append(data, '\n'))
+		}
+	}
+}
+
+// GetLessons 获取经验库中的全部经验
+func GetLessons() []Lesson {
+	lessonsMutex.Lock()
+	defer lessonsMutex.Unlock()
+	loadLessons()
+	return append([]Lesson{}, lessons...)
+}
+
+// MatchLessons 按市场环境、交易形态和特征相似度选出最相关的经验，相关度相同时较新的优先
+func MatchLessons(items []Lesson, tags []string, limit int, minScore float64) []Lesson {
+	type scored struct {
+		lesson Lesson
+		score  float64
+	}
+	var candidates []scored
+	for _, l := range items {
+		if score := LessonScore(l.Tags, tags); score >= minScore {
+			candidates = append(candidates, scored{l, score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].lesson.Time.After(candidates[j].lesson.Time)
+	})
+	var result []Lesson
+	for i := 0; i < len(candidates) && (limit <= 0 || i < limit); i++ {
+		result = append(result, candidates[i].lesson)
+	}
+	return result
+}
+
+// LessonScore 计算两组市场特征的相关度(0-1)：市场环境相同得0.5分，交易形态相同得0.25分，其余特征按Jaccard相似度最多得0.25分
+func LessonScore(a, b []string) float64 {
+	var score float64
+	if ra := tagOf(a, "regime:"); ra != "" && ra == tagOf(b, "regime:") {
+		score += 0.5
+	}
+	if sa := tagOf(a, "setup:"); sa != "" && sa == tagOf(b, "setup:") {
+		score += 0.25
+	}
+	set := map[string]bool{}
+	for _, t := range a {
+		if !isKeyTag(t) {
+			set[t] = true
+		}
+	}
+	var inter, union int
+	for _, t := range b {
+		if isKeyTag(t) {
+			continue
+		}
+		if set[t] {
+			inter++
+			delete(set, t)
+		}
+		union++
+	}
+	union += len(set)
+	if union > 0 {
+		score += 0.25 * float64(inter) / float64(union)
+	}
+	return score
+}
+
+// FormatLessons 格式化经验供提示词使用
+func FormatLessons(items []Lesson) string {
+	var b strings.Builder
+	for _, l := range items {
+		result := "盈利"
+		if l.NetPnl < 0 {
+			result = "亏损"
+		}
+		side := map[string]string{"LONG": "多头", "SHORT": "空头"}[l.Side]
+		b.WriteString(fmt.Sprintf("- [%s %s %.2fU | %s | %s] %s", l.Time.Format("01-02"), side, l.NetPnl, result, l.Setup, l.Lesson))
+		if l.AppliesWhen != "" {
+			b.WriteString(fmt.Sprintf(" (适用: %s)", l.AppliesWhen))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// RelevantLessons 获取与当前市场特征最相关的经验，未启用复盘时返回空
+func RelevantLessons(tags []string) string {
+	cfg := conf.Get().Reflection
+	if !cfg.Enable || cfg.MaxLessons <= 0 {
+		return ""
+	}
+	return FormatLessons(MatchLessons(GetLessons(), tags, cfg.MaxLessons, cfg.MinScore))
+}
+
+// MarketTags 根据3分钟K线、24小时行情和资金费率提取市场特征和交易形态，用于匹配相似市场环境下的经验
+func MarketTags(technicalData *TechnicalAnalysisData, marketData *MarketData) []string {
+	var tags []string
+	var regime, setup string
+	prices := technicalData.Price3m
+	price := technicalData.CurrentPrice
+	if len(prices) >= 50 {
+		atr := indicators.GetLatestATR(technicalData.High3m, technicalData.Low3m, prices, 14)
+		sma20 := indicators.GetLatestSMA(prices, 20)
+		env := indicators.AnalyzeMarketEnvironment(prices, sma20, indicators.GetLatestSMA(prices, 50), atr)
+		regime = map[indicators.MarketEnvironment]string{
+			indicators.MarketEnvironmentBullish:  "bullish",
+			indicators.MarketEnvironmentBearish:  "bearish",
+			indicators.MarketEnvironmentSideways: "sideways",
+		}[env.Environment]
+		if regime != "" {
+			tags = append(tags, "regime:"+regime)
+		}
+		// 趋势中价格回到20均线一个ATR以内视为回踩，否则为顺势
+		if regime == "bullish" || regime == "bearish" {
+			setup = "trend"
+			if atr > 0 && math.Abs(price-sma20) <= atr {
+				setup = "pullback"
+			}
+		}
+		switch vol := indicators.CalculateVolatilityPercent(atr, technicalData.CurrentPrice); {
+		case vol >= 0.3:
+			tags = append(tags, "vol:high")
+		case vol <= 0.1:
+			tags = append(tags, "vol:low")
+		default:
+			tags = append(tags, "vol:normal")
+		}
+	}
+	if len(prices) > 14 {
+		rsi := indicators.GetLatestRSI(prices, 14)
+		switch {
+		case rsi >= 70:
+			tags = append(tags, "rsi:overbought")
+		case rsi <= 30:
+			tags = append(tags, "rsi:oversold")
+		default:
+			tags = append(tags, "rsi:neutral")
+		}
+		if setup == "" && regime != "" {
+			// 震荡市中超买超卖视为反转，否则为区间交易
+			setup = "range"
+			if rsi >= 70 || rsi <= 30 {
+				setup = "reversal"
+			}
+		}
+	}
+	if marketData != nil && marketData.Ticker != nil {
+		high := utils.ParseFloatSafe(marketData.Ticker.HighPrice, 0)
+		low := utils.ParseFloatSafe(marketData.Ticker.LowPrice, 0)
+		if high > low && technicalData.CurrentPrice > 0 {
+			pos := (technicalData.CurrentPrice - low) / (high - low)
+			if pos >= 0.95 || pos <= 0.05 {
+				// 贴近24小时高低点视为突破，优先于其他形态
+				setup = "breakout"
+			}
+			switch {
+			case pos >= 0.7:
+				tags = append(tags, "range:upper")
+			case pos <= 0.3:
+				tags = append(tags, "range:lower")
+			default:
+				tags = append(tags, "range:middle")
+			}
+		}
+	}
+	if marketData != nil && marketData.FundingRate != nil {
+		if rate, err := strconv.ParseFloat(marketData.FundingRate.FundingRate, 64); err == nil {
+			if rate >= 0 {
+				tags = append(tags, "funding:positive")
+			} else {
+				tags = append(tags, "funding:negative")
+			}
+		}
+	}
+	if setup != "" {
+		tags = append(tags, "setup:"+setup)
+	}
+	return tags
+}
+
+// tagOf 取出指定前缀的特征，如市场环境 regime: 和交易形态 setup:
+func tagOf(tags []string, prefix string) string {
+	for _, t := range tags {
+		if strings.HasPrefix(t, prefix) {
+			return t
+		}
+	}
+	return ""
+}
+
+// isKeyTag 是否为单独计分的市场环境或交易形态特征
+func isKeyTag(t string) bool {
+	return strings.HasPrefix(t, "regime:") || strings.HasPrefix(t, "setup:")
+}
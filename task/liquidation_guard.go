@@ -0,0 +1,311 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/notify"
+)
+
+// GuardStage 强平监控级别
+type GuardStage int
+
+const (
+	GuardStageNone    GuardStage = iota // 正常
+	GuardStageAlert                     // 告警
+	GuardStageReduce                    // 减仓
+	GuardStageFlatten                   // 清仓
+)
+
+// String 级别描述
+func (s GuardStage) String() string {
+	switch s {
+	case GuardStageAlert:
+		return "告警"
+	case GuardStageReduce:
+		return "减仓"
+	case GuardStageFlatten:
+		return "清仓"
+	default:
+		return "正常"
+	}
+}
+
+// LiquidationRisk 强平风险评估结果
+type LiquidationRisk struct {
+	Stage          GuardStage // 触发级别
+	MinDistancePct float64    // 所有持仓中距强平价最近的百分比，无持仓时为-1
+	MarginRatio    float64    // 账户保证金率(%)
+	Reason         string     // 触发原因
+}
+
+var (
+	guardMutex      sync.Mutex
+	guardLastAlert  = map[GuardStage]time.Time{}
+	guardLastRisk   *LiquidationRisk
+	guardLastStage  GuardStage
+	guardLastReduce = map[binance.PositionSide]time.Time{} // 各持仓方向最近一次减仓的时间
+)
+
+// EvaluateLiquidationRisk 计算持仓强平距离和账户保证金率，返回应触发的级别
+func EvaluateLiquidationRisk(positions []binance.Position, account *binance.FuturesAccountInfo, cfg conf.LiquidationGuardConf) *LiquidationRisk {
+	risk := &LiquidationRisk{MinDistancePct: -1}
+
+	for _, pos := range positions {
+		amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+		markPrice, _ := strconv.ParseFloat(pos.MarkPrice, 64)
+		liqPrice, _ := strconv.ParseFloat(pos.LiquidationPrice, 64)
+		if amt == 0 || markPrice <= 0 || liqPrice <= 0 {
+			continue
+		}
+		distance := math.Abs(markPrice-liqPrice) / markPrice * 100
+		if risk.MinDistancePct < 0 || distance < risk.MinDistancePct {
+			risk.MinDistancePct = distance
+		}
+	}
+
+	if account != nil {
+		maint, _ := strconv.ParseFloat(account.TotalMaintMargin, 64)
+		marginBalance, _ := strconv.ParseFloat(account.TotalMarginBalance, 64)
+		if marginBalance > 0 {
+			risk.MarginRatio = maint / marginBalance * 100
+		}
+	}
+
+	stages := []struct {
+		stage       GuardStage
+		distancePct float64
+		marginRatio float64
+	}{
+		{GuardStageFlatten, cfg.FlattenDistancePct, cfg.FlattenMarginRatio},
+		{GuardStageReduce, cfg.ReduceDistancePct, cfg.ReduceMarginRatio},
+		{GuardStageAlert, cfg.AlertDistancePct, cfg.AlertMarginRatio},
+	}
+	for _, st := range stages {
+		if st.distancePct > 0 && risk.MinDistancePct >= 0 && risk.MinDistancePct < st.distancePct {
+			risk.Stage = st.stage
+			risk.Reason = fmt.Sprintf("强平距离%.2f%%低于%.2f%%", risk.MinDistancePct, st.distancePct)
+			return risk
+		}
+		if st.marginRatio > 0 && risk.MarginRatio > st.marginRatio {
+			risk.Stage = st.stage
+			risk.Reason = fmt.Sprintf("保证金率%.2f%%高于%.2f%%", risk.MarginRatio, st.marginRatio)
+			return risk
+		}
+	}
+	return risk
+}
+
+// GetLiquidationRisk 获取最近一次强平监控的评估结果
+func GetLiquidationRisk() *LiquidationRisk {
+	guardMutex.Lock()
+	defer guardMutex.Unlock()
+	return guardLastRisk
+}
+
+// StartLiquidationGuard 启动强平监控，独立于LLM交易周期运行
+func StartLiquidationGuard(ctx context.Context) {
+	cfg := conf.Get().Risk.Liquidation
+	if !cfg.Enable {
+		return
+	}
+	interval := time.Duration(cfg.IntervalSec) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	logger.Infof(ctx, "[强平监控] 启动，检查间隔: %v", interval)
+
+	go func() {
+		for {
+			runLiquidationGuard(ctx, cfg)
+			select {
+			case <-ctx.Done():
+				logger.Infof(ctx, "[强平监控] 已停止")
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// runLiquidationGuard 执行一次强平监控检查
+func runLiquidationGuard(ctx context.Context, cfg conf.LiquidationGuardConf) {
+	// 风控操作不随程序退出信号取消，保留上下文中的日志字段并单独设置超时
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	client := binance.GetOnceFuturesClient()
+	positions, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		logger.Errorf(ctx, "[强平监控] 获取持仓失败: %v", err)
+		return
+	}
+	if !HasRealPosition(positions) {
+		guardMutex.Lock()
+		guardLastRisk = &LiquidationRisk{MinDistancePct: -1}
+		guardLastStage = GuardStageNone
+		guardLastReduce = map[binance.PositionSide]time.Time{}
+		guardMutex.Unlock()
+		return
+	}
+	account, err := client.GetAccountInfo(ctx)
+	if err != nil {
+		logger.Errorf(ctx, "[强平监控] 获取账户信息失败: %v", err)
+	}
+
+	risk := EvaluateLiquidationRisk(positions, account, cfg)
+	guardMutex.Lock()
+	guardLastRisk = risk
+	changed := risk.Stage != guardLastStage
+	guardLastStage = risk.Stage
+	guardMutex.Unlock()
+	if risk.Stage == GuardStageNone {
+		return
+	}
+
+	// 级别不变时不重复记录风控事件和告警
+	if changed {
+		logger.Warnf(ctx, "[强平监控] 触发%s: %s", risk.Stage, risk.Reason)
+		RecordRiskEvent(ctx, RiskEventLiquidation, fmt.Sprintf("%s: %s", risk.Stage, risk.Reason))
+		notifyGuardStage(ctx, risk, cfg)
+	} else {
+		logger.Debugf(ctx, "[强平监控] 仍处于%s: %s", risk.Stage, risk.Reason)
+	}
+
+	if risk.Stage != GuardStageReduce && risk.Stage != GuardStageFlatten {
+		return
+	}
+	// 减仓和清仓与交易周期、手动操作、紧急停止互斥，持锁后重新读取持仓，避免按过期持仓下单
+	tradingMutex.Lock()
+	defer tradingMutex.Unlock()
+	positions, err = client.GetPositions(ctx, binance.ETHUSDT_PERP)
+	if err != nil {
+		logger.Errorf(ctx, "[强平监控] 获取持仓失败: %v", err)
+		return
+	}
+	if !HasRealPosition(positions) {
+		logger.Infof(ctx, "[强平监控] 持仓已平，取消%s", risk.Stage)
+		return
+	}
+
+	dualSide, err := client.GetPositionMode(ctx)
+	if err != nil {
+		logger.Warnf(ctx, "[强平监控] 获取持仓模式失败，按单向模式继续: %v", err)
+		dualSide = false
+	}
+
+	switch risk.Stage {
+	case GuardStageReduce:
+		percent := cfg.ReducePercent
+		if percent <= 0 || percent > 100 {
+			percent = 30
+		}
+		cooldown := time.Duration(cfg.ReduceCooldownSec) * time.Second
+		if cooldown <= 0 {
+			cooldown = 5 * time.Minute
+		}
+		for _, pos := range positions {
+			amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+			qty := math.Floor(math.Abs(amt)*percent/100*1000) / 1000
+			if qty < 0.001 {
+				continue
+			}
+			// 逐仓减仓后强平距离不会改善，冷却期内不再减仓，避免连续减仓变成清仓
+			guardMutex.Lock()
+			last := guardLastReduce[pos.PositionSide]
+			guardMutex.Unlock()
+			if time.Since(last) < cooldown {
+				logger.Debugf(ctx, "[强平监控] %s 距上次减仓不足%v，跳过", pos.PositionSide, cooldown)
+				continue
+			}
+			if err := reducePositionMarket(ctx, client, pos, qty, dualSide); err != nil {
+				logger.Errorf(ctx, "[强平监控] %s 减仓失败: %v", pos.PositionSide, err)
+				continue
+			}
+			guardMutex.Lock()
+			guardLastReduce[pos.PositionSide] = time.Now()
+			guardMutex.Unlock()
+			logger.Warnf(ctx, "[强平监控] %s 减仓%.0f%%，数量: %s", pos.PositionSide, percent, toQuantityString(qty))
+		}
+	case GuardStageFlatten:
+		if err := flattenPositions(ctx, client, positions, dualSide); err != nil {
+			logger.Errorf(ctx, "[强平监控] 清仓失败: %v", err)
+			return
+		}
+		logger.Warnf(ctx, "[强平监控] 已清仓全部持仓")
+	}
+}
+
+// notifyGuardStage 发送强平监控告警，同级别按冷却时间去重
+func notifyGuardStage(ctx context.Context, risk *LiquidationRisk, cfg conf.LiquidationGuardConf) {
+	cooldown := time.Duration(cfg.AlertCooldownSec) * time.Second
+	guardMutex.Lock()
+	last := guardLastAlert[risk.Stage]
+	if risk.Stage == GuardStageAlert && time.Since(last) < cooldown {
+		guardMutex.Unlock()
+		return
+	}
+	guardLastAlert[risk.Stage] = time.Now()
+	guardMutex.Unlock()
+
+	text := fmt.Sprintf("级别: %s\n原因: %s\n最近强平距离: %.2f%%\n保证金率: %.2f%%",
+		risk.Stage, risk.Reason, risk.MinDistancePct, risk.MarginRatio)
+	notify.Notify(ctx, notify.Message{Event: notify.EventBreaker, Title: "DeepTrade强平监控", Text: text})
+}
+
+// reducePositionMarket 以市价只减仓方式减少指定持仓
+func reducePositionMarket(ctx context.Context, client *binance.FuturesClient, pos binance.Position, qty float64, dualSide bool) error {
+	amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+	if amt == 0 || qty <= 0 {
+		return nil
+	}
+
+	side := binance.OrderSideSell
+	if pos.PositionSide == binance.PositionSideShort || (pos.PositionSide != binance.PositionSideLong && amt < 0) {
+		side = binance.OrderSideBuy
+	}
+
+	order := &binance.NewOrderRequest{
+		Symbol:   binance.Symbol(pos.Symbol),
+		Side:     side,
+		Type:     binance.OrderTypeMarket,
+		Quantity: toQuantityString(qty),
+		// 双向持仓模式下不能传reduceOnly，由positionSide保证只减仓
+		ReduceOnly: !dualSide,
+	}
+	var positionSide binance.PositionSide
+	if dualSide {
+		positionSide = pos.PositionSide
+	}
+	_, err := client.NewOrder(ctx, order, positionSide)
+	return err
+}
+
+// flattenPositions 取消止盈止损委托并市价平掉全部持仓
+func flattenPositions(ctx context.Context, client *binance.FuturesClient, positions []binance.Position, dualSide bool) error {
+	var errs []string
+	for _, pos := range positions {
+		amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+		if amt == 0 {
+			continue
+		}
+		if err := reducePositionMarket(ctx, client, pos, math.Abs(amt), dualSide); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", pos.PositionSide, err))
+			continue
+		}
+		if err := cancelStopLossAndTakeProfitOrders(ctx, client, binance.Symbol(pos.Symbol), dualSide, pos.PositionSide); err != nil {
+			logger.Errorf(ctx, "[风控] 平仓后删除止盈止损委托失败: %v", err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("平仓失败: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package task_test
+
+import (
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/task"
+	"testing"
+)
+
+func TestEvaluateLiquidationRisk(t *testing.T) {
+	cfg := conf.LiquidationGuardConf{
+		AlertDistancePct:   8,
+		ReduceDistancePct:  5,
+		FlattenDistancePct: 3,
+		AlertMarginRatio:   50,
+		ReduceMarginRatio:  70,
+		FlattenMarginRatio: 85,
+	}
+	account := &binance.FuturesAccountInfo{TotalMaintMargin: "10", TotalMarginBalance: "100"}
+
+	cases := []struct {
+		liq   string
+		maint string
+		want  task.GuardStage
+	}{
+		{"1000", "10", task.GuardStageNone},
+		{"1850", "10", task.GuardStageAlert},
+		{"1920", "10", task.GuardStageReduce},
+		{"1960", "10", task.GuardStageFlatten},
+		{"1000", "75", task.GuardStageReduce},
+		{"0", "90", task.GuardStageFlatten},
+	}
+	for _, c := range cases {
+		positions := []binance.Position{{PositionAmt: "1", MarkPrice: "2000", LiquidationPrice: c.liq, PositionSide: binance.PositionSideLong}}
+		account.TotalMaintMargin = c.maint
+		risk := task.EvaluateLiquidationRisk(positions, account, cfg)
+		if risk.Stage != c.want {
+			t.Errorf("liq=%s maint=%s: got %s, want %s (%s)", c.liq, c.maint, risk.Stage, c.want, risk.Reason)
+		}
+	}
+}
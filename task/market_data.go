@@ -1,25 +1,26 @@
 package task
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"deeptrade/binance"
+	"deeptrade/logger"
 	tradeflow "deeptrade/task/trade_flow"
 )
 
 // GetMarketData 获取完整的市场数据
-func GetMarketData() (*MarketData, error) {
-	log.Println("[市场数据] 开始获取完整市场数据...")
+func GetMarketData(ctx context.Context) (*MarketData, error) {
+	logger.Infof(ctx, "[市场数据] 开始获取完整市场数据...")
 
 	// 获取期货客户端
 	client, err := binance.GetFuturesClient()
 	if err != nil {
-		log.Printf("[市场数据] 创建期货客户端失败: %v", err)
+		logger.Errorf(ctx, "[市场数据] 创建期货客户端失败: %v", err)
 		return nil, err
 	}
 
@@ -47,7 +48,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		t, err := client.Get24hrTicker(symbol)
+		t, err := client.Get24hrTicker(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取价格统计失败: %v", err))
@@ -63,7 +64,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		klines, err := client.GetKlines(symbol, binance.KlineInterval3m, 71)
+		klines, err := client.GetKlines(ctx, symbol, binance.KlineInterval3m, 71)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取3分钟K线失败: %v", err))
@@ -79,7 +80,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		depth, err := client.GetDepth(symbol, binance.DepthLevel20)
+		depth, err := client.GetDepth(ctx, symbol, binance.DepthLevel20)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取订单簿失败: %v", err))
@@ -95,7 +96,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		pos, err := client.GetPositions(symbol)
+		pos, err := client.GetPositions(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取持仓信息失败: %v", err))
@@ -111,7 +112,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		acc, err := client.GetAccountInfo()
+		acc, err := client.GetAccountInfo(ctx)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取账户信息失败: %v", err))
@@ -127,7 +128,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		mp, err := client.GetMarkPrice(symbol)
+		mp, err := client.GetMarkPrice(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取标记价格失败: %v", err))
@@ -143,7 +144,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		fr, err := client.GetLatestFundingRate(symbol)
+		fr, err := client.GetLatestFundingRate(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取资金费率失败: %v", err))
@@ -159,7 +160,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		frs, err := client.GetFundingRateHistory(symbol, 6, 0, 0)
+		frs, err := client.GetFundingRateHistory(ctx, symbol, 6, 0, 0)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取资金费率历史失败: %v", err))
@@ -175,7 +176,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		oi, err := client.GetOpenInterest(symbol)
+		oi, err := client.GetOpenInterest(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取持仓量失败: %v", err))
@@ -191,14 +192,14 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		tradeflow.FetchRecentTrade()
+		tradeflow.FetchRecentTrade(ctx)
 	}()
 
 	// 获取历史订单数据（最近15个订单）
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		orders, err := client.GetOrderHistory(symbol, 15, 0, 0, 0) // 不限制时间范围，获取最新15个订单
+		orders, err := client.GetOrderHistory(ctx, symbol, 15, 0, 0, 0) // 不限制时间范围，获取最新15个订单
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取历史订单失败: %v", err))
@@ -214,7 +215,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		bt, err := client.GetBookTicker(symbol)
+		bt, err := client.GetBookTicker(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取最优挂单失败: %v", err))
@@ -230,7 +231,7 @@ func GetMarketData() (*MarketData, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		orders, err := client.GetOpenOrders(symbol)
+		orders, err := client.GetOpenOrders(ctx, symbol)
 		if err != nil {
 			mu.Lock()
 			errs = append(errs, fmt.Errorf("获取当前挂单失败: %v", err))
@@ -246,7 +247,7 @@ func GetMarketData() (*MarketData, error) {
 
 	// 检查是否有错误
 	if len(errs) > 0 {
-		log.Printf("[市场数据] 获取市场数据时发生错误: %v", errs)
+		logger.Errorf(ctx, "[市场数据] 获取市场数据时发生错误: %v", errs)
 	}
 
 	data := &MarketData{
@@ -266,7 +267,7 @@ func GetMarketData() (*MarketData, error) {
 		PositionInfo:        GetPositionInfo(positions),
 	}
 
-	log.Printf("[市场数据] 获取完成 - 当前价格: %s, 标记价格: %s", ticker.LastPrice, markPrice.MarkPrice)
+	logger.Infof(ctx, "[市场数据] 获取完成 - 当前价格: %s, 标记价格: %s", ticker.LastPrice, markPrice.MarkPrice)
 	return data, nil
 }
 
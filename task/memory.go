@@ -1,11 +1,304 @@
 package task
 
-var memory string
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-func SetMemory(in string) {
-	memory = in
+	"deeptrade/conf"
+	"deeptrade/logger"
+)
+
+// 记忆类型
+const (
+	MemoryThesis       = "thesis"       // 交易论点
+	MemoryLevel        = "level"        // 关键价位
+	MemoryInvalidation = "invalidation" // 失效条件
+	MemoryRationale    = "rationale"    // 持仓理由
+	MemoryNote         = "note"         // 其他
+)
+
+// memoryTypes 记忆类型，按渲染顺序排列
+var memoryTypes = []string{MemoryThesis, MemoryLevel, MemoryInvalidation, MemoryRationale, MemoryNote}
+
+var memoryTypeNames = map[string]string{
+	MemoryThesis:       "交易论点",
+	MemoryLevel:        "关键价位",
+	MemoryInvalidation: "失效条件",
+	MemoryRationale:    "持仓理由",
+	MemoryNote:         "其他",
+}
+
+const memoryFile = "memory.json"
+
+// MemoryEntry 一条记忆
+type MemoryEntry struct {
+	Type      string    `json:"type"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // 零值表示不过期
+}
+
+// Expired 记忆是否已过期
+func (e MemoryEntry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// MemoryUpdate 模型输出的一条记忆
+type MemoryUpdate struct {
+	Type     string  `json:"type"`
+	Key      string  `json:"key"`
+	Value    string  `json:"value"`
+	TTLHours float64 `json:"ttl_hours,omitempty"` // 有效期(小时)，0表示使用默认有效期
+}
+
+// MemoryUpdates 模型输出的全部记忆，为nil时表示本轮不修改记忆
+type MemoryUpdates []MemoryUpdate
+
+// UnmarshalJSON 兼容旧格式 key1:value1|key2:value2，旧格式的记忆归为其他类型，空字符串视为不修改记忆
+func (m *MemoryUpdates) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if strings.TrimSpace(text) == "" {
+			*m = nil
+			return nil
+		}
+		updates := MemoryUpdates{}
+		for _, part := range strings.Split(text, "|") {
+			key, value, ok := strings.Cut(part, ":")
+			if !ok || strings.TrimSpace(key) == "" {
+				continue
+			}
+			updates = append(updates, MemoryUpdate{Type: MemoryNote, Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+		}
+		*m = updates
+		return nil
+	}
+	var list []MemoryUpdate
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("解析memory失败: %v", err)
+	}
+	*m = append(MemoryUpdates{}, list...)
+	return nil
+}
+
+var (
+	memoryMutex   sync.Mutex
+	memoryLoaded  bool
+	memoryEntries []MemoryEntry
+)
+
+// loadMemory 首次使用时从数据目录加载记忆，调用方需持有 memoryMutex
+func loadMemory(ctx context.Context) {
+	if memoryLoaded {
+		return
+	}
+	memoryLoaded = true
+	data, err := os.ReadFile(conf.Get().Storage.Path(memoryFile))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &memoryEntries); err != nil {
+		logger.Errorf(ctx, "[记忆] 解析记忆文件失败: %v", err)
+	}
+}
+
+// GetMemoryEntries 获取当前未过期的记忆
+func GetMemoryEntries(ctx context.Context) []MemoryEntry {
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	loadMemory(ctx)
+	now := time.Now()
+	var entries []MemoryEntry
+	for _, e := range memoryEntries {
+		if !e.Expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// GetMemory 渲染当前记忆供提示词使用
+func GetMemory(ctx context.Context) string {
+	return RenderMemory(GetMemoryEntries(ctx), time.Now())
+}
+
+// RenderMemory 按类型分组渲染记忆，附带更新时间和剩余有效期
+func RenderMemory(entries []MemoryEntry, now time.Time) string {
+	if len(entries) == 0 {
+		return "无"
+	}
+	var b strings.Builder
+	for _, typ := range memoryTypes {
+		for _, e := range entries {
+			if e.Type != typ || e.Expired(now) {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("- [%s] %s: %s (更新于%s", memoryTypeNames[typ], e.Key, e.Value, e.UpdatedAt.Format("01-02 15:04")))
+			if !e.ExpiresAt.IsZero() {
+				b.WriteString(fmt.Sprintf("，剩余%.1f小时", e.ExpiresAt.Sub(now).Hours()))
+			}
+			b.WriteString(")\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// UpdateMemory 用本轮信号中的记忆替换当前记忆并持久化，positionOpen 为本轮交易后是否仍有持仓
+func UpdateMemory(ctx context.Context, signal *TradingSignal, positionOpen bool) {
+	if signal.Memory == nil {
+		return
+	}
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	loadMemory(ctx)
+
+	now := time.Now()
+	entries, kept := MergeMemory(memoryEntries, signal.Memory, positionOpen, now, conf.Get().Memory)
+	if len(kept) > 0 {
+		logger.Infof(ctx, "[记忆] 持仓期间模型遗漏了受保护的记忆，已保留: %s", strings.Join(kept, ", "))
+	}
+	// 开仓时模型未给出持仓理由，使用决策理由代替
+	if positionOpen && strings.HasPrefix(signal.Action, "OPEN_") && !hasMemoryType(entries, MemoryRationale) {
+		entries = append(entries, MemoryEntry{Type: MemoryRationale, Key: "entry", Value: signal.Reasoning, CreatedAt: now, UpdatedAt: now})
+		logger.Infof(ctx, "[记忆] 开仓未记录持仓理由，使用决策理由")
+	}
+	memoryEntries = entries
+
+	data, err := json.MarshalIndent(memoryEntries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(conf.Get().Storage.Path(memoryFile), data, 0644); err != nil {
+		logger.Errorf(ctx, "[记忆] 保存记忆失败: %v", err)
+	}
+}
+
+// MergeMemory 用模型输出替换当前记忆，返回新的记忆和因保护而保留的记忆键：
+// 内容未变的记忆保留创建和更新时间，有效期从本次确认起重新计算；持仓期间受保护类型的记忆不过期，
+// 模型遗漏时继续保留；无持仓时删除持仓理由
+func MergeMemory(current []MemoryEntry, updates MemoryUpdates, positionOpen bool, now time.Time, cfg conf.MemoryConf) ([]MemoryEntry, []string) {
+	existing := map[string]MemoryEntry{}
+	for _, e := range current {
+		if !e.Expired(now) || positionOpen && isProtectedMemory(e.Type, cfg) {
+			existing[e.Type+"|"+e.Key] = e
+		}
+	}
+
+	merged := map[string]MemoryEntry{}
+	for _, u := range updates {
+		u.Key, u.Value = strings.TrimSpace(u.Key), strings.TrimSpace(u.Value)
+		if u.Key == "" || u.Value == "" {
+			continue
+		}
+		if _, ok := memoryTypeNames[u.Type]; !ok {
+			u.Type = MemoryNote
+		}
+		if u.Type == MemoryRationale && !positionOpen {
+			continue
+		}
+		id := u.Type + "|" + u.Key
+		entry := MemoryEntry{Type: u.Type, Key: u.Key, Value: u.Value, CreatedAt: now, UpdatedAt: now}
+		old, ok := existing[id]
+		if ok {
+			entry.CreatedAt = old.CreatedAt
+		}
+		if ok && old.Value == u.Value {
+			entry.UpdatedAt = old.UpdatedAt
+		}
+		switch {
+		case u.TTLHours > 0:
+			entry.ExpiresAt = now.Add(time.Duration(u.TTLHours * float64(time.Hour)))
+		case cfg.DefaultTTLHours > 0:
+			entry.ExpiresAt = now.Add(time.Duration(cfg.DefaultTTLHours * float64(time.Hour)))
+		}
+		merged[id] = entry
+	}
+
+	var kept []string
+	if positionOpen {
+		for id, e := range existing {
+			if _, ok := merged[id]; !ok && isProtectedMemory(e.Type, cfg) {
+				merged[id] = e
+				kept = append(kept, e.Key)
+			}
+		}
+	}
+	sort.Strings(kept)
+
+	entries := make([]MemoryEntry, 0, len(merged))
+	for _, e := range merged {
+		if positionOpen && isProtectedMemory(e.Type, cfg) {
+			e.ExpiresAt = time.Time{}
+		}
+		entries = append(entries, e)
+	}
+	// 超出条数上限时优先删除最早更新的非保护记忆
+	if cfg.MaxEntries > 0 && len(entries) > cfg.MaxEntries {
+		sort.SliceStable(entries, func(i, j int) bool {
+			pi, pj := isProtectedMemory(entries[i].Type, cfg), isProtectedMemory(entries[j].Type, cfg)
+			if pi != pj {
+				return pi
+			}
+			return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+		})
+		entries = entries[:cfg.MaxEntries]
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ti, tj := memoryTypeIndex(entries[i].Type), memoryTypeIndex(entries[j].Type)
+		if ti != tj {
+			return ti < tj
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, kept
+}
+
+// isProtectedMemory 是否为持仓期间受保护的记忆类型
+func isProtectedMemory(typ string, cfg conf.MemoryConf) bool {
+	for _, t := range cfg.ProtectedTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMemoryType(entries []MemoryEntry, typ string) bool {
+	for _, e := range entries {
+		if e.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func memoryTypeIndex(typ string) int {
+	for i, t := range memoryTypes {
+		if t == typ {
+			return i
+		}
+	}
+	return len(memoryTypes)
 }
 
-func GetMemory() string {
-	return memory
+// positionOpenAfter 执行信号后是否仍有持仓
+func positionOpenAfter(signal *TradingSignal, info *PositionInfo) bool {
+	switch {
+	case strings.HasPrefix(signal.Action, "OPEN_"), strings.HasPrefix(signal.Action, "ADD_"):
+		return true
+	case strings.HasPrefix(signal.Action, "CLOSE_"):
+		return false
+	}
+	return info != nil && (info.HasLong || info.HasShort)
 }
@@ -0,0 +1,94 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/task"
+)
+
+func TestMemoryUpdatesLegacy(t *testing.T) {
+	signal, err := task.ParseLLMResponse(`{"action":"HOLD","memory":"trend:up|support:3000"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signal.Memory) != 2 || signal.Memory[1].Key != "support" || signal.Memory[1].Type != task.MemoryNote {
+		t.Errorf("旧格式记忆解析错误: %+v", signal.Memory)
+	}
+	signal, _ = task.ParseLLMResponse(`{"action":"HOLD"}`)
+	if signal.Memory != nil {
+		t.Error("未返回memory时不应修改记忆")
+	}
+}
+
+func TestMergeMemory(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	cfg := conf.MemoryConf{DefaultTTLHours: 24, ProtectedTypes: []string{task.MemoryThesis, task.MemoryRationale}}
+	current := []task.MemoryEntry{
+		{Type: task.MemoryThesis, Key: "trend", Value: "上升", CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Hour)},
+		{Type: task.MemoryRationale, Key: "entry", Value: "突破", CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Hour)},
+		{Type: task.MemoryLevel, Key: "support", Value: "3000", UpdatedAt: now.Add(-time.Hour)},
+		{Type: task.MemoryNote, Key: "old", Value: "x", ExpiresAt: now.Add(-time.Minute)},
+	}
+	updates := task.MemoryUpdates{{Type: task.MemoryLevel, Key: "resistance", Value: "3200", TTLHours: 2}}
+
+	// 持仓期间遗漏的受保护记忆继续保留
+	entries, kept := task.MergeMemory(current, updates, true, now, cfg)
+	if len(entries) != 3 || strings.Join(kept, ",") != "entry,trend" {
+		t.Fatalf("持仓期间保护失败: %+v %v", entries, kept)
+	}
+	if entries[0].Key != "trend" || entries[1].Key != "resistance" || !entries[1].ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("记忆排序或有效期错误: %+v", entries)
+	}
+
+	// 无持仓时按模型输出替换，并删除持仓理由
+	updates = append(updates, task.MemoryUpdate{Type: task.MemoryRationale, Key: "entry", Value: "突破"}, task.MemoryUpdate{Type: task.MemoryThesis, Key: "trend", Value: "上升"})
+	entries, kept = task.MergeMemory(current, updates, false, now, cfg)
+	if len(entries) != 2 || len(kept) != 0 {
+		t.Fatalf("无持仓时替换错误: %+v %v", entries, kept)
+	}
+	if !entries[0].CreatedAt.Equal(now.Add(-time.Hour)) || !entries[0].UpdatedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("内容未变的记忆应保留时间: %+v", entries[0])
+	}
+
+	text := task.RenderMemory(entries, now)
+	if !strings.Contains(text, "[交易论点] trend: 上升") || !strings.Contains(text, "剩余2.0小时") {
+		t.Errorf("渲染错误:\n%s", text)
+	}
+}
+
+func TestMergeMemoryExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	cfg := conf.MemoryConf{DefaultTTLHours: 24, ProtectedTypes: []string{task.MemoryThesis, task.MemoryInvalidation}}
+	current := []task.MemoryEntry{
+		{Type: task.MemoryThesis, Key: "trend", Value: "上升", UpdatedAt: now.Add(-30 * time.Hour), ExpiresAt: now.Add(-6 * time.Hour)},
+		{Type: task.MemoryLevel, Key: "support", Value: "3000", UpdatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+	}
+
+	// 持仓期间受保护的记忆已过期也继续保留，且不再过期
+	entries, kept := task.MergeMemory(current, task.MemoryUpdates{}, true, now, cfg)
+	if len(entries) != 1 || entries[0].Key != "trend" || !entries[0].ExpiresAt.IsZero() || strings.Join(kept, ",") != "trend" {
+		t.Fatalf("持仓期间过期的受保护记忆应保留: %+v %v", entries, kept)
+	}
+
+	// 重新确认的记忆从本次起重新计算有效期
+	updates := task.MemoryUpdates{{Type: task.MemoryLevel, Key: "support", Value: "3000"}}
+	entries, _ = task.MergeMemory(current, updates, false, now, cfg)
+	if len(entries) != 1 || !entries[0].ExpiresAt.Equal(now.Add(24*time.Hour)) || !entries[0].UpdatedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("重新确认应延长有效期: %+v", entries)
+	}
+
+	// 无持仓时过期的记忆删除
+	entries, _ = task.MergeMemory(current, task.MemoryUpdates{}, false, now, cfg)
+	if len(entries) != 0 {
+		t.Errorf("无持仓时过期记忆应删除: %+v", entries)
+	}
+
+	// 旧格式空字符串不修改记忆
+	signal, err := task.ParseLLMResponse(`{"action":"HOLD","memory":""}`)
+	if err != nil || signal.Memory != nil {
+		t.Errorf("空字符串不应修改记忆: %+v %v", signal, err)
+	}
+}
@@ -0,0 +1,149 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/notify"
+	"deeptrade/utils"
+)
+
+var (
+	// stopFillNotifiedAt 已通知的止盈止损成交的最新更新时间(毫秒)，启动前的成交不通知
+	stopFillNotifiedAt = time.Now().UnixMilli()
+	stopFillMutex      sync.Mutex
+)
+
+// notifyTrade 交易执行成功后发送开仓、加仓或平仓通知
+func notifyTrade(ctx context.Context, signal *TradingSignal, marketData *MarketData) {
+	var event notify.Event
+	switch {
+	case isOpenOrAddAction(signal.Action):
+		event = notify.EventOpen
+	case isCloseAction(signal.Action):
+		event = notify.EventClose
+	default:
+		return
+	}
+	var price float64
+	if marketData.Ticker != nil {
+		price = utils.ParseFloatSafe(marketData.Ticker.LastPrice, 0)
+	}
+	text := fmt.Sprintf("价格: %.2f\n置信度: %.0f%%", price, signal.Confidence*100)
+	if event == notify.EventOpen {
+		text += fmt.Sprintf("\n仓位: %d\n止损: %.2f\n止盈: %.2f", signal.PositionSize, signal.StopLoss, signal.TakeProfit)
+	}
+	text += "\n理由: " + truncateText(signal.Reasoning, 500)
+	notify.Notify(ctx, notify.Message{Event: event, Title: "DeepTrade " + signal.Action, Text: text})
+}
+
+// notifyStopFills 通知上次检查以来成交的止盈止损单
+func notifyStopFills(ctx context.Context, orders []binance.Order) {
+	stopFillMutex.Lock()
+	msgs, latest := StopFillMessages(orders, stopFillNotifiedAt)
+	stopFillNotifiedAt = latest
+	stopFillMutex.Unlock()
+	for _, msg := range msgs {
+		logger.Infof(ctx, "[通知] %s", strings.ReplaceAll(msg.Title+" "+msg.Text, "\n", ", "))
+		notify.Notify(ctx, msg)
+	}
+}
+
+// StopFillMessages 更新时间晚于 after 的已成交止损单和止盈单的通知，返回最新的更新时间
+func StopFillMessages(orders []binance.Order, after int64) ([]notify.Message, int64) {
+	var msgs []notify.Message
+	latest := after
+	for _, o := range orders {
+		if o.Status != binance.OrderStatusFilled || o.UpdateTime <= after {
+			continue
+		}
+		typ := o.OrigType
+		if typ == "" {
+			typ = o.Type
+		}
+		var event notify.Event
+		var title string
+		switch typ {
+		case binance.OrderTypeStopMarket, binance.OrderTypeStop:
+			event, title = notify.EventStopLoss, "DeepTrade止损触发"
+		case binance.OrderTypeTakeProfitMarket, binance.OrderTypeTakeProfit:
+			event, title = notify.EventClose, "DeepTrade止盈触发"
+		default:
+			continue
+		}
+		msgs = append(msgs, notify.Message{
+			Event: event,
+			Title: title,
+			Text: fmt.Sprintf("方向: %s %s\n触发价: %s\n成交数量: %s\n时间: %s", o.Side, o.PositionSide, o.StopPrice, o.ExecutedQty,
+				time.UnixMilli(o.UpdateTime).Format("2006-01-02 15:04:05")),
+			Key: fmt.Sprint(o.OrderID),
+		})
+		if o.UpdateTime > latest {
+			latest = o.UpdateTime
+		}
+	}
+	return msgs, latest
+}
+
+// StartDailySummary 每天在 [notify] daily_summary_time 发送最近24小时的交易汇总
+func StartDailySummary(ctx context.Context) {
+	at := conf.Get().Notify.DailySummaryTime
+	if at == "" {
+		return
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		logger.Errorf(ctx, "[通知] 每日汇总时间格式错误(%s)，需为 HH:MM", at)
+		return
+	}
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			sendDailySummary(ctx, next)
+		}
+	}()
+}
+
+// sendDailySummary 生成最近24小时的报告并发送每日汇总
+func sendDailySummary(ctx context.Context, until time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	r, err := BuildReport(ctx, until.Add(-24*time.Hour), until)
+	if err != nil {
+		logger.Errorf(ctx, "[通知] 生成每日汇总失败: %v", err)
+		return
+	}
+	html, err := r.Render(ReportHTML)
+	if err != nil {
+		logger.Errorf(ctx, "[通知] 生成每日汇总失败: %v", err)
+		return
+	}
+	notify.Notify(ctx, notify.Message{
+		Event: notify.EventDailySummary,
+		Title: "DeepTrade每日汇总 " + until.Format("2006-01-02"),
+		Text:  dailySummaryText(r),
+		HTML:  html,
+	})
+}
+
+// dailySummaryText 每日汇总的纯文本正文
+func dailySummaryText(r *Report) string {
+	a := r.Analytics
+	return fmt.Sprintf("净盈亏: %.2f USDT (%.2f%%)\n完整交易: %d笔，胜率 %.1f%%\n最大回撤: %.2f%%\n手续费: %.2f，资金费用: %.2f\n模型费用: %.4f %s\n风控事件: %d次",
+		a.NetPnl, a.ReturnPct, a.Trades, a.WinRate, a.MaxDrawdown, a.Commission, a.Funding, r.LLMCost, r.Currency, len(r.RiskEvents))
+}
@@ -0,0 +1,29 @@
+package task_test
+
+import (
+	"testing"
+
+	"deeptrade/binance"
+	"deeptrade/notify"
+	"deeptrade/task"
+)
+
+func TestStopFillMessages(t *testing.T) {
+	orders := []binance.Order{
+		{OrderID: 1, Status: binance.OrderStatusFilled, OrigType: binance.OrderTypeStopMarket, UpdateTime: 900},
+		{OrderID: 2, Status: binance.OrderStatusFilled, OrigType: binance.OrderTypeStopMarket, UpdateTime: 1100, StopPrice: "2450"},
+		{OrderID: 3, Status: binance.OrderStatusFilled, OrigType: binance.OrderTypeTakeProfitMarket, UpdateTime: 1200},
+		{OrderID: 4, Status: binance.OrderStatusCanceled, OrigType: binance.OrderTypeStopMarket, UpdateTime: 1300},
+		{OrderID: 5, Status: binance.OrderStatusFilled, OrigType: binance.OrderTypeMarket, UpdateTime: 1400},
+	}
+	msgs, latest := task.StopFillMessages(orders, 1000)
+	if len(msgs) != 2 || latest != 1200 {
+		t.Fatalf("止盈止损成交识别错误: %+v latest=%d", msgs, latest)
+	}
+	if msgs[0].Event != notify.EventStopLoss || msgs[0].Key != "2" || msgs[1].Event != notify.EventClose {
+		t.Errorf("通知事件错误: %+v", msgs)
+	}
+	if msgs, _ := task.StopFillMessages(orders, latest); len(msgs) != 0 {
+		t.Errorf("已通知的成交不应重复通知: %+v", msgs)
+	}
+}
@@ -0,0 +1,201 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/calendar"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/prompt"
+	"deeptrade/store"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 决策流程角色
+const (
+	RoleAnalyst  = "analyst"  // 市场分析师
+	RoleRisk     = "risk"     // 风控经理
+	RoleDecision = "decision" // 交易决策
+)
+
+var roleNames = map[string]string{
+	RoleAnalyst:  "市场分析师",
+	RoleRisk:     "风控经理",
+	RoleDecision: "交易决策",
+}
+
+// pipelineState 决策流程中在各角色间传递的状态
+type pipelineState struct {
+	prompts     *prompt.Set
+	system      string          // 交易决策系统提示词
+	message     *schema.Message // 行情数据
+	marketData  *MarketData
+	hasPosition bool
+	opinions    []string // 前序角色的输出
+	record      *DecisionRecord
+	signal      *TradingSignal
+}
+
+// usePipeline 是否使用多角色决策流程
+func usePipeline() bool {
+	cfg := conf.Get().Pipeline
+	return cfg.Enable && len(cfg.Stages) > 0
+}
+
+// pipelineStages 获取决策流程的各阶段，最后一个阶段不是交易决策时补充默认的交易决策阶段
+func pipelineStages() []conf.PipelineStageConf {
+	stages := append([]conf.PipelineStageConf{}, conf.Get().Pipeline.Stages...)
+	if len(stages) == 0 || stages[len(stages)-1].Role != RoleDecision {
+		stages = append(stages, conf.PipelineStageConf{Role: RoleDecision})
+	}
+	return stages
+}
+
+// RunPipeline 按 分析 -> 风控 -> 决策 的顺序执行多角色决策流程
+func RunPipeline(ctx context.Context, prompts *prompt.Set, system string, message *schema.Message, marketData *MarketData, record *DecisionRecord) (*TradingSignal, error) {
+	chain := compose.NewChain[*pipelineState, *pipelineState]()
+	for _, stage := range pipelineStages() {
+		stage := stage
+		chain.AppendLambda(compose.InvokableLambda(func(ctx context.Context, st *pipelineState) (*pipelineState, error) {
+			return runPipelineStage(ctx, stage, st)
+		}), compose.WithNodeName(stage.Role))
+	}
+	runnable, err := chain.Compile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("构建决策流程失败: %v", err)
+	}
+
+	st, err := runnable.Invoke(ctx, &pipelineState{
+		prompts:     prompts,
+		system:      system,
+		message:     message,
+		marketData:  marketData,
+		hasPosition: marketData.PositionInfo.HasLong || marketData.PositionInfo.HasShort,
+		record:      record,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st.signal, nil
+}
+
+// runPipelineStage 执行一个角色，交易决策角色输出信号，其他角色的输出作为后续角色的输入
+func runPipelineStage(ctx context.Context, stage conf.PipelineStageConf, st *pipelineState) (*pipelineState, error) {
+	system, err := stagePrompt(stage, st)
+	if err != nil {
+		return nil, err
+	}
+
+	var input strings.Builder
+	if len(st.opinions) > 0 {
+		input.WriteString("\n## 前序角色意见\n")
+		input.WriteString(strings.Join(st.opinions, "\n\n"))
+		input.WriteString("\n")
+	}
+	if stage.Role == RoleRisk {
+		input.WriteString("\n## 风控限制\n")
+		input.WriteString(FormatRiskLimits(st.marketData))
+	}
+	userMsg := schema.UserMessage(st.message.Content + input.String())
+
+	var loop *utils.ToolLoop
+	if stage.UseTools {
+		loop = newAgentToolLoop()
+	}
+	var output *utils.StructuredOutput
+	if stage.Role == RoleDecision {
+		output = signalOutput
+	}
+	call := st.record.recordStage(stage.Role, input.String(), func(msgs []*schema.Message) (string, string, error) {
+		req := utils.Request{System: system, Messages: msgs, Output: output, Tools: loop}
+		if stage.Model == "" || utils.ModelOverride(st.hasPosition) != "" {
+			// 未指定模型或运行时指定了首选模型时使用角色的模型降级链
+			return utils.Generate(ctx, st.hasPosition, req)
+		}
+		llmconf, ok := conf.Get().GetLLMByModel(stage.Model)
+		if !ok {
+			return "", stage.Model, fmt.Errorf("模型%s未配置", stage.Model)
+		}
+		content, err := utils.GenerateModel(ctx, llmconf, req)
+		return content, llmconf.Model, err
+	})
+
+	name := roleNames[stage.Role]
+	if name == "" {
+		name = stage.Role
+	}
+	if stage.Role == RoleDecision {
+		signal, err := requestSignal(ctx, call, userMsg, st.marketData)
+		if err != nil {
+			return nil, fmt.Errorf("%s失败: %v", name, err)
+		}
+		st.signal = signal
+		return st, nil
+	}
+
+	startTime := time.Now()
+	opinion, err := call([]*schema.Message{userMsg})
+	if err != nil {
+		return nil, fmt.Errorf("%s失败: %v", name, err)
+	}
+	logger.Infof(ctx, "[决策流程] %s完成，耗时%v:\n%s", name, time.Since(startTime), opinion)
+	st.opinions = append(st.opinions, fmt.Sprintf("### %s\n%s", name, strings.TrimSpace(opinion)))
+	return st, nil
+}
+
+// stagePrompt 获取角色的系统提示词，配置了提示词文件时优先使用，否则使用模板中与角色同名的模板
+func stagePrompt(stage conf.PipelineStageConf, st *pipelineState) (string, error) {
+	if stage.PromptFile != "" {
+		data, err := os.ReadFile(stage.PromptFile)
+		if err != nil {
+			return "", fmt.Errorf("读取%s提示词失败: %v", stage.Role, err)
+		}
+		return string(data), nil
+	}
+	if stage.Role == RoleDecision {
+		return st.system, nil
+	}
+	if !st.prompts.Has(stage.Role) {
+		return "", fmt.Errorf("提示词版本%s没有角色%s的模板，请添加或配置 prompt_file", st.prompts.Version, stage.Role)
+	}
+	return st.prompts.Render(stage.Role, nil)
+}
+
+// FormatRiskLimits 格式化风控限制供风控角色审查
+func FormatRiskLimits(marketData *MarketData) string {
+	var b strings.Builder
+	cfg := conf.Get()
+	b.WriteString(fmt.Sprintf("- 单次开仓使用资金比例上限: %.0f%%\n", cfg.Trading.PositionPercent))
+	if mc, ok := cfg.GetMargin(string(binance.ETHUSDT_PERP)); ok {
+		b.WriteString(fmt.Sprintf("- 保证金模式: %s\n", mc.MarginType))
+	}
+	if lg := cfg.Risk.Liquidation; lg.Enable {
+		b.WriteString(fmt.Sprintf("- 强平距离低于%.1f%%时程序自动减仓%.0f%%，低于%.1f%%时自动清仓\n", lg.ReduceDistancePct, lg.ReducePercent, lg.FlattenDistancePct))
+	}
+	if ok, reason := calendar.GetOnceCalendar().CanOpenPosition(time.Now()); !ok {
+		b.WriteString(fmt.Sprintf("- 当前禁止开新仓: %s\n", reason))
+	} else {
+		b.WriteString("- 当前允许开新仓\n")
+	}
+	if db := store.GetOnceDB(); db != nil {
+		now := time.Now()
+		if pnl, err := db.NetPnlSince(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())); err == nil {
+			b.WriteString(fmt.Sprintf("- 今日已实现净盈亏(含手续费和资金费用): %.2f USDT\n", pnl))
+		}
+		if n, err := db.ConsecutiveLosses(); err == nil && n > 0 {
+			b.WriteString(fmt.Sprintf("- 最近连续亏损: %d笔\n", n))
+		}
+	}
+	if marketData != nil && len(marketData.OpenOrders) > 0 {
+		b.WriteString(fmt.Sprintf("- 当前挂单数量: %d\n", len(marketData.OpenOrders)))
+	}
+	return b.String()
+}
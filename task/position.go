@@ -1,14 +1,16 @@
 package task
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"deeptrade/binance"
+	"deeptrade/logger"
+	"deeptrade/utils"
 )
 
 // PositionWithTime 带时间戳的持仓记录
@@ -286,7 +288,7 @@ func formatOrderTime(orderTime int64) string {
 }
 
 // GetPositionsWithSLTP 获取包含止损止盈的持仓信息
-func GetPositionsWithSLTP() (string, error) {
+func GetPositionsWithSLTP(ctx context.Context) (string, error) {
 	// 获取期货客户端
 	client, err := binance.GetFuturesClient()
 	if err != nil {
@@ -296,13 +298,13 @@ func GetPositionsWithSLTP() (string, error) {
 	symbol := binance.ETHUSDT_PERP
 
 	// 获取持仓信息
-	positions, err := client.GetPositions(symbol)
+	positions, err := client.GetPositions(ctx, symbol)
 	if err != nil {
 		return "", fmt.Errorf("获取持仓信息失败: %v", err)
 	}
 
 	// 获取当前挂单信息
-	orders, err := client.GetOpenOrders(symbol)
+	orders, err := client.GetOpenOrders(ctx, symbol)
 	if err != nil {
 		return "", fmt.Errorf("获取挂单信息失败: %v", err)
 	}
@@ -311,6 +313,28 @@ func GetPositionsWithSLTP() (string, error) {
 	return FormatPositionWithSLTP(positions, orders), nil
 }
 
+// positionPnlPoints 持仓快照队列中晚于 since 的盈亏点，每个快照汇总有数量的持仓
+func positionPnlPoints(since time.Time) []PnlPoint {
+	positionQueueMutex.Lock()
+	defer positionQueueMutex.Unlock()
+	var points []PnlPoint
+	for _, c := range positionQueue {
+		var point PnlPoint
+		for _, p := range c.list {
+			if utils.ParseFloatSafe(p.PositionAmt, 0) == 0 {
+				continue
+			}
+			point.Time = p.recordTime
+			point.MarkPrice = utils.ParseFloatSafe(p.MarkPrice, 0)
+			point.UnrealizedPnl += utils.ParseFloatSafe(p.UnRealizedProfit, 0)
+		}
+		if point.Time.After(since) {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
 // GetPositionHistory 持仓历史
 func GetPositionHistory(pos binance.Position) (result []PositionWithTime) {
 	positionQueueMutex.Lock()
@@ -338,31 +362,52 @@ func CloseFetchPosition() {
 	positionQueue = []PositionCache{}
 }
 
-func StartFetchPosition() {
+// stopFetchPosition 停止指定的拉取任务，已被停止或替换时不处理
+func stopFetchPosition(stop chan struct{}) {
+	positionQueueMutex.Lock()
+	defer positionQueueMutex.Unlock()
+	if positionStopChan == stop {
+		close(stop)
+		positionStopChan = nil
+		positionQueue = []PositionCache{}
+	}
+}
+
+// StartFetchPosition 持仓期间定时拉取持仓信息，ctx 取消或平仓后退出
+func StartFetchPosition(ctx context.Context) {
 	positionQueueMutex.Lock()
 	if positionStopChan != nil {
 		positionQueueMutex.Unlock()
 		return //正在执行中
 	}
 	positionQueue = []PositionCache{}
-	positionStopChan = make(chan struct{})
+	stop := make(chan struct{})
+	positionStopChan = stop
 	positionQueueMutex.Unlock()
 	go func() {
 		for {
 			client := binance.GetOnceFuturesClient()
-			pos, err := client.GetPositions(binance.ETHUSDT_PERP)
+			pos, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
 			if err != nil {
-				log.Println(err)
+				logger.Errorf(ctx, "[持仓] 获取持仓失败: %v", err)
 			}
 			positionQueueMutex.Lock()
+			if positionStopChan != stop {
+				// 已被 CloseFetchPosition 停止，或已有新的拉取任务
+				positionQueueMutex.Unlock()
+				return
+			}
 			posinfo := GetPositionInfo(pos)
 			if !posinfo.HasLong && !posinfo.HasShort {
 				//如果获取的持仓没有数量，说明已经被止盈止损了
-				close(positionStopChan)
+				close(stop)
 				positionStopChan = nil
-				log.Println("[量化交易] 未获取到持仓盈亏,关闭拉取持仓信息")
+				logger.Infof(ctx, "[量化交易] 未获取到持仓盈亏,关闭拉取持仓信息")
 				positionQueueMutex.Unlock()
 				setOffSystem(posinfo)
+				if err == nil {
+					RecordPnlPoint(ctx, pos)
+				}
 				return
 			}
 
@@ -380,17 +425,24 @@ func StartFetchPosition() {
 				positionQueue = positionQueue[1:]
 			}
 			positionQueueMutex.Unlock()
+			// 盈亏路径取自持仓快照队列
+			RecordPnlPoint(ctx, pos)
 			side := "多头"
 			if posinfo.HasShort {
 				side = "空头"
 			}
-			log.Printf("[量化交易] 拉取持仓信息成功 方向 :%v 未实现盈亏: %v\n", side, posinfo.UnRealizedProfit)
+			logger.Infof(ctx, "[量化交易] 拉取持仓信息成功 方向 :%v 未实现盈亏: %v", side, posinfo.UnRealizedProfit)
+			CheckIsolatedMarginBuffer(ctx, pos)
 
 			// 使用select实现实时关闭功能
 			select {
-			case <-positionStopChan:
+			case <-stop:
 				// 收到停止信号，退出循环
-				log.Println("[量化交易] 关闭拉取持仓信息")
+				logger.Infof(ctx, "[量化交易] 关闭拉取持仓信息")
+				return
+			case <-ctx.Done():
+				stopFetchPosition(stop)
+				logger.Infof(ctx, "[量化交易] 程序退出，关闭拉取持仓信息")
 				return
 			case <-time.After(3 * time.Minute):
 				// 默认等待2分钟后继续执行
@@ -1,10 +1,17 @@
 package task
 
 import (
+	"context"
 	"deeptrade/binance"
+	"deeptrade/calendar"
 	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/metrics"
+	"deeptrade/notify"
 	"deeptrade/utils"
-	"log"
+	"fmt"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -34,11 +41,11 @@ func GetOffSystem() (vaule bool) {
 	return
 }
 
-func InitOffSystem() {
+func InitOffSystem(ctx context.Context) {
 	client := binance.GetOnceFuturesClient()
-	pos, err := client.GetPositions(binance.ETHUSDT_PERP)
+	pos, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
 	if err != nil {
-		log.Println(err)
+		logger.Errorf(ctx, "[系统] 获取持仓失败: %v", err)
 	}
 	posinfo := GetPositionInfo(pos)
 	setOffSystem(posinfo)
@@ -52,21 +59,9 @@ func GetSleepSec() (vaule int) {
 	return
 }
 
-var (
-	workHourList = []int{9, 10, 11, 12, 18, 19, 20, 21, 22, 23}
-)
-
-// IsWork 判断是否执行
+// IsWork 判断是否执行，交易时段由交易日历配置
 func IsWork() bool {
-	now := time.Now()
-	h := now.Hour()
-	weekday := now.Weekday()
-	if utils.InSlice(workHourList, h) && weekday > 0 && weekday < 6 {
-		//周一至周五 10-23点
-		return true
-	}
-	if utils.InSlice([]int{0, 1, 2, 3}, h) && weekday > 1 && weekday < 7 {
-		//周二至周六 0-2点
+	if calendar.GetOnceCalendar().InSession(time.Now()) {
 		return true
 	}
 
@@ -77,56 +72,141 @@ func IsWork() bool {
 }
 
 // RunQuantitativeTrading 运行量化交易主流程
-func RunQuantitativeTrading() error {
-	log.Println("========================================")
-	log.Println("[量化交易] 启动ETH期货量化交易系统")
-	log.Println("========================================")
+func RunQuantitativeTrading(ctx context.Context) error {
+	// 本轮的日志、请求和决策记录都带上同一个周期ID，便于按周期检索
+	ctx = logger.WithCycle(ctx, logger.NewCycleID())
+	logger.Infof(ctx, "========================================")
+	logger.Infof(ctx, "[量化交易] 启动ETH期货量化交易系统")
+	logger.Infof(ctx, "========================================")
+	start := time.Now()
+	defer func() { metrics.CycleDuration.Observe(time.Since(start).Seconds()) }()
+	BeginTriggerCycle()
+	defer EndTriggerCycle()
+
+	if IsHalted() {
+		logger.Warnf(ctx, "[量化交易] 系统处于紧急停止状态(%s)，跳过本轮交易", GetHaltState().Reason)
+		return nil
+	}
+	if IsPaused() {
+		logger.Warnf(ctx, "[量化交易] 交易已暂停(%s)，跳过本轮交易", GetPauseState().Reason)
+		return nil
+	}
+	if cfg := conf.Get().LLMCost; cfg.DailyCap > 0 {
+		today := utils.TodayLLMCost()
+		logger.Infof(ctx, "[LLM费用] 今日费用 %.4f/%.4f %s", today, cfg.DailyCap, cfg.Currency)
+		if today >= cfg.DailyCap && cfg.CapAction == utils.CostCapSkip {
+			logger.Warnf(ctx, "[LLM费用] 今日费用已达上限，跳过本轮交易")
+			detail := fmt.Sprintf("今日费用%.4f达到上限%.4f %s，跳过交易", today, cfg.DailyCap, cfg.Currency)
+			RecordRiskEvent(ctx, RiskEventCostCap, detail)
+			notify.Notify(ctx, notify.Message{Event: notify.EventBreaker, Title: "DeepTrade模型费用达到上限", Text: detail, Key: "cost_cap " + time.Now().Format("2006-01-02")})
+			return nil
+		}
+	}
 
 	// 1. 获取市场数据
-	marketData, err := GetMarketData()
+	marketData, err := GetMarketData(ctx)
 	if err != nil {
-		log.Printf("[量化交易] 错误: 无法获取市场数据 - %v", err)
+		logger.Errorf(ctx, "[量化交易] 错误: 无法获取市场数据 - %v", err)
 		return err
 	}
 	if marketData.PositionInfo.HasLong && marketData.PositionInfo.HasShort {
-		//当双向持仓的情况下出现，平仓后关闭系统
-		clSignal := &TradingSignal{Action: "CLOSE_LONG", PositionSize: 100}
-		ExecuteTrade(clSignal, marketData)
-		csSignal := &TradingSignal{Action: "CLOSE_SHORT", PositionSize: 100}
-		ExecuteTrade(csSignal, marketData)
-		log.Printf("[系统] 系统无法处理双向持仓的情况，被迫关闭")
-		panic("异常")
+		//当双向持仓的情况下出现，紧急停止：撤单清仓并停止交易
+		logger.Warnf(ctx, "[系统] 系统无法处理双向持仓的情况，触发紧急停止")
+		return TriggerKillSwitch(ctx, "出现双向持仓")
+	}
+	CheckIsolatedMarginBuffer(ctx, marketData.Positions)
+	recordAccountMetrics(marketData)
+	SyncJournal(ctx, marketData.OrderHistory)
+	notifyStopFills(ctx, marketData.OrderHistory)
+	if marketData.Positions != nil {
+		// 持仓获取失败时为nil，不能据此判断已平仓
+		RecordPnlPoint(ctx, marketData.Positions)
+	}
+	if marketData.Ticker != nil {
+		lastPrice, _ := strconv.ParseFloat(marketData.Ticker.LastPrice, 64)
+		RecordTriggerCycle(lastPrice)
 	}
 
 	// 3. LLM分析
-	signal, err := AnalyzeWithLLM(marketData)
+	signal, err := AnalyzeWithLLM(ctx, marketData)
 	if err != nil {
-		log.Printf("[量化交易] 错误: LLM分析失败 - %v", err)
+		logger.Errorf(ctx, "[量化交易] 错误: LLM分析失败 - %v", err)
 		return err
 	}
-	log.Printf("[量化交易] 分析结果: %s (评分: %d, 置信度: %.2f%%)", signal.Action, signal.Score, signal.Confidence*100)
-	log.Printf("[量化交易] 分析理由: %s", signal.Reasoning)
-	log.Printf("[量化交易] 动作: %s，仓位: %v", signal.Action, signal.PositionSize)
+	metrics.SignalActions.WithLabelValues(signal.Action).Inc()
+	logger.Infof(ctx, "[量化交易] 分析结果: %s (评分: %d, 置信度: %.2f%%)", signal.Action, signal.Score, signal.Confidence*100)
+	logger.Infof(ctx, "[量化交易] 分析理由: %s", signal.Reasoning)
+	logger.Infof(ctx, "[量化交易] 动作: %s，仓位: %v", signal.Action, signal.PositionSize)
 
 	// 4. 执行交易
-	err = ExecuteTrade(signal, marketData)
+	if isOpenOrAddAction(signal.Action) {
+		// 交易日志已在本轮同步，按最新的已实现盈亏判断
+		if reason := CheckLossLimits(ctx); reason != "" {
+			logger.Warnf(ctx, "[风控] %s，放弃执行: %s", reason, signal.Action)
+			RecordRiskEvent(ctx, RiskEventLossLimit, reason)
+			notify.Notify(ctx, notify.Message{Event: notify.EventBreaker, Title: "DeepTrade亏损达到上限", Text: reason + "，暂停开仓", Key: "loss_limit " + time.Now().Format("2006-01-02")})
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		// 收到退出信号时不再根据本轮分析结果下单
+		logger.Warnf(ctx, "[量化交易] 程序正在退出，放弃执行本轮交易")
+		return nil
+	}
+	// 下单阶段与手动操作、紧急停止互斥，并且不随退出信号中断，避免只完成开仓而未挂止盈止损
+	tradingMutex.Lock()
+	if signal.Action != "HOLD" && positionChanged(ctx, marketData) {
+		tradingMutex.Unlock()
+		logger.Warnf(ctx, "[量化交易] 分析期间持仓已变化(手动操作或止盈止损触发)，放弃执行: %s", signal.Action)
+		return nil
+	}
+	err = ExecuteTrade(context.WithoutCancel(ctx), signal, marketData)
+	tradingMutex.Unlock()
 	if err != nil {
-		log.Printf("[量化交易] 错误: 交易执行失败 - %v", err)
+		logger.Errorf(ctx, "[量化交易] 错误: 交易执行失败 - %v", err)
 		return err
 	}
-	SetMemory(signal.Memory)
-	refreshTimer()
+	notifyTrade(ctx, signal, marketData)
+	UpdateMemory(ctx, signal, positionOpenAfter(signal, marketData.PositionInfo))
+	TrackTrade(ctx, signal, marketData)
+	refreshTimer(ctx)
 	return err
 }
 
-func refreshTimer() {
-	log.Println("========================================")
-	log.Println("[量化交易] 本轮交易流程完成")
-	log.Println("========================================")
+// recordAccountMetrics 更新持仓名义价值、未实现盈亏和钱包余额指标，获取失败的数据不更新
+func recordAccountMetrics(marketData *MarketData) {
+	if marketData.Positions != nil {
+		var long, short, pnl float64
+		for _, p := range marketData.Positions {
+			notional := math.Abs(utils.ParseFloatSafe(p.Notional, 0))
+			if p.PositionSide == binance.PositionSideShort || utils.ParseFloatSafe(p.PositionAmt, 0) < 0 {
+				short += notional
+			} else {
+				long += notional
+			}
+			pnl += utils.ParseFloatSafe(p.UnRealizedProfit, 0)
+		}
+		metrics.PositionNotional.WithLabelValues("LONG").Set(long)
+		metrics.PositionNotional.WithLabelValues("SHORT").Set(short)
+		metrics.UnrealizedPnl.Set(pnl)
+	}
+	if marketData.Account != nil {
+		metrics.WalletBalance.Set(utils.ParseFloatSafe(marketData.Account.TotalWalletBalance, 0))
+	}
+}
+
+func refreshTimer(ctx context.Context) {
+	logger.Infof(ctx, "========================================")
+	logger.Infof(ctx, "[量化交易] 本轮交易流程完成")
+	logger.Infof(ctx, "========================================")
 
-	time.Sleep(30 * time.Second)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(30 * time.Second):
+	}
 	client, err := binance.GetFuturesClient()
-	positions, err := client.GetPositions(binance.ETHUSDT_PERP)
+	positions, err := client.GetPositions(ctx, binance.ETHUSDT_PERP)
 	if err != nil {
 		return
 	}
@@ -151,5 +231,14 @@ func refreshTimer() {
 	// 		sleepSec = 6*60 - 30
 	// 	}
 	// }
-	StartFetchPosition()
+	StartFetchPosition(ctx)
+}
+
+// Shutdown 程序退出前停止后台任务并保存状态
+func Shutdown() {
+	CloseFetchPosition()
+	if err := saveHaltState(GetHaltState()); err != nil {
+		logger.Errorf(context.Background(), "[系统] 保存停止状态失败: %v", err)
+	}
+	logger.Infof(context.Background(), "[系统] 后台任务已停止")
 }
@@ -1,6 +1,7 @@
 package task_test
 
 import (
+	"context"
 	"deeptrade/conf"
 	"deeptrade/task"
 	"encoding/json"
@@ -19,7 +20,7 @@ func TestGetMarketData(t *testing.T) {
 	// t.Log("全部钱包余额:", 4581.4791268)
 	// t.Log("可用余额:", 4581.4791268)
 	// return
-	data, _ := task.GetMarketData()
+	data, _ := task.GetMarketData(context.Background())
 	t.Log("全部钱包余额:", data.Account.TotalWalletBalance)
 	t.Log("可用余额:", data.Account.AvailableBalance)
 	PositionsData, _ := json.Marshal(data.Positions)
@@ -27,7 +28,7 @@ func TestGetMarketData(t *testing.T) {
 }
 
 func TestCloseOrder(t *testing.T) {
-	data, _ := task.GetMarketData()
+	data, _ := task.GetMarketData(context.Background())
 	signal := &task.TradingSignal{Action: "CLOSE_LONG", PositionSize: 100}
-	t.Log(task.ExecuteTrade(signal, data))
+	t.Log(task.ExecuteTrade(context.Background(), signal, data))
 }
@@ -0,0 +1,404 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/prompt"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	tradeJournalFile = "trade_journal.json" // 当前持仓的交易记录，重启后继续跟踪
+	reflectionFile   = "reflections.jsonl"
+	maxPnlPoints     = 120 // 盈亏路径最多保留的点数，超出时隔点抽稀
+)
+
+// SLTPAdjustment 持仓期间的一次加仓或止盈止损调整
+type SLTPAdjustment struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	StopLoss   float64   `json:"stop_loss"`
+	TakeProfit float64   `json:"take_profit"`
+	Reasoning  string    `json:"reasoning"`
+}
+
+// PnlPoint 持仓盈亏路径上的一个点
+type PnlPoint struct {
+	Time          time.Time `json:"time"`
+	MarkPrice     float64   `json:"mark_price"`
+	UnrealizedPnl float64   `json:"unrealized_pnl"`
+}
+
+// TradeJournal 一笔交易从开仓到平仓的记录
+type TradeJournal struct {
+	Side        string           `json:"side"` // LONG/SHORT
+	EntryTime   time.Time        `json:"entry_time"`
+	EntryPrice  float64          `json:"entry_price"`
+	Tags        []string         `json:"tags"`  // 开仓时的市场特征
+	Entry       *DecisionRecord  `json:"entry"` // 开仓决策记录
+	Adjustments []SLTPAdjustment `json:"adjustments,omitempty"`
+	PnlPath     []PnlPoint       `json:"pnl_path,omitempty"`
+}
+
+// PostMortem 模型给出的复盘结果
+type PostMortem struct {
+	Summary  string `json:"summary"`
+	Cause    string `json:"cause"`
+	Mistakes string `json:"mistakes"`
+	Setup    string `json:"setup"`
+	Lessons  []struct {
+		Lesson      string `json:"lesson"`
+		AppliesWhen string `json:"applies_when"`
+	} `json:"lessons"`
+}
+
+// ReflectionRecord 一次复盘的记录
+type ReflectionRecord struct {
+	Time        time.Time     `json:"time"`
+	Journal     *TradeJournal `json:"journal"`
+	CloseReason string        `json:"close_reason"`
+	ExitPrice   float64       `json:"exit_price"`
+	NetPnl      float64       `json:"net_pnl"`
+	Model       string        `json:"model"`
+	PostMortem  *PostMortem   `json:"post_mortem,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// postMortemOutput 复盘结果的结构化输出定义
+var postMortemOutput = &utils.StructuredOutput{
+	Name: "submit_post_mortem",
+	Desc: "提交交易复盘结果",
+	Params: map[string]*schema.ParameterInfo{
+		"summary":  {Type: schema.String, Desc: "复盘总结", Required: true},
+		"cause":    {Type: schema.String, Desc: "盈亏的主要原因", Required: true},
+		"mistakes": {Type: schema.String, Desc: "失误，没有则为空", Required: true},
+		"setup":    {Type: schema.String, Desc: "交易形态", Required: true},
+		"lessons": {Type: schema.Array, Desc: "1-3条可执行的经验", Required: true, ElemInfo: &schema.ParameterInfo{
+			Type: schema.Object,
+			SubParams: map[string]*schema.ParameterInfo{
+				"lesson":       {Type: schema.String, Desc: "经验", Required: true},
+				"applies_when": {Type: schema.String, Desc: "适用条件", Required: true},
+			},
+		}},
+	},
+}
+
+var (
+	journalMutex  sync.Mutex
+	journalLoaded bool
+	journal       *TradeJournal
+)
+
+// loadJournal 首次使用时加载未平仓的交易记录，调用方需持有 journalMutex
+func loadJournal(ctx context.Context) {
+	if journalLoaded {
+		return
+	}
+	journalLoaded = true
+	data, err := os.ReadFile(conf.Get().Storage.Path(tradeJournalFile))
+	if err != nil {
+		return
+	}
+	var j TradeJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		logger.Errorf(ctx, "[交易复盘] 解析交易记录失败: %v", err)
+		return
+	}
+	journal = &j
+}
+
+// saveJournal 保存当前交易记录，无持仓时删除文件，调用方需持有 journalMutex
+func saveJournal(ctx context.Context) {
+	path := conf.Get().Storage.Path(tradeJournalFile)
+	if journal == nil {
+		os.Remove(path)
+		return
+	}
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logger.Errorf(ctx, "[交易复盘] 保存交易记录失败: %v", err)
+	}
+}
+
+// TrackTrade 交易执行成功后更新交易记录：开仓时新建，加仓和调整止盈止损时追加，平仓时触发复盘
+func TrackTrade(ctx context.Context, signal *TradingSignal, marketData *MarketData) {
+	if !conf.Get().Reflection.Enable {
+		return
+	}
+	switch signal.Action {
+	case "OPEN_LONG", "OPEN_SHORT":
+		technicalData := PrepareTechnicalData(marketData)
+		journalMutex.Lock()
+		loadJournal(ctx)
+		journal = &TradeJournal{
+			Side:       strings.TrimPrefix(signal.Action, "OPEN_"),
+			EntryTime:  time.Now(),
+			EntryPrice: technicalData.CurrentPrice,
+			Tags:       MarketTags(technicalData, marketData),
+			Entry:      signal.decision,
+		}
+		saveJournal(ctx)
+		journalMutex.Unlock()
+	case "ADD_LONG", "ADD_SHORT", "ADJUST_SL_TP":
+		journalMutex.Lock()
+		loadJournal(ctx)
+		if journal != nil {
+			journal.Adjustments = append(journal.Adjustments, SLTPAdjustment{
+				Time: time.Now(), Action: signal.Action, StopLoss: signal.StopLoss, TakeProfit: signal.TakeProfit, Reasoning: signal.Reasoning,
+			})
+			saveJournal(ctx)
+		}
+		journalMutex.Unlock()
+	case "CLOSE_LONG", "CLOSE_SHORT":
+		CloseTrade(ctx, "模型平仓: "+signal.Reasoning)
+	}
+}
+
+// RecordPnlPoint 从持仓快照队列同步盈亏路径，持仓已不存在时视为止盈止损或外部平仓并触发复盘
+func RecordPnlPoint(ctx context.Context, positions []binance.Position) {
+	if !conf.Get().Reflection.Enable {
+		return
+	}
+	if !HasRealPosition(positions) {
+		CloseTrade(ctx, "止盈止损触发或外部平仓")
+		return
+	}
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	loadJournal(ctx)
+	if journal != nil && syncPnlPath(journal) {
+		saveJournal(ctx)
+	}
+}
+
+// syncPnlPath 把持仓快照队列中晚于已有路径的快照追加到盈亏路径，有新增时返回true，调用方需持有 journalMutex
+func syncPnlPath(j *TradeJournal) bool {
+	since := j.EntryTime
+	if n := len(j.PnlPath); n > 0 {
+		since = j.PnlPath[n-1].Time
+	}
+	points := positionPnlPoints(since)
+	for _, p := range points {
+		j.PnlPath = appendPnlPoint(j.PnlPath, p)
+	}
+	return len(points) > 0
+}
+
+// appendPnlPoint 追加盈亏点，超出上限时隔点抽稀，保留首尾
+func appendPnlPoint(path []PnlPoint, point PnlPoint) []PnlPoint {
+	path = append(path, point)
+	if len(path) <= maxPnlPoints {
+		return path
+	}
+	thinned := make([]PnlPoint, 0, len(path)/2+1)
+	for i := 0; i < len(path)-1; i += 2 {
+		thinned = append(thinned, path[i])
+	}
+	return append(thinned, path[len(path)-1])
+}
+
+// CloseTrade 结束当前交易记录并在后台复盘
+func CloseTrade(ctx context.Context, reason string) {
+	journalMutex.Lock()
+	loadJournal(ctx)
+	j := journal
+	if j != nil {
+		// 补上最后一次同步之后的持仓快照
+		syncPnlPath(j)
+	}
+	journal = nil
+	if j != nil {
+		saveJournal(ctx)
+	}
+	journalMutex.Unlock()
+	if j == nil {
+		return
+	}
+	logger.Infof(ctx, "[交易复盘] %s仓已平仓(%s)，开始复盘", j.Side, reason)
+	// 复盘不随本轮交易结束或程序退出信号中断
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Minute)
+		defer cancel()
+		reflectTrade(ctx, j, reason)
+	}()
+}
+
+// reflectTrade 汇总交易结果并请求模型复盘，经验写入经验库
+func reflectTrade(ctx context.Context, j *TradeJournal, reason string) {
+	record := &ReflectionRecord{Time: time.Now(), Journal: j, CloseReason: reason}
+	defer saveReflection(ctx, record)
+
+	// 先同步平仓成交，再用交易日志中开仓以来的成交统计平仓价和净盈亏，不受成交接口时间范围和条数限制
+	SyncJournal(ctx, nil)
+	trades, err := journalTrades(j.EntryTime.Add(-time.Minute), time.Time{})
+	if err != nil {
+		logger.Errorf(ctx, "[交易复盘] 获取成交记录失败: %v", err)
+	}
+	record.NetPnl = ComputeTradeStats(trades).NetPnl
+	for i := len(trades) - 1; i >= 0; i-- {
+		if utils.ParseFloatSafe(trades[i].RealizedPnl, 0) != 0 {
+			record.ExitPrice = utils.ParseFloatSafe(trades[i].Price, 0)
+			break
+		}
+	}
+
+	prompts, err := prompt.ForRole(false)
+	if err == nil && !prompts.Has(prompt.Reflect) {
+		err = fmt.Errorf("提示词版本%s没有复盘模板%s", prompts.Version, prompt.Reflect)
+	}
+	var system string
+	if err == nil {
+		system, err = prompts.Render(prompt.Reflect, nil)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		logger.Errorf(ctx, "[交易复盘] %v", err)
+		return
+	}
+
+	req := utils.Request{System: system, Messages: []*schema.Message{schema.UserMessage(FormatTradeReview(record))}, Output: postMortemOutput}
+	var response string
+	if model := conf.Get().Reflection.Model; model != "" {
+		llmconf, ok := conf.Get().GetLLMByModel(model)
+		if !ok {
+			err = fmt.Errorf("模型%s未配置", model)
+		} else {
+			record.Model = llmconf.Model
+			response, err = utils.GenerateModel(ctx, llmconf, req)
+		}
+	} else {
+		response, record.Model, err = utils.Generate(ctx, false, req)
+	}
+	if err == nil {
+		record.PostMortem, err = parsePostMortem(response)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		logger.Errorf(ctx, "[交易复盘] 复盘失败: %v", err)
+		return
+	}
+	logger.Infof(ctx, "[交易复盘] 净盈亏 %.2f，%s", record.NetPnl, record.PostMortem.Summary)
+
+	var items []Lesson
+	for _, l := range record.PostMortem.Lessons {
+		if strings.TrimSpace(l.Lesson) == "" {
+			continue
+		}
+		items = append(items, Lesson{
+			Time: record.Time, Side: j.Side, Setup: record.PostMortem.Setup, Tags: j.Tags,
+			NetPnl: record.NetPnl, Lesson: l.Lesson, AppliesWhen: l.AppliesWhen,
+		})
+	}
+	if len(items) > 0 {
+		saveLessons(ctx, items)
+		logger.Infof(ctx, "[交易复盘] 新增%d条经验", len(items))
+	}
+}
+
+// parsePostMortem 解析复盘结果，使用最后一个包含summary的JSON对象
+func parsePostMortem(response string) (*PostMortem, error) {
+	candidates := extractJSONObjects(response)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		var pm PostMortem
+		if err := json.Unmarshal([]byte(candidates[i]), &pm); err == nil && pm.Summary != "" {
+			return &pm, nil
+		}
+	}
+	return nil, fmt.Errorf("解析复盘结果失败: %s", response)
+}
+
+// FormatTradeReview 格式化复盘所需的交易信息
+func FormatTradeReview(r *ReflectionRecord) string {
+	j := r.Journal
+	var b strings.Builder
+	b.WriteString("## 交易概况\n")
+	b.WriteString(fmt.Sprintf("- 方向: %s\n", map[string]string{"LONG": "多头", "SHORT": "空头"}[j.Side]))
+	b.WriteString(fmt.Sprintf("- 开仓时间: %s，持仓时长: %s\n", j.EntryTime.Format("2006-01-02 15:04:05"), r.Time.Sub(j.EntryTime).Round(time.Minute)))
+	b.WriteString(fmt.Sprintf("- 开仓价: %.2f，平仓价: %.2f\n", j.EntryPrice, r.ExitPrice))
+	b.WriteString(fmt.Sprintf("- 净盈亏(扣除手续费): %.2f USDT\n", r.NetPnl))
+	b.WriteString(fmt.Sprintf("- 平仓方式: %s\n", r.CloseReason))
+	b.WriteString(fmt.Sprintf("- 开仓时的市场特征: %s\n", strings.Join(j.Tags, ", ")))
+
+	if j.Entry != nil {
+		b.WriteString("\n## 开仓决策\n")
+		if s := j.Entry.Signal; s != nil {
+			b.WriteString(fmt.Sprintf("- %s 评分%d 信心度%.2f 仓位%d%% 止损%.2f 止盈%.2f\n- 理由: %s\n", s.Action, s.Score, s.Confidence, s.PositionSize, s.StopLoss, s.TakeProfit, s.Reasoning))
+		}
+		for _, st := range j.Entry.Stages {
+			if st.Role != RoleDecision && st.Error == "" {
+				b.WriteString(fmt.Sprintf("\n### %s意见\n%s\n", roleNames[st.Role], strings.TrimSpace(st.Output)))
+			}
+		}
+		b.WriteString("\n## 开仓时的行情数据\n")
+		b.WriteString(truncateText(j.Entry.Prompt, 6000))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n## 持仓期间的调整\n")
+	if len(j.Adjustments) == 0 {
+		b.WriteString("无\n")
+	}
+	for _, a := range j.Adjustments {
+		b.WriteString(fmt.Sprintf("- %s %s 止损%.2f 止盈%.2f: %s\n", a.Time.Format("01-02 15:04"), a.Action, a.StopLoss, a.TakeProfit, a.Reasoning))
+	}
+
+	b.WriteString("\n## 持仓盈亏路径\n")
+	if len(j.PnlPath) == 0 {
+		b.WriteString("无\n")
+		return b.String()
+	}
+	best, worst := j.PnlPath[0], j.PnlPath[0]
+	for _, p := range j.PnlPath {
+		if p.UnrealizedPnl > best.UnrealizedPnl {
+			best = p
+		}
+		if p.UnrealizedPnl < worst.UnrealizedPnl {
+			worst = p
+		}
+	}
+	b.WriteString(fmt.Sprintf("- 最大浮盈: %.2f (%s, 价格%.2f)\n", best.UnrealizedPnl, best.Time.Format("01-02 15:04"), best.MarkPrice))
+	b.WriteString(fmt.Sprintf("- 最大浮亏: %.2f (%s, 价格%.2f)\n", worst.UnrealizedPnl, worst.Time.Format("01-02 15:04"), worst.MarkPrice))
+	step := (len(j.PnlPath) + 29) / 30
+	for i := 0; i < len(j.PnlPath); i += step {
+		p := j.PnlPath[i]
+		b.WriteString(fmt.Sprintf("%s 价格%.2f 浮盈亏%.2f\n", p.Time.Format("01-02 15:04"), p.MarkPrice, p.UnrealizedPnl))
+	}
+	return b.String()
+}
+
+// truncateText 截断过长的文本
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return strings.ToValidUTF8(text[:limit], "") + "\n..."
+}
+
+// saveReflection 追加写入复盘记录
+func saveReflection(ctx context.Context, record *ReflectionRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(conf.Get().Storage.Path(reflectionFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[交易复盘] 写入复盘记录失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
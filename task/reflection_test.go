@@ -0,0 +1,62 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"deeptrade/task"
+)
+
+func TestMatchLessons(t *testing.T) {
+	now := time.Now()
+	lessons := []task.Lesson{
+		{Time: now.Add(-2 * time.Hour), Lesson: "a", Tags: []string{"regime:bullish", "setup:pullback", "vol:high", "rsi:overbought"}},
+		{Time: now.Add(-time.Hour), Lesson: "b", Tags: []string{"regime:bullish", "setup:breakout", "vol:low", "rsi:neutral"}},
+		{Time: now, Lesson: "c", Tags: []string{"regime:bearish", "setup:pullback", "vol:high", "rsi:overbought"}},
+	}
+	current := []string{"regime:bullish", "setup:pullback", "vol:high", "rsi:overbought"}
+	if score := task.LessonScore(lessons[0].Tags, current); score != 1 {
+		t.Errorf("特征完全相同时相关度应为1: %v", score)
+	}
+	if score := task.LessonScore(lessons[2].Tags, current); score != 0.5 {
+		t.Errorf("交易形态和其他特征相同、市场环境不同时相关度应为0.5: %v", score)
+	}
+
+	matched := task.MatchLessons(lessons, current, 2, 0.5)
+	if len(matched) != 2 || matched[0].Lesson != "a" || matched[1].Lesson != "c" {
+		t.Fatalf("匹配结果错误: %+v", matched)
+	}
+	if matched := task.MatchLessons(lessons, current, 0, 0.6); len(matched) != 1 {
+		t.Errorf("阈值过滤错误: %+v", matched)
+	}
+
+	text := task.FormatLessons([]task.Lesson{{Time: now, Side: "LONG", NetPnl: -5, Setup: "趋势回踩", Lesson: "不追高", AppliesWhen: "RSI超买"}})
+	if !strings.Contains(text, "多头 -5.00U | 亏损 | 趋势回踩] 不追高 (适用: RSI超买)") {
+		t.Errorf("格式化错误: %s", text)
+	}
+}
+
+func TestFormatTradeReview(t *testing.T) {
+	entry := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	record := &task.ReflectionRecord{
+		Time:        entry.Add(90 * time.Minute),
+		CloseReason: "止盈止损触发或外部平仓",
+		ExitPrice:   3050,
+		NetPnl:      12.5,
+		Journal: &task.TradeJournal{
+			Side: "LONG", EntryTime: entry, EntryPrice: 3000, Tags: []string{"regime:bullish"},
+			Adjustments: []task.SLTPAdjustment{{Time: entry.Add(time.Hour), Action: "ADJUST_SL_TP", StopLoss: 3010, TakeProfit: 3080, Reasoning: "上移止损"}},
+			PnlPath: []task.PnlPoint{
+				{Time: entry.Add(10 * time.Minute), MarkPrice: 2990, UnrealizedPnl: -3},
+				{Time: entry.Add(60 * time.Minute), MarkPrice: 3060, UnrealizedPnl: 18},
+			},
+		},
+	}
+	text := task.FormatTradeReview(record)
+	for _, want := range []string{"持仓时长: 1h30m0s", "平仓价: 3050.00", "上移止损", "最大浮盈: 18.00", "最大浮亏: -3.00"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("复盘信息缺少 %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/notify"
+	"deeptrade/store"
+	"deeptrade/utils"
+)
+
+//go:embed templates
+var reportTemplates embed.FS
+
+// 报告格式
+const (
+	ReportHTML     = "html"
+	ReportMarkdown = "md"
+)
+
+const (
+	reasoningExcerptLen = 600 // 决策理由摘录的最大字节数
+	indicatorLines      = 12  // 开仓时技术指标摘录的行数
+)
+
+// ReportTrade 报告中的一笔完整交易及触发它的决策
+type ReportTrade struct {
+	store.RoundTrip
+	EntryAction string // 开仓决策动作，未匹配到决策时为空
+	Model       string
+	Confidence  float64
+	Reasoning   string // 决策理由摘录
+	Indicators  string // 开仓时的技术指标摘录
+	ExitReason  string
+}
+
+// ActionCount 一种决策动作的次数
+type ActionCount struct {
+	Action string
+	Count  int
+}
+
+// Report 一段时间的交易报告
+type Report struct {
+	Since       time.Time
+	Until       time.Time
+	GeneratedAt time.Time
+	Analytics   Analytics
+	Trades      []ReportTrade
+	Actions     []ActionCount
+	LLMCost     float64
+	Currency    string
+	RiskEvents  []RiskEvent
+}
+
+// BuildReport 生成时间范围内的交易报告
+func BuildReport(ctx context.Context, since, until time.Time) (*Report, error) {
+	in, source, err := loadAnalyticsInput(ctx, since, until)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Since: since, Until: until, GeneratedAt: time.Now(), Analytics: ComputeAnalytics(in)}
+	r.Analytics.Source = source
+	for _, t := range in.Trips {
+		rt := ReportTrade{RoundTrip: t, ExitReason: exitReason(t, in.Decisions)}
+		if d := entryDecision(t, in.Decisions); d != nil {
+			rt.EntryAction, rt.Model, rt.Confidence = d.Action, d.Model, d.Confidence
+			rt.Reasoning = truncateText(d.Reasoning, reasoningExcerptLen)
+			rt.Indicators = decisionIndicators(d.Record, indicatorLines)
+		}
+		r.Trades = append(r.Trades, rt)
+	}
+	counts := map[string]int{}
+	for _, d := range in.Decisions {
+		if !d.Time.Before(since) && d.Action != "" {
+			counts[d.Action]++
+		}
+	}
+	for action, n := range counts {
+		r.Actions = append(r.Actions, ActionCount{Action: action, Count: n})
+	}
+	sort.Slice(r.Actions, func(i, j int) bool {
+		if r.Actions[i].Count != r.Actions[j].Count {
+			return r.Actions[i].Count > r.Actions[j].Count
+		}
+		return r.Actions[i].Action < r.Actions[j].Action
+	})
+	r.LLMCost, r.Currency = utils.LLMCostBetween(since, until), conf.Get().LLMCost.Currency
+	if r.RiskEvents, err = LoadRiskEvents(since, until); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decisionIndicators 从完整决策记录的提示词中摘录技术指标段落
+func decisionIndicators(raw json.RawMessage, lines int) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var record DecisionRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return ""
+	}
+	const header = "## 技术指标"
+	start := strings.Index(record.Prompt, header)
+	if start < 0 {
+		return ""
+	}
+	section := record.Prompt[start+len(header):]
+	if end := strings.Index(section, "\n## "); end >= 0 {
+		section = section[:end]
+	}
+	parts := strings.Split(strings.TrimSpace(section), "\n")
+	if len(parts) > lines {
+		parts = parts[:lines]
+	}
+	return strings.Join(parts, "\n")
+}
+
+// EquitySVG 权益曲线的SVG图，内联在报告中
+func (r *Report) EquitySVG() string {
+	const width, height, pad = 760.0, 220.0, 30.0
+	points := r.Analytics.Equity
+	if len(points) < 2 {
+		return ""
+	}
+	lo, hi := points[0].Equity, points[0].Equity
+	for _, p := range points {
+		lo, hi = math.Min(lo, p.Equity), math.Max(hi, p.Equity)
+	}
+	if hi-lo < 1e-9 {
+		hi, lo = hi+1, lo-1
+	}
+	span := r.Until.Sub(r.Since).Seconds()
+	x := func(t time.Time) float64 {
+		if span <= 0 {
+			return pad
+		}
+		return pad + t.Sub(r.Since).Seconds()/span*(width-2*pad)
+	}
+	y := func(v float64) float64 { return height - pad - (v-lo)/(hi-lo)*(height-2*pad) }
+
+	// 阶梯线：权益在两次盈亏之间保持不变
+	var path strings.Builder
+	prev := points[0]
+	path.WriteString(fmt.Sprintf("M%.1f %.1f", x(prev.Time), y(prev.Equity)))
+	for _, p := range points[1:] {
+		path.WriteString(fmt.Sprintf(" H%.1f V%.1f", x(p.Time), y(p.Equity)))
+	}
+	path.WriteString(fmt.Sprintf(" H%.1f", x(r.Until)))
+	color := "#16a34a"
+	if r.Analytics.NetPnl < 0 {
+		color = "#dc2626"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="11">`, width, height, width, height))
+	b.WriteString(fmt.Sprintf(`<rect width="%.0f" height="%.0f" fill="#ffffff"/>`, width, height))
+	b.WriteString(fmt.Sprintf(`<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="#9ca3af"/>`, pad, height-pad, width-pad, height-pad))
+	b.WriteString(fmt.Sprintf(`<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="#e5e7eb" stroke-dasharray="4"/>`, pad, y(r.Analytics.StartEquity), width-pad, y(r.Analytics.StartEquity)))
+	b.WriteString(fmt.Sprintf(`<path d="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, path.String(), color))
+	b.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.0f" fill="#374151">%.2f</text>`, pad, pad-8, hi))
+	b.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.0f" fill="#374151">%.2f</text>`, pad, height-pad+14, lo))
+	b.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.0f" fill="#6b7280" text-anchor="end">%s ~ %s</text>`, width-pad, height-pad+14, r.Since.Format("01-02 15:04"), r.Until.Format("01-02 15:04")))
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// reportFuncs 报告模板函数
+var reportFuncs = map[string]any{
+	"time": func(t time.Time) string { return t.Format("01-02 15:04") },
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"hold": formatHoldTime,
+	"f2":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"pct":  func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"oneline": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+	// svg 报告自己生成的SVG，HTML中不转义
+	"svg": func(s string) htmltemplate.HTML { return htmltemplate.HTML(s) },
+	"svgDataURI": func(svg string) string {
+		return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+	},
+}
+
+// Render 按格式渲染报告，HTML 报告为自包含的单个文件
+func (r *Report) Render(format string) (string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case ReportHTML:
+		t, err := htmltemplate.New("report.html.tmpl").Funcs(htmltemplate.FuncMap(reportFuncs)).ParseFS(reportTemplates, "templates/report.html.tmpl")
+		if err != nil {
+			return "", err
+		}
+		err = t.Execute(&buf, r)
+		return buf.String(), err
+	case ReportMarkdown:
+		t, err := template.New("report.md.tmpl").Funcs(template.FuncMap(reportFuncs)).ParseFS(reportTemplates, "templates/report.md.tmpl")
+		if err != nil {
+			return "", err
+		}
+		err = t.Execute(&buf, r)
+		return buf.String(), err
+	}
+	return "", fmt.Errorf("不支持的报告格式: %s", format)
+}
+
+// Title 报告标题
+func (r *Report) Title() string {
+	return fmt.Sprintf("DeepTrade交易报告 %s ~ %s", r.Since.Format("2006-01-02"), r.Until.Format("2006-01-02"))
+}
+
+// MailReport 通过邮件通知渠道发送HTML报告
+func MailReport(ctx context.Context, r *Report) error {
+	body, err := r.Render(ReportHTML)
+	if err != nil {
+		return err
+	}
+	return notify.SendMail(ctx, r.Title(), body)
+}
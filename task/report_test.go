@@ -0,0 +1,50 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"deeptrade/store"
+	"deeptrade/task"
+)
+
+func TestReportRender(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	until := since.AddDate(0, 0, 2)
+	fills := []store.Fill{
+		{TradeID: 1, Side: "BUY", Qty: 1, Price: 3000, Commission: 1, Time: since.Add(time.Hour)},
+		{TradeID: 2, Side: "SELL", Qty: 1, Price: 2950, RealizedPnl: -50, Commission: 1, Time: since.Add(5 * time.Hour)},
+	}
+	trips, _ := task.BuildRoundTrips(fills, nil)
+	r := &task.Report{
+		Since: since, Until: until, GeneratedAt: until,
+		Analytics:  task.ComputeAnalytics(task.AnalyticsInput{Since: since, Until: until, StartEquity: 1000, Fills: fills, Trips: trips}),
+		Trades:     []task.ReportTrade{{RoundTrip: trips[0], EntryAction: "OPEN_LONG", Model: "m", Reasoning: "突破<前高>", Indicators: "RSI 72", ExitReason: "止盈止损"}},
+		Actions:    []task.ActionCount{{Action: "HOLD", Count: 5}},
+		RiskEvents: []task.RiskEvent{{Time: since, Kind: task.RiskEventKillSwitch, Detail: "出现双向持仓"}},
+	}
+
+	html, err := r.Render(task.ReportHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<svg", "<path d=\"M", "#dc2626", "突破&lt;前高&gt;", "RSI 72", "出现双向持仓", "-52.00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML报告缺少 %q", want)
+		}
+	}
+
+	md, err := r.Render(task.ReportMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# DeepTrade交易报告 2026-10-01 ~ 2026-10-03", "data:image/svg+xml;base64,", "> 突破<前高>", "| kill_switch | 出现双向持仓 |", "HOLD: 5"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown报告缺少 %q:\n%s", want, md)
+		}
+	}
+	if _, err := r.Render("pdf"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
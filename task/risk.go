@@ -0,0 +1,154 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/store"
+)
+
+// InitMarginType 启动时按配置强制设置各交易对的保证金模式
+func InitMarginType(ctx context.Context) {
+	client := binance.GetOnceFuturesClient()
+	for _, mc := range conf.Get().Margin {
+		marginType := binance.MarginType(strings.ToUpper(mc.MarginType))
+		if marginType != binance.MarginTypeIsolated && marginType != binance.MarginTypeCross {
+			logger.Infof(ctx, "[风控] 交易对%s保证金模式配置无效: %s", mc.Symbol, mc.MarginType)
+			continue
+		}
+
+		symbol := binance.Symbol(mc.Symbol)
+		positions, err := client.GetPositions(ctx, symbol)
+		if err != nil {
+			logger.Warnf(ctx, "[风控] 获取%s持仓失败，跳过保证金模式设置: %v", mc.Symbol, err)
+			continue
+		}
+		if len(positions) > 0 && strings.EqualFold(string(positions[0].MarginType), string(marginType)) {
+			logger.Infof(ctx, "[风控] %s保证金模式已是%s", mc.Symbol, marginType)
+			continue
+		}
+		if HasRealPosition(positions) {
+			// 币安不允许在持仓或挂单时切换保证金模式
+			logger.Infof(ctx, "[风控] %s存在持仓，暂不切换保证金模式为%s", mc.Symbol, marginType)
+			continue
+		}
+
+		if err := client.SetMarginType(ctx, symbol, marginType); err != nil {
+			logger.Errorf(ctx, "[风控] 设置%s保证金模式%s失败: %v", mc.Symbol, marginType, err)
+			continue
+		}
+		logger.Infof(ctx, "[风控] 设置%s保证金模式为%s", mc.Symbol, marginType)
+	}
+}
+
+// CheckIsolatedMarginBuffer 检查逐仓持仓的强平距离，不足缓冲时自动追加逐仓保证金
+func CheckIsolatedMarginBuffer(ctx context.Context, positions []binance.Position) {
+	var account *binance.FuturesAccountInfo
+	for _, pos := range positions {
+		if !strings.EqualFold(string(pos.MarginType), string(binance.MarginTypeIsolated)) {
+			continue
+		}
+		mc, ok := conf.Get().GetMargin(pos.Symbol)
+		if !ok || mc.LiquidationBufferPct <= 0 {
+			continue
+		}
+
+		amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+		markPrice, _ := strconv.ParseFloat(pos.MarkPrice, 64)
+		liqPrice, _ := strconv.ParseFloat(pos.LiquidationPrice, 64)
+		qty := math.Abs(amt)
+		if qty == 0 || markPrice <= 0 || liqPrice <= 0 {
+			continue
+		}
+
+		distancePct := math.Abs(markPrice-liqPrice) / markPrice * 100
+		if distancePct >= mc.LiquidationBufferPct {
+			continue
+		}
+
+		client := binance.GetOnceFuturesClient()
+		if account == nil {
+			acc, err := client.GetAccountInfo(ctx)
+			if err != nil {
+				logger.Errorf(ctx, "[风控] 获取账户信息失败，无法追加逐仓保证金: %v", err)
+				return
+			}
+			account = acc
+		}
+		available, _ := strconv.ParseFloat(account.AvailableBalance, 64)
+		addAmount := MarginTopUp(distancePct, markPrice, qty, available, mc)
+		if addAmount == 0 {
+			logger.Warnf(ctx, "[风控] %s %s 强平距离%.2f%%低于缓冲%.2f%%，但可用余额不足", pos.Symbol, pos.PositionSide, distancePct, mc.LiquidationBufferPct)
+			continue
+		}
+
+		if _, err := client.AddIsolatedMargin(ctx, binance.Symbol(pos.Symbol), pos.PositionSide, addAmount); err != nil {
+			logger.Errorf(ctx, "[风控] %s %s 追加逐仓保证金失败: %v", pos.Symbol, pos.PositionSide, err)
+			continue
+		}
+		detail := fmt.Sprintf("%s %s 强平距离%.2f%%低于缓冲%.2f%%，追加逐仓保证金%.2f USDT (强平价: %.2f, 标记价: %.2f)",
+			pos.Symbol, pos.PositionSide, distancePct, mc.LiquidationBufferPct, addAmount, liqPrice, markPrice)
+		logger.Infof(ctx, "[风控] %s", detail)
+		RecordRiskEvent(ctx, RiskEventMarginAdd, detail)
+		available -= addAmount
+		account.AvailableBalance = strconv.FormatFloat(available, 'f', 8, 64)
+	}
+}
+
+// MarginTopUp 计算把强平距离恢复到目标所需追加的逐仓保证金，按单次上限和可用余额截断，不足0.01 USDT时返回0
+func MarginTopUp(distancePct, markPrice, qty, available float64, mc conf.MarginConf) float64 {
+	targetPct := mc.TargetBufferPct
+	if targetPct <= mc.LiquidationBufferPct {
+		targetPct = mc.LiquidationBufferPct * 2
+	}
+	// U本位合约中，每追加1 USDT逐仓保证金，强平价向远离方向移动 1/qty
+	addAmount := (targetPct - distancePct) / 100 * markPrice * qty
+	if mc.MaxAddMargin > 0 && addAmount > mc.MaxAddMargin {
+		addAmount = mc.MaxAddMargin
+	}
+	if addAmount > available {
+		addAmount = available
+	}
+	if addAmount < 0.01 {
+		return 0
+	}
+	return addAmount
+}
+
+// CheckLossLimits 按本地交易日志检查当日净亏损和连续亏损，达到上限时返回原因，未达到或未配置时返回空串
+func CheckLossLimits(ctx context.Context) string {
+	cfg := conf.Get().Risk
+	if cfg.MaxDailyLoss <= 0 && cfg.MaxConsecutiveLosses <= 0 {
+		return ""
+	}
+	db := store.GetOnceDB()
+	if db == nil {
+		logger.Warnf(ctx, "[风控] 交易日志不可用，跳过亏损限制检查")
+		return ""
+	}
+	if cfg.MaxDailyLoss > 0 {
+		now := time.Now()
+		pnl, err := db.NetPnlSince(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+		if err != nil {
+			logger.Errorf(ctx, "[风控] 查询今日净盈亏失败: %v", err)
+		} else if -pnl >= cfg.MaxDailyLoss {
+			return fmt.Sprintf("今日净亏损%.2f USDT达到上限%.2f USDT", -pnl, cfg.MaxDailyLoss)
+		}
+	}
+	if cfg.MaxConsecutiveLosses > 0 {
+		n, err := db.ConsecutiveLosses()
+		if err != nil {
+			logger.Errorf(ctx, "[风控] 查询连续亏损失败: %v", err)
+		} else if n >= cfg.MaxConsecutiveLosses {
+			return fmt.Sprintf("连续亏损%d笔达到上限%d笔", n, cfg.MaxConsecutiveLosses)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+)
+
+const riskEventFile = "risk_events.jsonl"
+
+// 风控事件类型
+const (
+	RiskEventKillSwitch  = "kill_switch"  // 紧急停止
+	RiskEventLiquidation = "liquidation"  // 强平距离过近，自动减仓或清仓
+	RiskEventMarginAdd   = "margin_add"   // 逐仓追加保证金
+	RiskEventCostCap     = "llm_cost_cap" // LLM费用达到每日上限
+	RiskEventLossLimit   = "loss_limit"   // 当日亏损或连续亏损达到上限，禁止开仓
+)
+
+// RiskEvent 一次触发的风控事件
+type RiskEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail"`
+}
+
+var riskEventMutex sync.Mutex
+
+// RecordRiskEvent 追加写入风控事件
+func RecordRiskEvent(ctx context.Context, kind, detail string) {
+	data, err := json.Marshal(RiskEvent{Time: time.Now(), Kind: kind, Detail: detail})
+	if err != nil {
+		return
+	}
+	riskEventMutex.Lock()
+	defer riskEventMutex.Unlock()
+	f, err := os.OpenFile(conf.Get().Storage.Path(riskEventFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[风控] 写入风控事件失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// LoadRiskEvents 读取时间范围内的风控事件
+func LoadRiskEvents(since, until time.Time) ([]RiskEvent, error) {
+	riskEventMutex.Lock()
+	defer riskEventMutex.Unlock()
+	f, err := os.Open(conf.Get().Storage.Path(riskEventFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var result []RiskEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e RiskEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !e.Time.Before(since) && e.Time.Before(until) {
+			result = append(result, e)
+		}
+	}
+	return result, scanner.Err()
+}
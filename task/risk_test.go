@@ -0,0 +1,33 @@
+package task_test
+
+import (
+	"math"
+	"testing"
+
+	"deeptrade/conf"
+	"deeptrade/task"
+)
+
+func TestMarginTopUp(t *testing.T) {
+	cases := []struct {
+		name        string
+		distancePct float64
+		available   float64
+		mc          conf.MarginConf
+		want        float64
+	}{
+		{"恢复到目标距离", 4, 1000, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 10}, 120},
+		{"未配置目标时取缓冲的2倍", 4, 1000, conf.MarginConf{LiquidationBufferPct: 5}, 120},
+		{"目标不大于缓冲时取缓冲的2倍", 4, 1000, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 5}, 120},
+		{"单次追加上限", 4, 1000, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 10, MaxAddMargin: 50}, 50},
+		{"可用余额上限", 4, 30, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 10, MaxAddMargin: 50}, 30},
+		{"余额不足0.01时跳过", 4, 0.005, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 10}, 0},
+		{"追加金额不足0.01时跳过", 9.999999, 1000, conf.MarginConf{LiquidationBufferPct: 5, TargetBufferPct: 10}, 0},
+	}
+	for _, c := range cases {
+		// 标记价2000，持仓1张：距离每差1%需追加20 USDT
+		if got := task.MarginTopUp(c.distancePct, 2000, 1, c.available, c.mc); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package task
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/store"
+)
+
+const qtyEpsilon = 1e-9
+
+// tripBuilder 一个持仓方向上正在累计的完整交易
+type tripBuilder struct {
+	trip      store.RoundTrip
+	open      float64 // 当前持仓数量
+	entryCost float64
+	exitCost  float64
+	exitQty   float64
+}
+
+// add 累计一笔成交，qty 可能只是成交的一部分：手续费按数量分摊，已实现盈亏全部来自平仓部分
+func (b *tripBuilder) add(f store.Fill, qty float64, opening bool) {
+	ratio := qty / f.Qty
+	t := &b.trip
+	if n := len(t.Fills); n == 0 || t.Fills[n-1] != f.TradeID {
+		t.Fills = append(t.Fills, f.TradeID)
+	}
+	t.Commission += f.Commission * ratio
+	if opening {
+		t.Entries++
+		t.Qty += qty
+		b.entryCost += f.Price * qty
+		b.open += qty
+		return
+	}
+	t.Exits++
+	t.RealizedPnl += f.RealizedPnl
+	b.exitCost += f.Price * qty
+	b.exitQty += qty
+	b.open -= qty
+	t.ExitTime = f.Time
+}
+
+// finish 持仓归零时计算均价、资金费用和净盈亏
+func (b *tripBuilder) finish(funding []store.FundingPayment) store.RoundTrip {
+	t := b.trip
+	t.EntryPrice = b.entryCost / t.Qty
+	t.ExitPrice = b.exitCost / b.exitQty
+	for _, p := range funding {
+		if !p.Time.Before(t.EntryTime) && !p.Time.After(t.ExitTime) {
+			t.Funding += p.Amount
+		}
+	}
+	t.NetPnl = t.RealizedPnl - t.Commission + t.Funding
+	return t
+}
+
+// BuildRoundTrips 把按时间排序的成交拼接为完整交易：持仓从零开始，经过加仓、部分平仓，回到零时结束。
+// 双向持仓按 LONG/SHORT 分别拼接；单向持仓时一笔成交同时平仓并反手的，拆分为平仓和新开仓两部分。
+// 持仓期间的资金费用计入该笔交易。返回已平仓的交易，以及最早的未平仓交易的开仓时间(全部平仓时为零值)，
+// 下次从该时间重新拼接即可得到相同的结果
+func BuildRoundTrips(fills []store.Fill, funding []store.FundingPayment) ([]store.RoundTrip, time.Time) {
+	var result []store.RoundTrip
+	builders := make(map[string]*tripBuilder)
+	for _, f := range fills {
+		if f.Qty <= 0 {
+			continue
+		}
+		buy := f.Side == string(binance.OrderSideBuy)
+		key := f.PositionSide
+		if key != string(binance.PositionSideLong) && key != string(binance.PositionSideShort) {
+			key = string(binance.PositionSideBoth)
+		}
+		b := builders[key]
+		remaining := f.Qty
+		if b != nil {
+			// 与持仓方向相反的成交为平仓，单向持仓时超出持仓的部分为反手开仓
+			opening := buy == (b.trip.Side == "LONG")
+			qty := remaining
+			if !opening {
+				qty = math.Min(remaining, b.open)
+			}
+			b.add(f, qty, opening)
+			remaining -= qty
+			if b.open < qtyEpsilon {
+				result = append(result, b.finish(funding))
+				delete(builders, key)
+			}
+			if remaining < qtyEpsilon || key != string(binance.PositionSideBoth) {
+				continue
+			}
+		}
+		side := "LONG"
+		if key == string(binance.PositionSideShort) || (key == string(binance.PositionSideBoth) && !buy) {
+			side = "SHORT"
+		}
+		// 没有持仓时的平仓成交属于拼接范围之前开立的持仓，跳过
+		if (side == "LONG") != buy || (remaining == f.Qty && f.RealizedPnl != 0) {
+			continue
+		}
+		b = &tripBuilder{trip: store.RoundTrip{ID: f.TradeID, Symbol: f.Symbol, Side: side, PositionSide: key, EntryTime: f.Time}}
+		b.add(f, remaining, true)
+		builders[key] = b
+	}
+	var resume time.Time
+	for _, b := range builders {
+		if resume.IsZero() || b.trip.EntryTime.Before(resume) {
+			resume = b.trip.EntryTime
+		}
+	}
+	return result, resume
+}
+
+// ApplyExcursions 根据持仓期间的K线计算最大不利偏移和最大有利偏移
+func ApplyExcursions(trip *store.RoundTrip, candles []Candle, interval time.Duration) {
+	if trip.EntryPrice <= 0 {
+		return
+	}
+	high, low := trip.EntryPrice, trip.EntryPrice
+	for _, c := range candles {
+		if c.Time.Add(interval).Before(trip.EntryTime) || c.Time.After(trip.ExitTime) {
+			continue
+		}
+		high, low = math.Max(high, c.High), math.Min(low, c.Low)
+	}
+	up := (high - trip.EntryPrice) / trip.EntryPrice * 100
+	down := (trip.EntryPrice - low) / trip.EntryPrice * 100
+	if trip.Side == "LONG" {
+		trip.MFE, trip.MAE = up, down
+	} else {
+		trip.MFE, trip.MAE = down, up
+	}
+}
+
+// FormatRoundTrips 格式化完整交易，最新的在前
+func FormatRoundTrips(trips []store.RoundTrip) string {
+	var b strings.Builder
+	for i := len(trips) - 1; i >= 0; i-- {
+		t := trips[i]
+		sideName := "多"
+		if t.Side == "SHORT" {
+			sideName = "空"
+		}
+		b.WriteString(fmt.Sprintf("- %s %s 持仓%s: 开仓均价%.2f(%d笔) → 平仓均价%.2f(%d笔) 数量%.4f | 净盈亏%.2f USDT (已实现%.2f 手续费%.2f 资金费%.2f) | MAE %.2f%% MFE %.2f%%\n",
+			t.EntryTime.Format("01-02 15:04"), sideName, formatHoldTime(t.HoldTime()),
+			t.EntryPrice, t.Entries, t.ExitPrice, t.Exits, t.Qty,
+			t.NetPnl, t.RealizedPnl, t.Commission, t.Funding, t.MAE, t.MFE))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatHoldTime 格式化持仓时长
+func formatHoldTime(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%.1f小时", d.Hours())
+	}
+	return fmt.Sprintf("%.0f分钟", d.Minutes())
+}
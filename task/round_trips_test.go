@@ -0,0 +1,65 @@
+package task_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"deeptrade/store"
+	"deeptrade/task"
+)
+
+func TestBuildRoundTrips(t *testing.T) {
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+
+	// 单向持仓：开仓、加仓、部分平仓、平仓并反手
+	fills := []store.Fill{
+		{TradeID: 1, Side: "SELL", PositionSide: "BOTH", Price: 2990, Qty: 1, RealizedPnl: 5, Time: at(0)}, // 拼接范围之前开立的持仓
+		{TradeID: 2, Side: "BUY", PositionSide: "BOTH", Price: 3000, Qty: 1, Commission: 0.5, Time: at(1)},
+		{TradeID: 3, Side: "BUY", PositionSide: "BOTH", Price: 3020, Qty: 1, Commission: 0.5, Time: at(2)},
+		{TradeID: 4, Side: "SELL", PositionSide: "BOTH", Price: 3030, Qty: 1, RealizedPnl: 20, Commission: 0.5, Time: at(5)},
+		{TradeID: 5, Side: "SELL", PositionSide: "BOTH", Price: 3030, Qty: 3, RealizedPnl: 20, Commission: 1.5, Time: at(10)},
+	}
+	funding := []store.FundingPayment{{Amount: -2, Time: at(8)}, {Amount: -3, Time: at(30)}}
+	trips, resume := task.BuildRoundTrips(fills, funding)
+	if len(trips) != 1 {
+		t.Fatalf("应只有一笔完整交易: %+v", trips)
+	}
+	rt := trips[0]
+	if rt.ID != 2 || rt.Side != "LONG" || rt.Qty != 2 || rt.EntryPrice != 3010 || rt.ExitPrice != 3030 || rt.Entries != 2 || rt.Exits != 2 {
+		t.Errorf("开平仓信息错误: %+v", rt)
+	}
+	// 反手成交按数量拆分：平仓部分承担1/3的手续费和全部已实现盈亏
+	if math.Abs(rt.Commission-2) > 1e-9 || rt.RealizedPnl != 40 || rt.Funding != -2 || math.Abs(rt.NetPnl-(40-2-2)) > 1e-9 {
+		t.Errorf("盈亏拆分错误: %+v", rt)
+	}
+	if rt.HoldTime() != 9*time.Minute {
+		t.Errorf("持仓时长错误: %v", rt.HoldTime())
+	}
+	if !resume.Equal(at(10)) {
+		t.Errorf("反手后的空仓未平仓，应从其开仓时间重新拼接: %v", resume)
+	}
+
+	// 双向持仓：多空分别拼接
+	fills = []store.Fill{
+		{TradeID: 10, Side: "BUY", PositionSide: "LONG", Price: 3000, Qty: 1, Time: at(0)},
+		{TradeID: 11, Side: "SELL", PositionSide: "SHORT", Price: 3000, Qty: 1, Time: at(1)},
+		{TradeID: 12, Side: "SELL", PositionSide: "LONG", Price: 3010, Qty: 1, RealizedPnl: 10, Time: at(2)},
+		{TradeID: 13, Side: "BUY", PositionSide: "SHORT", Price: 2980, Qty: 1, RealizedPnl: 20, Time: at(3)},
+	}
+	trips, resume = task.BuildRoundTrips(fills, nil)
+	if len(trips) != 2 || trips[0].Side != "LONG" || trips[1].Side != "SHORT" || trips[1].NetPnl != 20 || !resume.IsZero() {
+		t.Errorf("双向持仓拼接错误: %+v %v", trips, resume)
+	}
+
+	candles := []task.Candle{
+		{Time: at(0), High: 3005, Low: 2990},
+		{Time: at(1), High: 3030, Low: 2995},
+		{Time: at(5), High: 3100, Low: 2900}, // 平仓之后
+	}
+	task.ApplyExcursions(&trips[0], candles, time.Minute)
+	if math.Abs(trips[0].MFE-1) > 1e-9 || math.Abs(trips[0].MAE-10.0/3000*100) > 1e-9 {
+		t.Errorf("MAE/MFE错误: %+v", trips[0])
+	}
+}
@@ -0,0 +1,190 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/prompt"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	shadowFile     = "shadow.jsonl"
+	ChampionName   = "champion" // 实盘决策在影子记录中的名称
+	shadowCallTime = 5 * time.Minute
+)
+
+// ShadowDecision 影子模式中一次决策的记录，实盘决策同样记录以便按相同规则模拟对比
+type ShadowDecision struct {
+	Time          time.Time      `json:"time"` // 决策轮次时间，同一轮的实盘和挑战者相同
+	Name          string         `json:"name"`
+	Model         string         `json:"model"`
+	PromptVersion string         `json:"prompt_version"`
+	Price         float64        `json:"price"`              // 决策时的价格
+	Position      string         `json:"position,omitempty"` // 提示词中的实盘持仓方向 LONG/SHORT/NONE，为空表示未记录
+	Signal        *TradingSignal `json:"signal,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// shadowInput 影子模式的输入，与实盘使用相同的行情数据
+type shadowInput struct {
+	cycle       time.Time
+	data        PromptData
+	prompts     *prompt.Set // 实盘使用的提示词
+	system      string
+	message     *schema.Message
+	userBudget  int
+	marketData  *MarketData
+	hasPosition bool
+}
+
+var shadowMutex sync.Mutex
+
+// runShadow 记录实盘决策，并在后台请求各挑战者的信号，挑战者的信号只记录不执行
+func runShadow(ctx context.Context, in shadowInput, champion *TradingSignal, record *DecisionRecord, championErr error) {
+	cfg := conf.Get().Shadow
+	if !cfg.Enable {
+		return
+	}
+	price := currentPriceOf(in.marketData)
+	position := promptPosition(in.marketData)
+	decision := ShadowDecision{Time: in.cycle, Name: ChampionName, PromptVersion: in.prompts.Version, Price: price, Position: position, Signal: champion}
+	if n := len(record.Stages); n > 0 {
+		decision.Model = record.Stages[n-1].Model
+	}
+	if championErr != nil {
+		decision.Error = championErr.Error()
+	}
+	saveShadowDecision(ctx, decision)
+
+	for _, challenger := range cfg.Challengers {
+		challenger := challenger
+		go func() {
+			callCtx, cancel := context.WithTimeout(ctx, shadowCallTime)
+			defer cancel()
+			d := runChallenger(callCtx, challenger, in)
+			d.Time, d.Price, d.Position = in.cycle, price, position
+			if d.Error != "" {
+				logger.Warnf(ctx, "[影子模式] %s 决策失败: %s", d.Name, d.Error)
+			} else {
+				logger.Infof(ctx, "[影子模式] %s: %s (评分: %d, 置信度: %.2f)", d.Name, d.Signal.Action, d.Signal.Score, d.Signal.Confidence)
+			}
+			saveShadowDecision(ctx, d)
+		}()
+	}
+}
+
+// promptPosition 提示词中描述的实盘持仓方向，挑战者使用相同的持仓信息和角色
+func promptPosition(marketData *MarketData) string {
+	switch {
+	case marketData.PositionInfo.HasLong:
+		return "LONG"
+	case marketData.PositionInfo.HasShort:
+		return "SHORT"
+	}
+	return "NONE"
+}
+
+// runChallenger 用挑战者的模型和提示词版本请求交易信号
+func runChallenger(ctx context.Context, challenger conf.ShadowChallengerConf, in shadowInput) ShadowDecision {
+	d := ShadowDecision{Name: challenger.Name, Model: challenger.Model, PromptVersion: in.prompts.Version}
+	if d.Name == "" {
+		d.Name = challenger.Model + "@" + challenger.PromptVersion
+	}
+	fail := func(err error) ShadowDecision {
+		d.Error = err.Error()
+		return d
+	}
+
+	system, message := in.system, in.message
+	if challenger.PromptVersion != "" && challenger.PromptVersion != in.prompts.Version {
+		prompts, err := prompt.Get(challenger.PromptVersion)
+		if err != nil {
+			return fail(err)
+		}
+		d.PromptVersion = prompts.Version
+		if system, err = prompts.Render(prompt.System, in.data); err != nil {
+			return fail(err)
+		}
+		built, err := prompts.Build(prompt.User, in.data, conf.Get().Prompt.SectionPriority, in.userBudget)
+		if err != nil {
+			return fail(err)
+		}
+		message = schema.UserMessage(built.Text)
+	}
+
+	var llmconf conf.LLMConf
+	if challenger.Model != "" {
+		var ok bool
+		if llmconf, ok = conf.Get().GetLLMByModel(challenger.Model); !ok {
+			return fail(fmt.Errorf("模型%s未配置", challenger.Model))
+		}
+	}
+	signal, err := requestSignal(ctx, func(msgs []*schema.Message) (string, error) {
+		req := utils.Request{System: system, Messages: msgs, Output: signalOutput}
+		if challenger.Model == "" {
+			content, model, err := utils.Generate(ctx, in.hasPosition, req)
+			d.Model = model
+			return content, err
+		}
+		return utils.GenerateModel(ctx, llmconf, req)
+	}, message, in.marketData)
+	if err != nil {
+		return fail(err)
+	}
+	d.Signal = signal
+	return d
+}
+
+// saveShadowDecision 追加写入影子记录
+func saveShadowDecision(ctx context.Context, d ShadowDecision) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	shadowMutex.Lock()
+	defer shadowMutex.Unlock()
+	f, err := os.OpenFile(conf.Get().Storage.Path(shadowFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[影子模式] 写入影子记录失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// LoadShadowDecisions 读取时间范围内的影子记录
+func LoadShadowDecisions(since, until time.Time) ([]ShadowDecision, error) {
+	shadowMutex.Lock()
+	defer shadowMutex.Unlock()
+	f, err := os.Open(conf.Get().Storage.Path(shadowFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var result []ShadowDecision
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var d ShadowDecision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			continue
+		}
+		if !d.Time.Before(since) && d.Time.Before(until) {
+			result = append(result, d)
+		}
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,392 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/utils"
+)
+
+// Candle 用于模拟的K线
+type Candle struct {
+	Time  time.Time // 开盘时间
+	High  float64
+	Low   float64
+	Close float64
+}
+
+// VirtualTrade 虚拟账户的一笔交易
+type VirtualTrade struct {
+	Side       string    `json:"side"` // LONG/SHORT
+	EntryTime  time.Time `json:"entry_time"`
+	ExitTime   time.Time `json:"exit_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitPrice  float64   `json:"exit_price"`
+	Qty        float64   `json:"qty"`
+	Pnl        float64   `json:"pnl"` // 扣除手续费后的盈亏
+	Reason     string    `json:"reason"`
+}
+
+// PortfolioResult 虚拟账户的模拟结果
+type PortfolioResult struct {
+	Name           string         `json:"name"`
+	Model          string         `json:"model"`
+	PromptVersion  string         `json:"prompt_version"`
+	Decisions      int            `json:"decisions"`
+	Errors         int            `json:"errors"`
+	Mismatched     int            `json:"mismatched"` // 提示词持仓与虚拟持仓不符而未执行的挑战者决策数
+	Actions        map[string]int `json:"actions"`
+	Agreement      float64        `json:"agreement"` // 与实盘同一轮动作相同的比例(%)，不含持仓不符的轮次
+	Trades         []VirtualTrade `json:"trades"`
+	Wins           int            `json:"wins"`
+	WinRate        float64        `json:"win_rate"` // 胜率(%)
+	Fees           float64        `json:"fees"`
+	NetPnl         float64        `json:"net_pnl"` // 已平仓净盈亏
+	Unrealized     float64        `json:"unrealized"`
+	FinalEquity    float64        `json:"final_equity"` // 含未平仓浮动盈亏
+	ReturnPct      float64        `json:"return_pct"`
+	MaxDrawdownPct float64        `json:"max_drawdown_pct"`
+	OpenSide       string         `json:"open_side,omitempty"`
+}
+
+// ShadowReport 实盘与挑战者的对比报告，实盘排在第一位
+type ShadowReport struct {
+	Since   time.Time         `json:"since"`
+	Until   time.Time         `json:"until"`
+	Results []PortfolioResult `json:"results"`
+}
+
+// virtualPosition 虚拟持仓
+type virtualPosition struct {
+	side       string
+	entryTime  time.Time
+	entryPrice float64
+	qty        float64
+	stopLoss   float64
+	takeProfit float64
+}
+
+func (p *virtualPosition) pnl(price float64) float64 {
+	if p.side == "SHORT" {
+		return p.qty * (p.entryPrice - price)
+	}
+	return p.qty * (price - p.entryPrice)
+}
+
+// virtualAccount 按实盘规则执行信号的虚拟账户
+type virtualAccount struct {
+	equity  float64 // 已实现权益
+	feeRate float64
+	pos     *virtualPosition
+	peak    float64
+	result  *PortfolioResult
+}
+
+// apply 执行一个信号，与实盘一致：开仓名义金额 = 权益 × 仓位百分比 × 杠杆，与持仓方向不符的信号忽略
+func (a *virtualAccount) apply(t time.Time, price float64, s *TradingSignal) {
+	if price <= 0 {
+		return
+	}
+	switch s.Action {
+	case "OPEN_LONG", "OPEN_SHORT", "ADD_LONG", "ADD_SHORT":
+		side := s.Action[strings.Index(s.Action, "_")+1:]
+		isAdd := strings.HasPrefix(s.Action, "ADD_")
+		if (a.pos == nil) == isAdd || (a.pos != nil && a.pos.side != side) {
+			return
+		}
+		size := float64(s.PositionSize)
+		if size <= 0 {
+			size = 20
+		}
+		qty := a.equity * size / 100 * float64(signalLeverage(s)) / price
+		a.fee(qty * price)
+		if a.pos == nil {
+			a.pos = &virtualPosition{side: side, entryTime: t, entryPrice: price, qty: qty}
+		} else {
+			a.pos.entryPrice = (a.pos.entryPrice*a.pos.qty + price*qty) / (a.pos.qty + qty)
+			a.pos.qty += qty
+		}
+		a.setSLTP(s)
+	case "ADJUST_SL_TP":
+		if a.pos != nil {
+			a.setSLTP(s)
+		}
+	case "CLOSE_LONG", "CLOSE_SHORT":
+		if a.pos != nil && a.pos.side == strings.TrimPrefix(s.Action, "CLOSE_") {
+			a.close(t, price, "信号平仓")
+		}
+	}
+}
+
+func (a *virtualAccount) setSLTP(s *TradingSignal) {
+	if s.StopLoss > 0 {
+		a.pos.stopLoss = s.StopLoss
+	}
+	if s.TakeProfit > 0 {
+		a.pos.takeProfit = s.TakeProfit
+	}
+}
+
+func (a *virtualAccount) fee(notional float64) {
+	fee := notional * a.feeRate
+	a.equity -= fee
+	a.result.Fees += fee
+}
+
+func (a *virtualAccount) close(t time.Time, price float64, reason string) {
+	p := a.pos
+	a.pos = nil
+	pnl := p.pnl(price)
+	a.equity += pnl
+	a.fee(p.qty * price)
+	// 开仓手续费已从权益扣除，这里计入单笔交易的净盈亏
+	net := pnl - p.qty*(p.entryPrice+price)*a.feeRate
+	a.result.Trades = append(a.result.Trades, VirtualTrade{
+		Side: p.side, EntryTime: p.entryTime, ExitTime: t, EntryPrice: p.entryPrice, ExitPrice: price, Qty: p.qty, Pnl: net, Reason: reason,
+	})
+}
+
+// checkStops 检查K线内是否触发止损止盈，同一根K线同时触及时按先止损处理
+func (a *virtualAccount) checkStops(c Candle) {
+	p := a.pos
+	if p == nil {
+		return
+	}
+	long := p.side == "LONG"
+	switch {
+	case p.stopLoss > 0 && ((long && c.Low <= p.stopLoss) || (!long && c.High >= p.stopLoss)):
+		a.close(c.Time, p.stopLoss, "止损")
+	case p.takeProfit > 0 && ((long && c.High >= p.takeProfit) || (!long && c.Low <= p.takeProfit)):
+		a.close(c.Time, p.takeProfit, "止盈")
+	}
+}
+
+// mark 按价格计算含浮动盈亏的权益并更新最大回撤
+func (a *virtualAccount) mark(price float64) {
+	equity := a.equity
+	if a.pos != nil {
+		equity += a.pos.pnl(price)
+	}
+	if equity > a.peak {
+		a.peak = equity
+	}
+	if a.peak > 0 {
+		if dd := (a.peak - equity) / a.peak * 100; dd > a.result.MaxDrawdownPct {
+			a.result.MaxDrawdownPct = dd
+		}
+	}
+}
+
+// side 虚拟持仓方向，无持仓时为 NONE
+func (a *virtualAccount) side() string {
+	if a.pos == nil {
+		return "NONE"
+	}
+	return a.pos.side
+}
+
+// SimulatePortfolio 用真实K线模拟一组决策的虚拟账户：决策按记录的价格成交，决策之间按K线最高最低价检查止损止盈。
+// 挑战者按实盘持仓决策，提示词中的持仓与虚拟持仓不符的决策不执行
+func SimulatePortfolio(decisions []ShadowDecision, candles []Candle, initialEquity, feeRate float64) PortfolioResult {
+	result, _ := simulatePortfolio(decisions, candles, initialEquity, feeRate)
+	return result
+}
+
+// simulatePortfolio 同 SimulatePortfolio，并返回实际执行的决策
+func simulatePortfolio(decisions []ShadowDecision, candles []Candle, initialEquity, feeRate float64) (PortfolioResult, []ShadowDecision) {
+	decisions = append([]ShadowDecision{}, decisions...)
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Time.Before(decisions[j].Time) })
+	result := PortfolioResult{Actions: map[string]int{}}
+	if len(decisions) > 0 {
+		result.Name, result.Model, result.PromptVersion = decisions[0].Name, decisions[0].Model, decisions[0].PromptVersion
+	}
+	acc := &virtualAccount{equity: initialEquity, feeRate: feeRate, peak: initialEquity, result: &result}
+
+	lastPrice := 0.0
+	var applied []ShadowDecision
+	apply := func(d ShadowDecision) {
+		result.Decisions++
+		if d.Signal == nil {
+			result.Errors++
+			return
+		}
+		if d.Name != ChampionName && d.Position != "" && d.Position != acc.side() {
+			result.Mismatched++
+			return
+		}
+		result.Actions[d.Signal.Action]++
+		applied = append(applied, d)
+		acc.apply(d.Time, d.Price, d.Signal)
+		if d.Price > 0 {
+			lastPrice = d.Price
+		}
+	}
+
+	i := 0
+	for _, c := range candles {
+		for ; i < len(decisions) && decisions[i].Time.Before(c.Time); i++ {
+			apply(decisions[i])
+		}
+		if i == 0 {
+			continue // 第一次决策之前的K线不参与模拟
+		}
+		acc.checkStops(c)
+		acc.mark(c.Close)
+		lastPrice = c.Close
+	}
+	for ; i < len(decisions); i++ {
+		apply(decisions[i])
+	}
+	acc.mark(lastPrice)
+
+	for _, t := range result.Trades {
+		result.NetPnl += t.Pnl
+		if t.Pnl > 0 {
+			result.Wins++
+		}
+	}
+	if len(result.Trades) > 0 {
+		result.WinRate = float64(result.Wins) / float64(len(result.Trades)) * 100
+	}
+	result.FinalEquity = acc.equity
+	if acc.pos != nil {
+		result.OpenSide = acc.pos.side
+		result.Unrealized = acc.pos.pnl(lastPrice)
+		result.FinalEquity += result.Unrealized
+	}
+	if initialEquity > 0 {
+		result.ReturnPct = (result.FinalEquity - initialEquity) / initialEquity * 100
+	}
+	return result, applied
+}
+
+// NewShadowReport 按名称分组模拟各虚拟账户，并计算挑战者实际执行的决策与实盘动作的一致率
+func NewShadowReport(decisions []ShadowDecision, candles []Candle, initialEquity, feeRate float64) *ShadowReport {
+	groups := map[string][]ShadowDecision{}
+	championActions := map[time.Time]string{}
+	report := &ShadowReport{}
+	for _, d := range decisions {
+		groups[d.Name] = append(groups[d.Name], d)
+		if d.Name == ChampionName && d.Signal != nil {
+			championActions[d.Time] = d.Signal.Action
+		}
+		if report.Since.IsZero() || d.Time.Before(report.Since) {
+			report.Since = d.Time
+		}
+		if d.Time.After(report.Until) {
+			report.Until = d.Time
+		}
+	}
+	for name, group := range groups {
+		result, applied := simulatePortfolio(group, candles, initialEquity, feeRate)
+		if name != ChampionName {
+			var compared, same int
+			for _, d := range applied {
+				if action, ok := championActions[d.Time]; ok {
+					compared++
+					if d.Signal.Action == action {
+						same++
+					}
+				}
+			}
+			if compared > 0 {
+				result.Agreement = float64(same) / float64(compared) * 100
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		ri, rj := report.Results[i], report.Results[j]
+		if (ri.Name == ChampionName) != (rj.Name == ChampionName) {
+			return ri.Name == ChampionName
+		}
+		return ri.ReturnPct > rj.ReturnPct
+	})
+	return report
+}
+
+// BuildShadowReport 读取最近 days 天的影子记录，用3分钟K线模拟并生成对比报告
+func BuildShadowReport(ctx context.Context, days int) (*ShadowReport, error) {
+	if days <= 0 {
+		days = 7
+	}
+	until := time.Now()
+	decisions, err := LoadShadowDecisions(until.AddDate(0, 0, -days), until)
+	if err != nil {
+		return nil, fmt.Errorf("读取影子记录失败: %v", err)
+	}
+	if len(decisions) == 0 {
+		return &ShadowReport{}, nil
+	}
+	since := decisions[0].Time
+	for _, d := range decisions {
+		if d.Time.Before(since) {
+			since = d.Time
+		}
+	}
+	candles, err := fetchCandles(ctx, binance.KlineInterval3m, since, until)
+	if err != nil {
+		return nil, err
+	}
+	cfg := conf.Get().Shadow
+	return NewShadowReport(decisions, candles, cfg.InitialEquity, cfg.FeeRate), nil
+}
+
+// fetchCandles 分页获取时间范围内的K线，包含 since 所在的K线
+func fetchCandles(ctx context.Context, interval binance.KlineInterval, since, until time.Time) ([]Candle, error) {
+	const pageSize = 1500
+	client := binance.GetOnceFuturesClient()
+	var candles []Candle
+	start := since.Add(-intervalDuration(interval)).UnixMilli()
+	for start < until.UnixMilli() {
+		klines, err := client.GetKlinesRange(ctx, binance.ETHUSDT_PERP, interval, start, until.UnixMilli(), pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("获取K线失败: %v", err)
+		}
+		for _, k := range klines {
+			candles = append(candles, Candle{
+				Time:  time.UnixMilli(k.OpenTime),
+				High:  utils.ParseFloatSafe(k.High, 0),
+				Low:   utils.ParseFloatSafe(k.Low, 0),
+				Close: utils.ParseFloatSafe(k.Close, 0),
+			})
+		}
+		if len(klines) < pageSize-1 {
+			break
+		}
+		start = klines[len(klines)-1].OpenTime + 1
+	}
+	return candles, nil
+}
+
+// intervalDuration K线周期的时长，日线及以上按天计算
+func intervalDuration(interval binance.KlineInterval) time.Duration {
+	if d, err := time.ParseDuration(string(interval)); err == nil {
+		return d
+	}
+	switch interval {
+	case binance.KlineInterval1d:
+		return 24 * time.Hour
+	case binance.KlineInterval3d:
+		return 3 * 24 * time.Hour
+	case binance.KlineInterval1w:
+		return 7 * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Format 格式化对比报告，用于日志
+func (r *ShadowReport) Format() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("影子模式对比 %s ~ %s\n", r.Since.Format("01-02 15:04"), r.Until.Format("01-02 15:04")))
+	for _, res := range r.Results {
+		b.WriteString(fmt.Sprintf("- %s(%s@%s): 收益%.2f%% 净盈亏%.2f 交易%d笔 胜率%.1f%% 最大回撤%.2f%% 一致率%.1f%% 持仓不符%d 失败%d/%d\n",
+			res.Name, res.Model, res.PromptVersion, res.ReturnPct, res.NetPnl, len(res.Trades), res.WinRate, res.MaxDrawdownPct, res.Agreement, res.Mismatched, res.Errors, res.Decisions))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
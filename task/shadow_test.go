@@ -0,0 +1,64 @@
+package task_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"deeptrade/task"
+)
+
+func TestSimulatePortfolio(t *testing.T) {
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	candles := []task.Candle{
+		{Time: at(0), High: 3005, Low: 2995, Close: 3000},
+		{Time: at(3), High: 3020, Low: 2998, Close: 3015},
+		{Time: at(6), High: 3060, Low: 3010, Close: 3050}, // 触发止盈3050
+		{Time: at(9), High: 3055, Low: 3040, Close: 3045},
+		{Time: at(12), High: 3050, Low: 3000, Close: 3010},
+		{Time: at(15), High: 3065, Low: 3005, Close: 3060}, // 空单浮亏
+	}
+	decisions := []task.ShadowDecision{
+		{Time: at(1), Name: "c", Price: 3000, Signal: &task.TradingSignal{Action: "OPEN_LONG", PositionSize: 50, Confidence: 0.6, StopLoss: 2950, TakeProfit: 3050}},
+		{Time: at(10), Name: "c", Price: 3045, Signal: &task.TradingSignal{Action: "OPEN_SHORT", PositionSize: 50, Confidence: 0.6}},
+		{Time: at(11), Name: "c", Price: 3040},
+	}
+	res := task.SimulatePortfolio(decisions, candles, 1000, 0)
+	if len(res.Trades) != 1 || res.Trades[0].Reason != "止盈" || res.Trades[0].ExitPrice != 3050 {
+		t.Fatalf("止盈模拟错误: %+v", res.Trades)
+	}
+	// 1000 × 50% × 2倍杠杆 = 1000 名义金额，上涨50点盈利约16.67
+	if math.Abs(res.NetPnl-1000.0/3000*50) > 1e-6 {
+		t.Errorf("盈亏错误: %v", res.NetPnl)
+	}
+	if res.OpenSide != "SHORT" || res.Errors != 1 || res.Decisions != 3 {
+		t.Errorf("持仓或计数错误: %+v", res)
+	}
+	if res.Unrealized >= 0 || res.ReturnPct <= 0 || res.MaxDrawdownPct <= 0 {
+		t.Errorf("权益统计错误: %+v", res)
+	}
+
+	decisions = append(decisions,
+		task.ShadowDecision{Time: at(1), Name: task.ChampionName, Price: 3000, Signal: &task.TradingSignal{Action: "HOLD"}},
+		task.ShadowDecision{Time: at(10), Name: task.ChampionName, Price: 3045, Signal: &task.TradingSignal{Action: "OPEN_SHORT"}},
+	)
+	report := task.NewShadowReport(decisions, candles, 1000, 0.0005)
+	if len(report.Results) != 2 || report.Results[0].Name != task.ChampionName {
+		t.Fatalf("报告应以实盘开头: %+v", report.Results)
+	}
+	if report.Results[1].Agreement != 50 || report.Results[1].Fees <= 0 {
+		t.Errorf("一致率或手续费错误: %+v", report.Results[1])
+	}
+
+	// 挑战者按实盘持仓（多头）决策，但虚拟账户持有空单，该轮不执行也不计入一致率
+	decisions = append(decisions,
+		task.ShadowDecision{Time: at(13), Name: "c", Price: 3010, Position: "LONG", Signal: &task.TradingSignal{Action: "CLOSE_SHORT"}},
+		task.ShadowDecision{Time: at(13), Name: task.ChampionName, Price: 3010, Position: "LONG", Signal: &task.TradingSignal{Action: "CLOSE_SHORT"}},
+	)
+	report = task.NewShadowReport(decisions, candles, 1000, 0)
+	c := report.Results[1]
+	if c.Mismatched != 1 || c.Agreement != 50 || c.OpenSide != "SHORT" || c.Actions["CLOSE_SHORT"] != 0 {
+		t.Errorf("持仓不符的决策不应执行或计入一致率: %+v", c)
+	}
+}
@@ -0,0 +1,275 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"deeptrade/logger"
+	"deeptrade/utils"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 合法的交易动作
+var signalActions = []string{"OPEN_LONG", "OPEN_SHORT", "CLOSE_LONG", "CLOSE_SHORT", "ADD_LONG", "ADD_SHORT", "ADJUST_SL_TP", "HOLD"}
+
+// signalOutput 交易信号的结构化输出定义
+var signalOutput = &utils.StructuredOutput{
+	Name: "submit_trading_signal",
+	Desc: "提交本轮交易决策信号",
+	Params: map[string]*schema.ParameterInfo{
+		"action":        {Type: schema.String, Desc: "交易动作", Enum: signalActions, Required: true},
+		"score":         {Type: schema.Integer, Desc: "决策强度 -10到+10，正数多头，负数空头", Required: true},
+		"confidence":    {Type: schema.Number, Desc: "信心度 0.0-1.0", Required: true},
+		"stop_loss":     {Type: schema.Number, Desc: "止损价格，HOLD和平仓时为0", Required: true},
+		"take_profit":   {Type: schema.Number, Desc: "止盈价格，HOLD和平仓时为0", Required: true},
+		"position_size": {Type: schema.Integer, Desc: "仓位百分比 0-100", Required: true},
+		"reasoning":     {Type: schema.String, Desc: "决策理由", Required: true},
+		"memory": {Type: schema.Array, Desc: "需要保留的全部记忆，未列出的记忆将被删除", Required: true, ElemInfo: &schema.ParameterInfo{
+			Type: schema.Object,
+			SubParams: map[string]*schema.ParameterInfo{
+				"type":      {Type: schema.String, Desc: "记忆类型", Enum: memoryTypes, Required: true},
+				"key":       {Type: schema.String, Desc: "记忆键", Required: true},
+				"value":     {Type: schema.String, Desc: "记忆内容", Required: true},
+				"ttl_hours": {Type: schema.Number, Desc: "有效期(小时)，0表示使用默认有效期"},
+			},
+		}},
+	},
+}
+
+// requestSignal 请求交易信号并校验，校验失败时带上错误原因让模型修正一次
+func requestSignal(ctx context.Context, call func(msgs []*schema.Message) (string, error), userMsg *schema.Message, marketData *MarketData) (*TradingSignal, error) {
+	msgs := []*schema.Message{userMsg}
+	response, err := call(msgs)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf(ctx, "[LLM分析] LLM原始响应: %s", response)
+
+	signal, err := ParseLLMResponse(response)
+	if err == nil {
+		err = ValidateSignal(signal, currentPriceOf(marketData), marketData.PositionInfo)
+	}
+	if err == nil {
+		return signal, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	logger.Warnf(ctx, "[LLM分析] 信号校验失败，请求模型修正: %v", err)
+	msgs = append(msgs,
+		schema.AssistantMessage(response, nil),
+		schema.UserMessage(fmt.Sprintf("你上一次输出的交易信号未通过程序校验: %v\n请按输出规范修正后重新输出，只输出一个JSON对象，不要输出其他内容。", err)),
+	)
+	response, err = call(msgs)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf(ctx, "[LLM分析] LLM修正响应: %s", response)
+	signal, err = ParseLLMResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateSignal(signal, currentPriceOf(marketData), marketData.PositionInfo); err != nil {
+		return nil, fmt.Errorf("修正后仍未通过校验: %v", err)
+	}
+	return signal, nil
+}
+
+// fixTrailingDecimalPoint 把字符串值之外以小数点结尾的数字(如 0.)补全为 0.0，字符串中的内容不修改
+func fixTrailingDecimalPoint(text string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		b.WriteByte(c)
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '.' && i > 0 && text[i-1] >= '0' && text[i-1] <= '9':
+			j := i + 1
+			for j < len(text) && strings.IndexByte(" \t\r\n", text[j]) >= 0 {
+				j++
+			}
+			if j == len(text) || strings.IndexByte(",}]", text[j]) >= 0 {
+				b.WriteByte('0')
+			}
+		}
+	}
+	return b.String()
+}
+
+// ParseLLMResponse 解析LLM响应，兼容代码块、推理文字和嵌套括号
+func ParseLLMResponse(response string) (*TradingSignal, error) {
+	candidates := extractJSONObjects(response)
+	var lastErr error
+	for i := len(candidates) - 1; i >= 0; i-- {
+		// 推理文字中也可能出现JSON，优先使用最后一个包含action的对象
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(candidates[i]), &fields); err != nil {
+			// 兼容模型输出 0., 这类不完整的小数
+			candidates[i] = fixTrailingDecimalPoint(candidates[i])
+			if err := json.Unmarshal([]byte(candidates[i]), &fields); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		if _, ok := fields["action"]; !ok {
+			continue
+		}
+		var signal TradingSignal
+		if err := json.Unmarshal([]byte(candidates[i]), &signal); err != nil {
+			lastErr = err
+			continue
+		}
+		signal.Action = strings.ToUpper(strings.TrimSpace(signal.Action))
+		return &signal, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("未找到包含action的JSON对象")
+	}
+	return nil, fmt.Errorf("解析LLM响应失败 response: %v  err: %v", response, lastErr)
+}
+
+// ValidateSignal 严格校验交易信号，currentPrice 为0时不校验止损止盈方向
+func ValidateSignal(signal *TradingSignal, currentPrice float64, positionInfo *PositionInfo) error {
+	if signal == nil {
+		return fmt.Errorf("交易信号为空")
+	}
+	valid := false
+	for _, action := range signalActions {
+		if signal.Action == action {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("action必须是%v之一，实际为%q", signalActions, signal.Action)
+	}
+	if signal.Score < -10 || signal.Score > 10 {
+		return fmt.Errorf("score必须在-10到10之间，实际为%d", signal.Score)
+	}
+	if signal.Confidence < 0 || signal.Confidence > 1 {
+		return fmt.Errorf("confidence必须在0到1之间，实际为%v", signal.Confidence)
+	}
+	if signal.StopLoss < 0 || signal.TakeProfit < 0 {
+		return fmt.Errorf("stop_loss和take_profit不能为负数")
+	}
+
+	switch {
+	case signal.Action == "HOLD":
+		if signal.PositionSize != 0 || signal.StopLoss != 0 || signal.TakeProfit != 0 {
+			return fmt.Errorf("HOLD时stop_loss、take_profit、position_size必须为0")
+		}
+		return nil
+	case isCloseAction(signal.Action):
+		if signal.StopLoss != 0 || signal.TakeProfit != 0 {
+			return fmt.Errorf("%s时stop_loss和take_profit必须为0", signal.Action)
+		}
+		if signal.PositionSize <= 0 || signal.PositionSize > 100 {
+			return fmt.Errorf("%s时position_size必须在1到100之间，实际为%d", signal.Action, signal.PositionSize)
+		}
+		return nil
+	case isAdjustSLTPAction(signal.Action):
+		if signal.PositionSize != 0 {
+			return fmt.Errorf("ADJUST_SL_TP时position_size必须为0")
+		}
+		if signal.StopLoss == 0 || signal.TakeProfit == 0 {
+			return fmt.Errorf("ADJUST_SL_TP时stop_loss和take_profit必须填写")
+		}
+		if positionInfo != nil && positionInfo.HasLong != positionInfo.HasShort {
+			return validateSLTPSide(signal, currentPrice, positionInfo.HasLong)
+		}
+		return nil
+	default:
+		if signal.PositionSize <= 0 || signal.PositionSize > 100 {
+			return fmt.Errorf("%s时position_size必须在1到100之间，实际为%d", signal.Action, signal.PositionSize)
+		}
+		return validateSLTPSide(signal, currentPrice, strings.HasSuffix(signal.Action, "_LONG"))
+	}
+}
+
+// validateSLTPSide 校验止损止盈在当前价格的正确一侧
+func validateSLTPSide(signal *TradingSignal, currentPrice float64, isLong bool) error {
+	if currentPrice <= 0 {
+		return nil
+	}
+	if isLong {
+		if signal.StopLoss > 0 && signal.StopLoss >= currentPrice {
+			return fmt.Errorf("多头止损%.2f必须低于当前价格%.2f", signal.StopLoss, currentPrice)
+		}
+		if signal.TakeProfit > 0 && signal.TakeProfit <= currentPrice {
+			return fmt.Errorf("多头止盈%.2f必须高于当前价格%.2f", signal.TakeProfit, currentPrice)
+		}
+		return nil
+	}
+	if signal.StopLoss > 0 && signal.StopLoss <= currentPrice {
+		return fmt.Errorf("空头止损%.2f必须高于当前价格%.2f", signal.StopLoss, currentPrice)
+	}
+	if signal.TakeProfit > 0 && signal.TakeProfit >= currentPrice {
+		return fmt.Errorf("空头止盈%.2f必须低于当前价格%.2f", signal.TakeProfit, currentPrice)
+	}
+	return nil
+}
+
+// extractJSONObjects 提取文本中所有顶层JSON对象，忽略字符串内的括号
+func extractJSONObjects(text string) []string {
+	var result []string
+	depth, start := 0, -1
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			if depth > 0 {
+				inString = true
+			}
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				result = append(result, text[start:i+1])
+			}
+		}
+	}
+	return result
+}
+
+// currentPriceOf 获取行情中的最新价格
+func currentPriceOf(marketData *MarketData) float64 {
+	if marketData == nil || marketData.Ticker == nil {
+		return 0
+	}
+	price, _ := strconv.ParseFloat(marketData.Ticker.LastPrice, 64)
+	return price
+}
@@ -0,0 +1,72 @@
+package task_test
+
+import (
+	"testing"
+
+	"deeptrade/task"
+)
+
+func TestParseLLMResponse(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		action   string
+	}{
+		{"纯JSON", `{"action":"HOLD","score":0,"confidence":0.3}`, "HOLD"},
+		{"代码块", "分析如下\n```json\n{\"action\": \"OPEN_LONG\", \"score\": 6, \"confidence\": 0.7, \"position_size\": 30}\n```", "OPEN_LONG"},
+		{"推理含括号", `先看指标{RSI偏高}，结论 {"action":"OPEN_SHORT","reasoning":"阻力位{3000}","memory":"a:1|b:{x}"}`, "OPEN_SHORT"},
+		{"不完整小数", `{"action":"hold","score":0,"confidence":0.,"stop_loss":0}`, "HOLD"},
+		{"不完整小数在末尾", `{"action":"HOLD","confidence":1.}`, "HOLD"},
+	}
+	for _, tc := range cases {
+		signal, err := task.ParseLLMResponse(tc.response)
+		if err != nil {
+			t.Errorf("%s: 解析失败: %v", tc.name, err)
+			continue
+		}
+		if signal.Action != tc.action {
+			t.Errorf("%s: action=%s, want %s", tc.name, signal.Action, tc.action)
+		}
+	}
+
+	// 只补全数字，字符串中的 ., 保持原样
+	signal, err := task.ParseLLMResponse(`{"action":"HOLD","confidence":0.,"reasoning":"支撑位3000.,阻力位3200.}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signal.Confidence != 0 || signal.Reasoning != "支撑位3000.,阻力位3200.}" {
+		t.Errorf("不应修改字符串内容: %+v", signal)
+	}
+
+	if _, err := task.ParseLLMResponse("没有JSON"); err == nil {
+		t.Error("无JSON时应返回错误")
+	}
+}
+
+func TestValidateSignal(t *testing.T) {
+	long := &task.PositionInfo{HasLong: true}
+	cases := []struct {
+		name   string
+		signal task.TradingSignal
+		pos    *task.PositionInfo
+		ok     bool
+	}{
+		{"合法开多", task.TradingSignal{Action: "OPEN_LONG", Score: 6, Confidence: 0.7, StopLoss: 2900, TakeProfit: 3200, PositionSize: 30}, nil, true},
+		{"非法动作", task.TradingSignal{Action: "BUY"}, nil, false},
+		{"评分越界", task.TradingSignal{Action: "HOLD", Score: 11}, nil, false},
+		{"置信度越界", task.TradingSignal{Action: "HOLD", Confidence: 1.5}, nil, false},
+		{"多头止损方向错误", task.TradingSignal{Action: "OPEN_LONG", Confidence: 0.7, StopLoss: 3100, TakeProfit: 3200, PositionSize: 30}, nil, false},
+		{"空头止盈方向错误", task.TradingSignal{Action: "OPEN_SHORT", Confidence: 0.7, StopLoss: 3100, TakeProfit: 3050, PositionSize: 30}, nil, false},
+		{"HOLD带仓位", task.TradingSignal{Action: "HOLD", PositionSize: 10}, nil, false},
+		{"平仓带止损", task.TradingSignal{Action: "CLOSE_LONG", StopLoss: 2900, PositionSize: 100}, long, false},
+		{"合法平仓", task.TradingSignal{Action: "CLOSE_LONG", PositionSize: 100}, long, true},
+		{"调整止损方向错误", task.TradingSignal{Action: "ADJUST_SL_TP", StopLoss: 3050, TakeProfit: 3200}, long, false},
+		{"合法调整", task.TradingSignal{Action: "ADJUST_SL_TP", StopLoss: 2950, TakeProfit: 3200}, long, true},
+	}
+	for _, tc := range cases {
+		err := task.ValidateSignal(&tc.signal, 3000, tc.pos)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err=%v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
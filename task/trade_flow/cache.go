@@ -1,9 +1,12 @@
 package tradeflow
 
 import (
+	"context"
 	"deeptrade/binance"
-	"log"
+	"deeptrade/logger"
+	"deeptrade/metrics"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -21,19 +24,21 @@ func (tf *TradeFlow) Clear() {
 	tf.mutex.Lock()
 	defer tf.mutex.Unlock()
 	tf.dataMap = make(map[int64]binance.RecentTrade)
+	metrics.TradeFlowCacheSize.Set(0)
 }
 
 // AddRecentTrade 添加记录
-func (tf *TradeFlow) AddRecentTrade(data []binance.RecentTrade) {
+func (tf *TradeFlow) AddRecentTrade(ctx context.Context, data []binance.RecentTrade) {
 	tf.mutex.Lock()
 	defer tf.mutex.Unlock()
+	defer func() { metrics.TradeFlowCacheSize.Set(float64(len(tf.dataMap))) }()
 	size := 10000
 
 	for _, v := range data {
 		tf.dataMap[v.ID] = v
 	}
 	if len(tf.dataMap) < size {
-		log.Printf("[系统] 添加交易数据，当前已有%d数据\n", len(tf.dataMap))
+		logger.Debugf(ctx, "[系统] 添加交易数据，当前已有%d数据", len(tf.dataMap))
 		return
 	}
 
@@ -56,7 +61,63 @@ func (tf *TradeFlow) AddRecentTrade(data []binance.RecentTrade) {
 
 	// 更新数据映射
 	tf.dataMap = newdata
-	log.Printf("[系统] 添加交易数据，当前已有%d数据\n", len(tf.dataMap))
+	logger.Debugf(ctx, "[系统] 添加交易数据，当前已有%d数据", len(tf.dataMap))
+}
+
+// WindowStats 一个时间窗口内的主动买卖统计
+type WindowStats struct {
+	Window   string  `json:"window"`
+	Trades   int     `json:"trades"`
+	BuyQty   float64 `json:"buy_qty"`  // 主动买入数量
+	SellQty  float64 `json:"sell_qty"` // 主动卖出数量
+	BuyRatio float64 `json:"buy_ratio"`
+	VWAP     float64 `json:"vwap"`
+}
+
+// Stats 成交流缓存统计
+type Stats struct {
+	Size    int           `json:"size"`
+	Oldest  time.Time     `json:"oldest"`
+	Newest  time.Time     `json:"newest"`
+	Windows []WindowStats `json:"windows"`
+}
+
+// Stats 统计缓存的成交和最近5/10/20分钟的主动买卖
+func (tf *TradeFlow) Stats() Stats {
+	tf.mutex.Lock()
+	defer tf.mutex.Unlock()
+	stats := Stats{Size: len(tf.dataMap)}
+	for _, t := range tf.dataMap {
+		ts := time.UnixMilli(t.Time)
+		if stats.Oldest.IsZero() || ts.Before(stats.Oldest) {
+			stats.Oldest = ts
+		}
+		if ts.After(stats.Newest) {
+			stats.Newest = ts
+		}
+	}
+	for _, d := range []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute} {
+		w := WindowStats{Window: d.String()}
+		var notional float64
+		for _, t := range tf.getRecentTradesByDuration(d) {
+			qty, _ := strconv.ParseFloat(t.Qty, 64)
+			price, _ := strconv.ParseFloat(t.Price, 64)
+			// 买方挂单说明卖方是主动成交方
+			if t.IsBuyerMaker {
+				w.SellQty += qty
+			} else {
+				w.BuyQty += qty
+			}
+			notional += price * qty
+			w.Trades++
+		}
+		if total := w.BuyQty + w.SellQty; total > 0 {
+			w.BuyRatio = w.BuyQty / total
+			w.VWAP = notional / total
+		}
+		stats.Windows = append(stats.Windows, w)
+	}
+	return stats
 }
 
 // GetRecentTradesLast5Minutes 获取最近5分钟的交易数据
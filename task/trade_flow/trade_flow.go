@@ -1,8 +1,9 @@
 package tradeflow
 
 import (
+	"context"
 	"deeptrade/binance"
-	"log"
+	"deeptrade/logger"
 	"sync"
 	"time"
 )
@@ -21,27 +22,32 @@ func GetOnceTradeFlow() *TradeFlow {
 	return tradeFlow
 }
 
-func RunFetch(iswork func() bool) {
+// RunFetch 后台定时拉取成交数据，ctx 取消时退出
+func RunFetch(ctx context.Context, iswork func() bool) {
 	fetchRecentTradeLatestTime = time.Now().AddDate(0, 0, -1)
 	go func() {
 		for {
 			if !iswork() {
 				GetOnceTradeFlow().Clear()
-				time.Sleep(150 * time.Second)
-				continue
+			} else if err := FetchRecentTrade(ctx); err != nil {
+				logger.Errorf(ctx, "[系统] 拉取交易数据失败: %v", err)
 			}
-			err := FetchRecentTrade()
-			if err != nil {
-				log.Println("[系统] 拉取交易数据失败", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(150 * time.Second):
 			}
-			time.Sleep(150 * time.Second)
 		}
 
 	}()
-	time.Sleep(500 * time.Second) //首次启动需要等待趋势数据
+	//首次启动需要等待趋势数据
+	select {
+	case <-ctx.Done():
+	case <-time.After(500 * time.Second):
+	}
 }
 
-func FetchRecentTrade() (e error) {
+func FetchRecentTrade(ctx context.Context) (e error) {
 	now := time.Now()
 	fetchRecentTradeMutex.Lock()
 	duration := now.Sub(fetchRecentTradeLatestTime)
@@ -51,11 +57,11 @@ func FetchRecentTrade() (e error) {
 		return
 	}
 
-	list, e := binance.GetOnceFuturesClient().GetRecentTrades(binance.ETHUSDT_PERP, 1000)
+	list, e := binance.GetOnceFuturesClient().GetRecentTrades(ctx, binance.ETHUSDT_PERP, 1000)
 	if e != nil {
 		return
 	}
-	GetOnceTradeFlow().AddRecentTrade(list)
+	GetOnceTradeFlow().AddRecentTrade(ctx, list)
 	fetchRecentTradeMutex.Lock()
 	fetchRecentTradeLatestTime = time.Now()
 	fetchRecentTradeMutex.Unlock()
@@ -1,12 +1,14 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
 	"time"
 
 	"deeptrade/binance"
+	"deeptrade/store"
 	"deeptrade/utils"
 )
 
@@ -31,7 +33,7 @@ type TradeRecord struct {
 }
 
 // GetTradeRecordsFromMarketData 从MarketData中的OrderHistory生成交易记录（推荐使用）
-func GetTradeRecordsFromMarketData(marketData *MarketData, limit int) []*TradeRecord {
+func GetTradeRecordsFromMarketData(ctx context.Context, marketData *MarketData, limit int) []*TradeRecord {
 	if limit <= 0 {
 		limit = 6
 	}
@@ -41,11 +43,11 @@ func GetTradeRecordsFromMarketData(marketData *MarketData, limit int) []*TradeRe
 	}
 
 	// 使用MarketData中已有的持仓信息
-	return ProcessOrderHistoryToTradeRecords(marketData.OrderHistory, marketData.Positions, limit)
+	return ProcessOrderHistoryToTradeRecords(ctx, marketData.OrderHistory, marketData.Positions, limit)
 }
 
 // ProcessOrderHistoryToTradeRecords 处理订单历史数据，转换为交易记录
-func ProcessOrderHistoryToTradeRecords(orders []binance.Order, positions []binance.Position, limit int) []*TradeRecord {
+func ProcessOrderHistoryToTradeRecords(ctx context.Context, orders []binance.Order, positions []binance.Position, limit int) []*TradeRecord {
 	client, _ := binance.GetFuturesClient()
 	// 转换为交易记录并过滤已成交的订单
 	var tradeRecords []*TradeRecord
@@ -75,7 +77,7 @@ func ProcessOrderHistoryToTradeRecords(orders []binance.Order, positions []binan
 		cumulative := parseFloat(order.CumulativeQuoteQty)
 
 		tradeType := getTradeTypeDescription(order.Side, order.PositionSide, order.Type)
-		realizedPnl, commission, commissionAsset, price := GetgetTradeRealizedPnl(client, order.OrderID)
+		realizedPnl, commission, commissionAsset, price := GetgetTradeRealizedPnl(ctx, client, order.OrderID, time.UnixMilli(order.Time))
 		record := &TradeRecord{
 			OrderID:         order.OrderID,
 			Symbol:          order.Symbol,
@@ -109,14 +111,8 @@ func ProcessOrderHistoryToTradeRecords(orders []binance.Order, positions []binan
 	return tradeRecords
 }
 
-func GetgetTradeRealizedPnl(client *binance.FuturesClient, orderId int64) (realizedPnl, commission, commissionAsset, price string) {
-	if client == nil {
-		return
-	}
-	list, err := client.GetUserTrades(binance.ETHUSDT, 20, orderId, 0, 0)
-	if err != nil {
-		return
-	}
+func GetgetTradeRealizedPnl(ctx context.Context, client *binance.FuturesClient, orderId int64, orderTime time.Time) (realizedPnl, commission, commissionAsset, price string) {
+	list := orderFills(ctx, client, orderId, orderTime)
 	if len(list) == 0 {
 		return
 	}
@@ -160,6 +156,25 @@ func GetgetTradeRealizedPnl(client *binance.FuturesClient, orderId int64) (reali
 	return
 }
 
+// orderFills 获取订单的成交，优先使用本地交易日志，没有记录时请求交易所
+func orderFills(ctx context.Context, client *binance.FuturesClient, orderId int64, orderTime time.Time) []binance.UserTrade {
+	if fills, err := store.GetOnceDB().FillsByOrder(orderId, orderTime); err == nil && len(fills) > 0 {
+		list := make([]binance.UserTrade, 0, len(fills))
+		for _, f := range fills {
+			list = append(list, f.UserTrade())
+		}
+		return list
+	}
+	if client == nil {
+		return nil
+	}
+	list, err := client.GetUserTrades(ctx, binance.ETHUSDT, 20, orderId, 0, 0)
+	if err != nil {
+		return nil
+	}
+	return list
+}
+
 // getTradeTypeDescription 获取交易类型描述
 func getTradeTypeDescription(side binance.OrderSide, positionSide string, orderType binance.OrderType) string {
 	if orderType == binance.OrderTypeStopMarket {
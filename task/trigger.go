@@ -0,0 +1,319 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/indicators"
+	"deeptrade/logger"
+	tradeflow "deeptrade/task/trade_flow"
+)
+
+// 触发事件类型
+const (
+	TriggerPriceMove   = "PRICE_MOVE"   // 价格变动超过ATR倍数
+	TriggerVolumeSpike = "VOLUME_SPIKE" // 巨量
+	TriggerWhaleTrade  = "WHALE_TRADE"  // 大单成交
+	TriggerFundingFlip = "FUNDING_FLIP" // 资金费率翻转
+	TriggerPnlUp       = "PNL_UP"       // 持仓收益率上穿阈值
+	TriggerPnlDown     = "PNL_DOWN"     // 持仓收益率下穿阈值
+)
+
+// TriggerEvent 触发事件
+type TriggerEvent struct {
+	Kind   string
+	Reason string
+	Time   time.Time
+}
+
+// TriggerInput 触发检查所需的行情数据
+type TriggerInput struct {
+	Klines      []binance.Kline       // 3分钟K线
+	Trades      []binance.RecentTrade // 最近成交
+	FundingRate float64               // 当前资金费率
+	HasFunding  bool                  // 是否获取到资金费率
+	Positions   []binance.Position    // 当前持仓
+}
+
+// TriggerState 触发检查的状态，记录上次交易周期和上次观测值
+type TriggerState struct {
+	LastCyclePrice  float64
+	LastFundingRate float64
+	HasFunding      bool
+	LastPnlPct      float64
+	HasPnl          bool
+	LastWhaleID     int64
+}
+
+var (
+	triggerMutex        sync.Mutex
+	triggerState        TriggerState
+	triggerCycleRunning bool      // 交易周期进行中
+	triggerLastCycle    time.Time // 上次交易周期开始时间
+	triggerLastCycleEnd time.Time // 上次交易周期结束时间，最小间隔从此计算
+	triggerLastFired    = map[string]time.Time{}
+	triggerWake         = make(chan TriggerEvent, 1)
+)
+
+// EvaluateTriggers 根据行情数据和上次状态计算需要触发的事件，同时返回更新后的状态
+func EvaluateTriggers(in TriggerInput, st TriggerState, cfg conf.TriggerConf) ([]TriggerEvent, TriggerState) {
+	var events []TriggerEvent
+	now := time.Now()
+
+	if cfg.AtrMultiple > 0 && st.LastCyclePrice > 0 && len(in.Klines) > 15 {
+		highs, lows, closes := klineSeries(in.Klines)
+		atr := indicators.GetLatestATR(highs, lows, closes, 14)
+		price := closes[len(closes)-1]
+		if move := math.Abs(price - st.LastCyclePrice); atr > 0 && move > atr*cfg.AtrMultiple {
+			events = append(events, TriggerEvent{Kind: TriggerPriceMove, Time: now,
+				Reason: fmt.Sprintf("价格%.2f较上次周期%.2f变动%.2f，超过%.1f倍ATR(%.2f)", price, st.LastCyclePrice, move, cfg.AtrMultiple, atr)})
+		}
+	}
+
+	if cfg.VolumeSpike && len(in.Klines) > 0 {
+		analysis := indicators.AnalyzeVolumeLayers(in.Klines, nil)
+		if analysis.MediumWindow != nil {
+			for _, sig := range analysis.MediumWindow.Signals {
+				if sig.GetSignalType() == "GIANT_VOLUME" {
+					events = append(events, TriggerEvent{Kind: TriggerVolumeSpike, Time: now,
+						Reason: fmt.Sprintf("3分钟K线出现巨量: %s", sig.GetInterpretation())})
+					break
+				}
+			}
+		}
+	}
+
+	if cfg.WhaleNotional > 0 {
+		// 只统计上次检查之后的新成交，取成交额最大的一笔
+		var whale *binance.RecentTrade
+		var whaleQuote float64
+		lastID := st.LastWhaleID
+		for i, t := range in.Trades {
+			if t.ID <= lastID {
+				continue
+			}
+			quote, _ := strconv.ParseFloat(t.QuoteQty, 64)
+			if quote < cfg.WhaleNotional {
+				continue
+			}
+			if t.ID > st.LastWhaleID {
+				st.LastWhaleID = t.ID
+			}
+			if quote > whaleQuote {
+				whale, whaleQuote = &in.Trades[i], quote
+			}
+		}
+		if whale != nil {
+			side := "主动买入"
+			if whale.IsBuyerMaker {
+				side = "主动卖出"
+			}
+			events = append(events, TriggerEvent{Kind: TriggerWhaleTrade, Time: now,
+				Reason: fmt.Sprintf("大单%s %.0f USDT，价格%s", side, whaleQuote, whale.Price)})
+		}
+	}
+
+	if in.HasFunding {
+		if cfg.FundingFlip && st.HasFunding && st.LastFundingRate*in.FundingRate < 0 {
+			events = append(events, TriggerEvent{Kind: TriggerFundingFlip, Time: now,
+				Reason: fmt.Sprintf("资金费率由%.4f%%翻转为%.4f%%", st.LastFundingRate*100, in.FundingRate*100)})
+		}
+		if in.FundingRate != 0 {
+			st.LastFundingRate = in.FundingRate
+			st.HasFunding = true
+		}
+	}
+
+	if pnlPct, ok := positionPnlPct(in.Positions); ok {
+		if st.HasPnl {
+			if cfg.PnlUpPct > 0 && st.LastPnlPct < cfg.PnlUpPct && pnlPct >= cfg.PnlUpPct {
+				events = append(events, TriggerEvent{Kind: TriggerPnlUp, Time: now,
+					Reason: fmt.Sprintf("持仓收益率%.2f%%上穿%.2f%%", pnlPct, cfg.PnlUpPct)})
+			}
+			if cfg.PnlDownPct > 0 && st.LastPnlPct > -cfg.PnlDownPct && pnlPct <= -cfg.PnlDownPct {
+				events = append(events, TriggerEvent{Kind: TriggerPnlDown, Time: now,
+					Reason: fmt.Sprintf("持仓收益率%.2f%%下穿-%.2f%%", pnlPct, cfg.PnlDownPct)})
+			}
+		}
+		st.LastPnlPct = pnlPct
+		st.HasPnl = true
+	} else {
+		st.HasPnl = false
+	}
+
+	return events, st
+}
+
+// RecordTriggerCycle 记录交易周期的价格，作为价格变动的基准
+func RecordTriggerCycle(price float64) {
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+	if price > 0 {
+		triggerState.LastCyclePrice = price
+	}
+}
+
+// BeginTriggerCycle 记录交易周期开始，周期进行中不触发
+func BeginTriggerCycle() {
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+	triggerCycleRunning = true
+	triggerLastCycle = time.Now()
+}
+
+// cycleRunning 交易周期是否进行中
+func cycleRunning() bool {
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+	return triggerCycleRunning
+}
+
+// EndTriggerCycle 记录交易周期结束，作为最小间隔的基准，并丢弃周期开始前积压的唤醒事件
+func EndTriggerCycle() {
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+	triggerCycleRunning = false
+	triggerLastCycleEnd = time.Now()
+	select {
+	case <-triggerWake:
+	default:
+	}
+}
+
+// StartTriggerEngine 启动事件触发检查，交易时段外不检查
+func StartTriggerEngine(ctx context.Context) {
+	cfg := conf.Get().Trigger
+	if !cfg.Enable {
+		return
+	}
+	interval := time.Duration(cfg.IntervalSec) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	logger.Infof(ctx, "[事件触发] 启动，检查间隔: %v", interval)
+
+	go func() {
+		for {
+			if IsWork() && !IsHalted() && !IsPaused() {
+				runTriggerCheck(ctx, cfg)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// WaitNextCycle 等待下一个交易周期：定时器到期、事件触发或 ctx 取消
+func WaitNextCycle(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	case ev := <-triggerWake:
+		logger.Infof(ctx, "[事件触发] 提前唤醒交易周期: %s", ev.Reason)
+	}
+}
+
+// runTriggerCheck 执行一次触发检查
+func runTriggerCheck(ctx context.Context, cfg conf.TriggerConf) {
+	client := binance.GetOnceFuturesClient()
+	symbol := binance.ETHUSDT_PERP
+
+	in := TriggerInput{Trades: tradeflow.GetOnceTradeFlow().GetRecentTradesLast5Minutes()}
+	klines, err := client.GetKlines(ctx, symbol, binance.KlineInterval3m, 70)
+	if err != nil {
+		logger.Errorf(ctx, "[事件触发] 获取K线失败: %v", err)
+		return
+	}
+	in.Klines = klines
+	if mp, err := client.GetMarkPrice(ctx, symbol); err == nil {
+		in.FundingRate, _ = strconv.ParseFloat(mp.LastFundingRate, 64)
+		in.HasFunding = true
+	}
+	if positions, err := client.GetPositions(ctx, symbol); err == nil {
+		in.Positions = positions
+	}
+
+	triggerMutex.Lock()
+	events, st := EvaluateTriggers(in, triggerState, cfg)
+	triggerState = st
+	if len(events) == 0 {
+		triggerMutex.Unlock()
+		return
+	}
+	if triggerCycleRunning {
+		triggerMutex.Unlock()
+		logger.Debugf(ctx, "[事件触发] 交易周期进行中，忽略: %s", events[0].Reason)
+		return
+	}
+	if minInterval := time.Duration(cfg.MinIntervalSec) * time.Second; time.Since(triggerLastCycleEnd) < minInterval {
+		triggerMutex.Unlock()
+		logger.Warnf(ctx, "[事件触发] 距离上次交易周期结束不足%v，忽略: %s", minInterval, events[0].Reason)
+		return
+	}
+	debounce := time.Duration(cfg.DebounceSec) * time.Second
+	var fired []string
+	for _, ev := range events {
+		if time.Since(triggerLastFired[ev.Kind]) < debounce {
+			continue
+		}
+		triggerLastFired[ev.Kind] = ev.Time
+		fired = append(fired, ev.Reason)
+	}
+	triggerMutex.Unlock()
+	if len(fired) == 0 {
+		return
+	}
+
+	ev := TriggerEvent{Kind: events[0].Kind, Reason: strings.Join(fired, "; "), Time: time.Now()}
+	select {
+	case triggerWake <- ev:
+	default:
+		// 已有待处理的唤醒事件
+	}
+}
+
+// positionPnlPct 计算持仓收益率(未实现盈亏/初始保证金)，无持仓时返回false
+func positionPnlPct(positions []binance.Position) (float64, bool) {
+	var pnl, margin float64
+	for _, pos := range positions {
+		amt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
+		if amt == 0 {
+			continue
+		}
+		notional, _ := strconv.ParseFloat(pos.Notional, 64)
+		leverage, _ := strconv.ParseFloat(pos.Leverage, 64)
+		profit, _ := strconv.ParseFloat(pos.UnRealizedProfit, 64)
+		if leverage <= 0 {
+			leverage = 1
+		}
+		pnl += profit
+		margin += math.Abs(notional) / leverage
+	}
+	if margin <= 0 {
+		return 0, false
+	}
+	return pnl / margin * 100, true
+}
+
+// klineSeries 提取K线的最高价、最低价和收盘价序列
+func klineSeries(klines []binance.Kline) (highs, lows, closes []float64) {
+	for _, k := range klines {
+		h, _ := strconv.ParseFloat(k.High, 64)
+		l, _ := strconv.ParseFloat(k.Low, 64)
+		c, _ := strconv.ParseFloat(k.Close, 64)
+		highs = append(highs, h)
+		lows = append(lows, l)
+		closes = append(closes, c)
+	}
+	return
+}
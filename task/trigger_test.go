@@ -0,0 +1,50 @@
+package task_test
+
+import (
+	"testing"
+
+	"deeptrade/binance"
+	"deeptrade/conf"
+	"deeptrade/task"
+)
+
+func TestEvaluateTriggers(t *testing.T) {
+	cfg := conf.TriggerConf{WhaleNotional: 1000000, FundingFlip: true, PnlUpPct: 30, PnlDownPct: 15}
+	position := func(pnl string) []binance.Position {
+		return []binance.Position{{PositionAmt: "1", Notional: "3000", Leverage: "10", UnRealizedProfit: pnl}}
+	}
+
+	// 首次观测只记录状态
+	events, st := task.EvaluateTriggers(task.TriggerInput{FundingRate: 0.0001, HasFunding: true, Positions: position("60")}, task.TriggerState{}, cfg)
+	if len(events) != 0 {
+		t.Fatalf("首次观测不应触发: %+v", events)
+	}
+
+	// 资金费率翻转，收益率由20%上穿30%，出现大单
+	in := task.TriggerInput{
+		FundingRate: -0.0002,
+		HasFunding:  true,
+		Positions:   position("100"),
+		Trades: []binance.RecentTrade{
+			{ID: 1, Price: "3000", QuoteQty: "500000"},
+			{ID: 2, Price: "3001", QuoteQty: "1500000", IsBuyerMaker: true},
+		},
+	}
+	events, st = task.EvaluateTriggers(in, st, cfg)
+	kinds := map[string]bool{}
+	for _, ev := range events {
+		kinds[ev.Kind] = true
+	}
+	for _, k := range []string{task.TriggerFundingFlip, task.TriggerPnlUp, task.TriggerWhaleTrade} {
+		if !kinds[k] {
+			t.Errorf("缺少触发事件 %s: %+v", k, events)
+		}
+	}
+
+	// 相同成交不重复触发，收益率下穿-15%
+	in.Positions = position("-50")
+	events, _ = task.EvaluateTriggers(in, st, cfg)
+	if len(events) != 1 || events[0].Kind != task.TriggerPnlDown {
+		t.Errorf("期望只触发 %s: %+v", task.TriggerPnlDown, events)
+	}
+}
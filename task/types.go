@@ -7,14 +7,38 @@ import (
 
 // TradingSignal LLM返回的交易信号
 type TradingSignal struct {
-	Action       string  `json:"action"`        // 操作类型: OPEN_LONG, OPEN_SHORT, CLOSE_LONG, CLOSE_SHORT, ADD_LONG, ADD_SHORT, HOLD
-	Score        int     `json:"score"`         // 评分: -10到+10
-	Confidence   float64 `json:"confidence"`    // 置信度: 0.0-1.0
-	StopLoss     float64 `json:"stop_loss"`     // 止损价格
-	TakeProfit   float64 `json:"take_profit"`   // 止盈价格
-	PositionSize int     `json:"position_size"` // 仓位大小
-	Reasoning    string  `json:"reasoning"`     // 分析原因
-	Memory       string  `json:"memory"`        //记忆
+	Action       string        `json:"action"`        // 操作类型: OPEN_LONG, OPEN_SHORT, CLOSE_LONG, CLOSE_SHORT, ADD_LONG, ADD_SHORT, HOLD
+	Score        int           `json:"score"`         // 评分: -10到+10
+	Confidence   float64       `json:"confidence"`    // 置信度: 0.0-1.0
+	StopLoss     float64       `json:"stop_loss"`     // 止损价格
+	TakeProfit   float64       `json:"take_profit"`   // 止盈价格
+	PositionSize int           `json:"position_size"` // 仓位大小
+	Reasoning    string        `json:"reasoning"`     // 分析原因
+	Memory       MemoryUpdates `json:"memory"`        // 记忆，为空时本轮不修改记忆
+
+	decision *DecisionRecord // 产生该信号的决策记录，用于平仓复盘
+}
+
+// PromptData 提示词模板的数据，各分析段落已格式化为文本
+type PromptData struct {
+	Time             string  // 当前时间
+	Price            float64 // 最新价格
+	PriceChange      float64 // 24小时涨跌幅(%)
+	Position         string  // 持仓及止盈止损
+	WalletBalance    float64 // 钱包余额
+	AvailableBalance float64 // 可用余额
+	MarginBalance    float64 // 保证金余额
+	Technical        string  // 技术指标
+	Volume           string  // 成交量趋势分析
+	TradeFlow        string  // 交易流分析
+	Memory           string  // 记忆
+	Lessons          string  // 相似市场环境下的历史交易经验，仅开仓时提供
+	Trades           string  // 本地交易日志中最近的完整交易和今日盈亏，没有时为最近订单记录
+	Funding          string  // 资金状况
+	BookTicker       string  // 最优挂单
+	OrderBook        string  // 原始订单簿
+	Tools            bool    // 是否可以调用数据查询工具
+	Compact          bool    // 是否省略可按需查询的数据
 }
 
 // FuturesTicker 期货价格数据（别名）
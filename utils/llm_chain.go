@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+// LLMHealth 模型健康状态
+type LLMHealth struct {
+	Model               string    `json:"model"`
+	Success             int       `json:"success"`              // 累计成功次数
+	Failure             int       `json:"failure"`              // 累计失败次数
+	ConsecutiveFailures int       `json:"consecutive_failures"` // 连续失败次数
+	SkipUntil           time.Time `json:"skip_until"`           // 在此之前跳过该模型
+	LastError           string    `json:"last_error"`
+}
+
+var (
+	llmHealthMutex sync.Mutex
+	llmHealthMap   = map[string]*LLMHealth{}
+
+	modelOverrideMutex sync.Mutex
+	modelOverrides     = map[bool]string{} // 按是否持仓区分角色
+)
+
+// SetModelOverride 运行时指定角色的首选模型，model 为空时恢复配置的顺序，重启后失效
+func SetModelOverride(hasPosition bool, model string) error {
+	if model != "" {
+		if _, ok := conf.Get().GetLLMByModel(model); !ok {
+			return fmt.Errorf("未配置模型: %s", model)
+		}
+	}
+	modelOverrideMutex.Lock()
+	defer modelOverrideMutex.Unlock()
+	if model == "" {
+		delete(modelOverrides, hasPosition)
+	} else {
+		modelOverrides[hasPosition] = model
+	}
+	logger.Infof(context.Background(), "[LLM] 角色(持仓=%v)的首选模型切换为: %s", hasPosition, model)
+	return nil
+}
+
+// ModelOverride 角色运行时指定的首选模型，未指定时为空
+func ModelOverride(hasPosition bool) string {
+	modelOverrideMutex.Lock()
+	defer modelOverrideMutex.Unlock()
+	return modelOverrides[hasPosition]
+}
+
+// LLMChain 角色的模型降级链，运行时指定的首选模型排在最前
+func LLMChain(hasPosition bool) []conf.LLMConf {
+	chain := conf.Get().GetLLMChain(hasPosition)
+	model := ModelOverride(hasPosition)
+	lc, ok := conf.Get().GetLLMByModel(model)
+	if model == "" || !ok {
+		return chain
+	}
+	result := []conf.LLMConf{lc}
+	for _, c := range chain {
+		if c.Model != model {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// GenerateWithFallback 按降级链依次调用模型，可重试错误按退避重试，返回响应和实际使用的模型
+func GenerateWithFallback(ctx context.Context, hasPosition bool, in []*schema.Message, out *StructuredOutput, loop *ToolLoop, opts ...model.Option) (*schema.Message, conf.LLMConf, error) {
+	chain := LLMChain(hasPosition)
+	if len(chain) == 0 {
+		return nil, conf.LLMConf{}, fmt.Errorf("未配置可用的LLM模型")
+	}
+	chain, err := applyCostCap(chain)
+	if err != nil {
+		return nil, conf.LLMConf{}, err
+	}
+	policy := conf.Get().LLMPolicy
+
+	// 健康的模型优先，全部处于跳过期时仍按原顺序尝试
+	var healthy, skipped []conf.LLMConf
+	for _, lc := range chain {
+		if llmSkipped(lc.Name()) {
+			skipped = append(skipped, lc)
+			continue
+		}
+		healthy = append(healthy, lc)
+	}
+	if len(healthy) == 0 {
+		healthy = skipped
+	} else if len(skipped) > 0 {
+		logger.Warnf(ctx, "[LLM] 跳过连续失败的模型: %v", llmNames(skipped))
+	}
+
+	var errs []string
+	for _, lc := range healthy {
+		resp, err := generateWithRetry(ctx, lc, policy, in, out, loop, opts...)
+		if err == nil {
+			recordLLMResult(ctx, lc.Name(), nil, policy)
+			return resp, lc, nil
+		}
+		recordLLMResult(ctx, lc.Name(), err, policy)
+		errs = append(errs, fmt.Sprintf("%s: %v", lc.Model, err))
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Warnf(ctx, "[LLM] 模型%s调用失败，尝试下一个模型: %v", lc.Model, err)
+	}
+	return nil, conf.LLMConf{}, fmt.Errorf("所有LLM模型调用失败: %s", strings.Join(errs, "; "))
+}
+
+// generateWithRetry 调用单个模型，loop 不为空时允许模型按需调用工具
+func generateWithRetry(ctx context.Context, lc conf.LLMConf, policy conf.LLMPolicyConf, in []*schema.Message, out *StructuredOutput, loop *ToolLoop, opts ...model.Option) (*schema.Message, error) {
+	useTools := loop != nil && len(loop.Tools) > 0
+	bindOut := out
+	if useTools && out != nil && lc.OutputMode == OutputModeTool {
+		// 工具循环中提交结果的工具与数据工具一起绑定，不强制调用
+		bindOut = nil
+	}
+	chatModel, extra, err := NewOpenAIChatModel(lc, bindOut)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) > 0 {
+		opts = append(opts, openai.WithExtraFields(extra))
+	}
+	if useTools {
+		return runToolLoop(ctx, lc, policy, chatModel, in, out, loop, opts...)
+	}
+
+	resp, err := callWithRetry(ctx, lc, policy, chatModel, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.ToolCalls) > 0 {
+		// 工具调用模式下结构化结果在调用参数中
+		resp.Content = resp.ToolCalls[0].Function.Arguments
+	}
+	return resp, nil
+}
+
+// callWithRetry 单次模型请求，可重试错误按退避重试
+func callWithRetry(ctx context.Context, lc conf.LLMConf, policy conf.LLMPolicyConf, chatModel model.BaseChatModel, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	timeout := time.Duration(firstPositive(lc.TimeoutSec, policy.TimeoutSec, 150)) * time.Second
+	maxRetries := lc.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = policy.MaxRetries
+	}
+	delay := time.Duration(firstPositive(policy.RetryDelayMs, 2000)) * time.Millisecond
+	backoff := policy.RetryBackoff
+	if backoff < 1 {
+		backoff = 2
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			logger.Warnf(ctx, "[LLM] 模型%s第%d次重试，等待%v: %v", lc.Model, attempt, delay, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay = time.Duration(float64(delay) * backoff)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		startTime := time.Now()
+		resp, err := chatModel.Generate(callCtx, in, opts...)
+		cancel()
+		if err == nil {
+			recordLLMCost(ctx, lc, resp, time.Since(startTime))
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !IsRetryableLLMError(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// IsRetryableLLMError 判断LLM错误是否可重试：429、5xx、超时和网络错误
+func IsRetryableLLMError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr *goopenai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == 429 || apiErr.HTTPStatusCode >= 500
+	}
+	var reqErr *goopenai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == 429 || reqErr.HTTPStatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return false
+}
+
+// GetLLMHealth 获取各模型的健康状态
+func GetLLMHealth() []LLMHealth {
+	llmHealthMutex.Lock()
+	defer llmHealthMutex.Unlock()
+	result := make([]LLMHealth, 0, len(llmHealthMap))
+	for _, h := range llmHealthMap {
+		result = append(result, *h)
+	}
+	return result
+}
+
+// recordLLMResult 记录模型调用结果，连续失败达到阈值后暂时跳过
+func recordLLMResult(ctx context.Context, name string, err error, policy conf.LLMPolicyConf) {
+	llmHealthMutex.Lock()
+	defer llmHealthMutex.Unlock()
+	h, ok := llmHealthMap[name]
+	if !ok {
+		h = &LLMHealth{Model: name}
+		llmHealthMap[name] = h
+	}
+	if err == nil {
+		h.Success++
+		h.ConsecutiveFailures = 0
+		h.SkipUntil = time.Time{}
+		return
+	}
+
+	h.Failure++
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	threshold := firstPositive(policy.FailThreshold, 3)
+	if h.ConsecutiveFailures >= threshold {
+		cooldown := time.Duration(firstPositive(policy.CooldownSec, 600)) * time.Second
+		h.SkipUntil = time.Now().Add(cooldown)
+		logger.Warnf(ctx, "[LLM] 模型%s连续失败%d次，%v内跳过", name, h.ConsecutiveFailures, cooldown)
+	}
+}
+
+// llmSkipped 模型是否处于跳过期
+func llmSkipped(name string) bool {
+	llmHealthMutex.Lock()
+	defer llmHealthMutex.Unlock()
+	h, ok := llmHealthMap[name]
+	return ok && time.Now().Before(h.SkipUntil)
+}
+
+func llmNames(list []conf.LLMConf) (names []string) {
+	for _, lc := range list {
+		names = append(names, lc.Model)
+	}
+	return
+}
+
+// firstPositive 返回第一个大于0的值
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
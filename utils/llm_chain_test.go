@@ -0,0 +1,74 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"deeptrade/conf"
+	"deeptrade/utils"
+
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+func TestIsRetryableLLMError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"超时", fmt.Errorf("failed: %w", context.DeadlineExceeded), true},
+		{"限流", fmt.Errorf("failed: %w", &goopenai.APIError{HTTPStatusCode: 429}), true},
+		{"服务端错误", fmt.Errorf("failed: %w", &goopenai.RequestError{HTTPStatusCode: 502}), true},
+		{"鉴权失败", fmt.Errorf("failed: %w", &goopenai.APIError{HTTPStatusCode: 401}), false},
+		{"其他错误", errors.New("invalid json"), false},
+	}
+	for _, tc := range cases {
+		if got := utils.IsRetryableLLMError(tc.err); got != tc.want {
+			t.Errorf("%s: IsRetryableLLMError=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLLMChainOverride(t *testing.T) {
+	t.Setenv("FREEDOM_PROJECT_CONFIG", "../conf")
+	cfg := conf.Get()
+	llm := cfg.LLM
+	defer func() { cfg.LLM = llm }()
+	cfg.LLM = []conf.LLMConf{
+		{Model: "a", EntryEnable: true, EntryPriority: 1},
+		{Model: "b", EntryEnable: true, EntryPriority: 2},
+		{Model: "c", TrackEnable: true},
+	}
+	chain := func(hasPosition bool) string {
+		var names []string
+		for _, lc := range utils.LLMChain(hasPosition) {
+			names = append(names, lc.Model)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := chain(false); got != "a,b" {
+		t.Errorf("未指定首选模型时应按配置顺序: %s", got)
+	}
+	if err := utils.SetModelOverride(false, "b"); err != nil {
+		t.Fatal(err)
+	}
+	defer utils.SetModelOverride(false, "")
+	if got := chain(false); got != "b,a" {
+		t.Errorf("首选模型应排在最前且不重复: %s", got)
+	}
+	if got := chain(true); got != "c" {
+		t.Errorf("首选模型只影响对应角色: %s", got)
+	}
+	if err := utils.SetModelOverride(false, "x"); err == nil {
+		t.Error("未配置的模型应报错")
+	}
+	utils.SetModelOverride(false, "")
+	if got := chain(false); got != "a,b" {
+		t.Errorf("清除后应恢复配置顺序: %s", got)
+	}
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/metrics"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	costLedgerFile = "llm_cost.jsonl"
+	costKeepDays   = 62 // 内存中保留的天数，覆盖最近30天和本月
+)
+
+// 超出每日费用上限后的处理方式
+const (
+	CostCapFallback = "fallback" // 改用便宜的模型
+	CostCapSkip     = "skip"     // 跳过交易周期
+)
+
+// ErrCostCapReached 今日LLM费用已达上限
+var ErrCostCapReached = errors.New("今日LLM费用已达上限")
+
+// CostEntry 单次模型调用的费用记录
+type CostEntry struct {
+	Time             time.Time `json:"time"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+	DurationMs       int64     `json:"duration_ms"`
+}
+
+// CostAggregate 费用汇总
+type CostAggregate struct {
+	Period           string  `json:"period"` // 日期(2006-01-02)、月份(2006-01)或模型名称
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+	totalLatencyMs   int64
+}
+
+// add 累加一条记录
+func (a *CostAggregate) add(e CostEntry) {
+	a.Calls++
+	a.PromptTokens += e.PromptTokens
+	a.CompletionTokens += e.CompletionTokens
+	a.Cost += e.Cost
+	a.totalLatencyMs += e.DurationMs
+	a.AvgLatencyMs = a.totalLatencyMs / int64(a.Calls)
+}
+
+// CostSummary 费用概况
+type CostSummary struct {
+	Currency string          `json:"currency"`
+	DailyCap float64         `json:"daily_cap"`
+	Today    CostAggregate   `json:"today"`
+	Month    CostAggregate   `json:"month"`
+	Days     []CostAggregate `json:"days"`   // 最近30天，按日期倒序
+	Models   []CostAggregate `json:"models"` // 本月按模型汇总
+}
+
+var (
+	costMutex   sync.Mutex
+	costLoaded  bool
+	costEntries []CostEntry // 最近两个月的记录，用于汇总
+)
+
+// LLMCost 按模型价格计算一次调用的费用
+func LLMCost(lc conf.LLMConf, promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*lc.InputPrice + float64(completionTokens)*lc.OutputPrice) / 1e6
+}
+
+// recordLLMCost 记录一次模型调用的费用并追加到费用账本
+func recordLLMCost(ctx context.Context, lc conf.LLMConf, resp *schema.Message, duration time.Duration) {
+	entry := CostEntry{Time: time.Now(), Model: lc.Model, DurationMs: duration.Milliseconds()}
+	if resp.ResponseMeta != nil && resp.ResponseMeta.Usage != nil {
+		entry.PromptTokens = resp.ResponseMeta.Usage.PromptTokens
+		entry.CompletionTokens = resp.ResponseMeta.Usage.CompletionTokens
+	}
+	entry.Cost = LLMCost(lc, entry.PromptTokens, entry.CompletionTokens)
+	metrics.LLMLatency.WithLabelValues(lc.Model).Observe(duration.Seconds())
+	metrics.LLMTokens.WithLabelValues(lc.Model, "prompt").Add(float64(entry.PromptTokens))
+	metrics.LLMTokens.WithLabelValues(lc.Model, "completion").Add(float64(entry.CompletionTokens))
+	metrics.LLMCost.WithLabelValues(lc.Model).Add(entry.Cost)
+
+	costMutex.Lock()
+	defer costMutex.Unlock()
+	loadCostLedger()
+	costEntries = append(costEntries, entry)
+	if since := time.Now().AddDate(0, 0, -costKeepDays); costEntries[0].Time.Before(since) {
+		i := sort.Search(len(costEntries), func(i int) bool { return !costEntries[i].Time.Before(since) })
+		costEntries = append([]CostEntry{}, costEntries[i:]...)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(conf.Get().Storage.Path(costLedgerFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf(ctx, "[LLM费用] 写入费用记录失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// loadCostLedger 首次使用时从费用账本加载近期记录，调用方需持有 costMutex
+func loadCostLedger() {
+	if costLoaded {
+		return
+	}
+	costLoaded = true
+	f, err := os.Open(conf.Get().Storage.Path(costLedgerFile))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	since := time.Now().AddDate(0, 0, -costKeepDays)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e CostEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Time.Before(since) {
+			continue
+		}
+		costEntries = append(costEntries, e)
+	}
+}
+
+// TodayLLMCost 今日LLM费用
+func TodayLLMCost() float64 {
+	return GetCostSummary().Today.Cost
+}
+
+// CostCapReached 今日费用是否已达上限
+func CostCapReached() bool {
+	dailyCap := conf.Get().LLMCost.DailyCap
+	return dailyCap > 0 && TodayLLMCost() >= dailyCap
+}
+
+// LLMCostBetween 统计时间范围内的LLM费用
+func LLMCostBetween(start, end time.Time) float64 {
+	costMutex.Lock()
+	defer costMutex.Unlock()
+	loadCostLedger()
+	var total float64
+	for _, e := range costEntries {
+		if !e.Time.Before(start) && e.Time.Before(end) {
+			total += e.Cost
+		}
+	}
+	return total
+}
+
+// GetCostSummary 获取今日、本月、最近30天和按模型的费用汇总
+func GetCostSummary() CostSummary {
+	costMutex.Lock()
+	loadCostLedger()
+	entries := append([]CostEntry{}, costEntries...)
+	costMutex.Unlock()
+
+	cfg := conf.Get().LLMCost
+	summary := AggregateCosts(entries, time.Now())
+	summary.Currency, summary.DailyCap = cfg.Currency, cfg.DailyCap
+	return summary
+}
+
+// AggregateCosts 按日、月和模型汇总费用记录
+func AggregateCosts(entries []CostEntry, now time.Time) CostSummary {
+	today, month := now.Format("2006-01-02"), now.Format("2006-01")
+	summary := CostSummary{Today: CostAggregate{Period: today}, Month: CostAggregate{Period: month}}
+	days := map[string]*CostAggregate{}
+	models := map[string]*CostAggregate{}
+	since := now.AddDate(0, 0, -30)
+	for _, e := range entries {
+		day := e.Time.Format("2006-01-02")
+		if day == today {
+			summary.Today.add(e)
+		}
+		if e.Time.Format("2006-01") == month {
+			summary.Month.add(e)
+			if models[e.Model] == nil {
+				models[e.Model] = &CostAggregate{Period: e.Model}
+			}
+			models[e.Model].add(e)
+		}
+		if e.Time.After(since) {
+			if days[day] == nil {
+				days[day] = &CostAggregate{Period: day}
+			}
+			days[day].add(e)
+		}
+	}
+	for _, a := range days {
+		summary.Days = append(summary.Days, *a)
+	}
+	sort.Slice(summary.Days, func(i, j int) bool { return summary.Days[i].Period > summary.Days[j].Period })
+	for _, a := range models {
+		summary.Models = append(summary.Models, *a)
+	}
+	sort.Slice(summary.Models, func(i, j int) bool { return summary.Models[i].Cost > summary.Models[j].Cost })
+	return summary
+}
+
+// applyCostCap 今日费用达到上限时按配置改用便宜的模型或拒绝调用
+func applyCostCap(chain []conf.LLMConf) ([]conf.LLMConf, error) {
+	if !CostCapReached() {
+		return chain, nil
+	}
+	cfg := conf.Get().LLMCost
+	if cfg.CapAction == CostCapSkip {
+		return nil, ErrCostCapReached
+	}
+	if lc, ok := conf.Get().GetLLMByModel(cfg.FallbackModel); ok {
+		return []conf.LLMConf{lc}, nil
+	}
+	if len(chain) == 0 {
+		return chain, nil
+	}
+	cheapest := chain[0]
+	for _, lc := range chain[1:] {
+		if lc.InputPrice+lc.OutputPrice < cheapest.InputPrice+cheapest.OutputPrice {
+			cheapest = lc
+		}
+	}
+	return []conf.LLMConf{cheapest}, nil
+}
@@ -0,0 +1,40 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/utils"
+)
+
+func TestLLMCost(t *testing.T) {
+	lc := conf.LLMConf{InputPrice: 2, OutputPrice: 8}
+	if cost := utils.LLMCost(lc, 500000, 250000); math.Abs(cost-3) > 1e-9 {
+		t.Errorf("费用计算错误: %v", cost)
+	}
+}
+
+func TestAggregateCosts(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	entries := []utils.CostEntry{
+		{Time: now.AddDate(0, -1, 0), Model: "a", Cost: 5, DurationMs: 100},
+		{Time: now.AddDate(0, 0, -1), Model: "a", Cost: 1, DurationMs: 100},
+		{Time: now.Add(-time.Hour), Model: "a", Cost: 2, DurationMs: 200},
+		{Time: now.Add(-time.Minute), Model: "b", Cost: 0.5, DurationMs: 300},
+	}
+	s := utils.AggregateCosts(entries, now)
+	if s.Today.Calls != 2 || s.Today.Cost != 2.5 || s.Today.AvgLatencyMs != 250 {
+		t.Errorf("今日汇总错误: %+v", s.Today)
+	}
+	if s.Month.Calls != 3 || s.Month.Cost != 3.5 {
+		t.Errorf("本月汇总错误: %+v", s.Month)
+	}
+	if len(s.Days) != 2 || s.Days[0].Period != "2026-10-18" {
+		t.Errorf("按日汇总错误: %+v", s.Days)
+	}
+	if len(s.Models) != 2 || s.Models[0].Period != "a" || s.Models[0].Cost != 3 {
+		t.Errorf("按模型汇总错误: %+v", s.Models)
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+)
+
+// 模型结构化输出模式，对应 llm.output_mode
+const (
+	OutputModeText       = ""            // 普通文本，由程序从回复中解析JSON
+	OutputModeJSONSchema = "json_schema" // response_format: json_schema
+	OutputModeTool       = "tool"        // 强制工具调用，结果在调用参数中
+)
+
+// StructuredOutput 结构化输出定义
+type StructuredOutput struct {
+	Name   string
+	Desc   string
+	Params map[string]*schema.ParameterInfo
+}
+
+// ToolInfo 转换为工具定义
+func (o *StructuredOutput) ToolInfo() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name:        o.Name,
+		Desc:        o.Desc,
+		ParamsOneOf: schema.NewParamsOneOfByParams(o.Params),
+	}
+}
+
+// JSONSchema 转换为 JSON Schema
+func (o *StructuredOutput) JSONSchema() (*jsonschema.Schema, error) {
+	return schema.NewParamsOneOfByParams(o.Params).ToJSONSchema()
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"deeptrade/conf"
+	"deeptrade/logger"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ToolLoop 工具调用循环，模型可在给出结论前按需调用工具获取数据
+type ToolLoop struct {
+	Tools    []tool.InvokableTool
+	MaxCalls int           // 工具调用次数上限
+	Timeout  time.Duration // 整个循环的超时，超时后要求模型直接给出结论
+}
+
+// maxToolResultLen 单次工具返回内容的最大长度
+const maxToolResultLen = 8000
+
+// runToolLoop 执行工具调用循环，调用次数用尽或超时后禁止继续调用工具
+func runToolLoop(ctx context.Context, lc conf.LLMConf, policy conf.LLMPolicyConf, chatModel *openai.ChatModel, in []*schema.Message, out *StructuredOutput, loop *ToolLoop, opts ...model.Option) (*schema.Message, error) {
+	tools := make(map[string]tool.InvokableTool, len(loop.Tools))
+	infos := make([]*schema.ToolInfo, 0, len(loop.Tools)+1)
+	for _, t := range loop.Tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("获取工具定义失败: %v", err)
+		}
+		tools[info.Name] = t
+		infos = append(infos, info)
+	}
+	outputTool := out != nil && lc.OutputMode == OutputModeTool
+	if outputTool {
+		infos = append(infos, out.ToolInfo())
+	}
+	toolModel, err := chatModel.WithTools(infos)
+	if err != nil {
+		return nil, err
+	}
+
+	loopCtx := ctx
+	if loop.Timeout > 0 {
+		var cancel context.CancelFunc
+		loopCtx, cancel = context.WithTimeout(ctx, loop.Timeout)
+		defer cancel()
+	}
+
+	msgs := append([]*schema.Message{}, in...)
+	calls := 0
+	for calls < loop.MaxCalls && loopCtx.Err() == nil {
+		resp, err := callWithRetry(loopCtx, lc, policy, toolModel, msgs, opts...)
+		if err != nil {
+			if ctx.Err() == nil && loopCtx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		if len(resp.ToolCalls) == 0 {
+			return resp, nil
+		}
+		if outputTool {
+			for _, call := range resp.ToolCalls {
+				if call.Function.Name == out.Name {
+					resp.Content = call.Function.Arguments
+					return resp, nil
+				}
+			}
+		}
+
+		msgs = append(msgs, resp)
+		for _, call := range resp.ToolCalls {
+			// 每个调用都必须有对应的工具消息，超出次数的调用直接告知
+			result := "工具调用次数已用尽，请根据已有数据给出结论"
+			if calls < loop.MaxCalls {
+				calls++
+				result = invokeTool(loopCtx, tools, call)
+			}
+			msgs = append(msgs, schema.ToolMessage(result, call.ID))
+		}
+	}
+
+	// 调用次数用尽或超时，要求模型直接给出结论
+	logger.Infof(ctx, "[LLM工具] 已调用%d次工具，要求模型给出结论", calls)
+	if outputTool {
+		opts = append(opts, model.WithTools([]*schema.ToolInfo{out.ToolInfo()}), model.WithToolChoice(schema.ToolChoiceForced))
+	} else {
+		opts = append(opts, model.WithToolChoice(schema.ToolChoiceForbidden))
+	}
+	msgs = append(msgs, schema.UserMessage("数据查询已结束，请根据已有数据直接给出最终结论。"))
+	resp, err := callWithRetry(ctx, lc, policy, toolModel, msgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.ToolCalls) > 0 {
+		resp.Content = resp.ToolCalls[0].Function.Arguments
+	}
+	return resp, nil
+}
+
+// invokeTool 执行单个工具调用，错误作为结果返回给模型
+func invokeTool(ctx context.Context, tools map[string]tool.InvokableTool, call schema.ToolCall) string {
+	t, ok := tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("未知工具: %s", call.Function.Name)
+	}
+	startTime := time.Now()
+	result, err := t.InvokableRun(ctx, call.Function.Arguments)
+	if err != nil {
+		logger.Errorf(ctx, "[LLM工具] %s(%s) 失败: %v", call.Function.Name, call.Function.Arguments, err)
+		return fmt.Sprintf("工具调用失败: %v", err)
+	}
+	logger.Infof(ctx, "[LLM工具] %s(%s) 返回%d字节，耗时%v", call.Function.Name, call.Function.Arguments, len(result), time.Since(startTime))
+	if len(result) > maxToolResultLen {
+		result = strings.ToValidUTF8(result[:maxToolResultLen], "") + "\n...(已截断)"
+	}
+	return result
+}
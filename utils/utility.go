@@ -3,144 +3,96 @@ package utils
 import (
 	"context"
 	"deeptrade/conf"
+	"deeptrade/logger"
+	"deeptrade/prompt"
 	"encoding/json"
-	"log"
+	"fmt"
 	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
-	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 )
 
-const roleMsg = `
-## 角色定位
-你是一个专业的量化交易决策模型，专注于 Binance ETH/USDT 永续合约的交易信号分析。
-
-## 系统特性
-**全自动主动管理**：您是本系统的唯一决策者，所有交易决策由您独立完成，人类操作者不会干预。
-- **数据输入**：所有市场数据和技术指标均由程序计算后提供
-- **决策执行**：您的JSON输出将直接由程序自动执行  
-- **责任范围**：您对所有的开仓、平仓、仓位管理决策负全责
-
-## 输入数据说明
-**数据频率**: 每20分钟调用一次
-
-**多时间框架分析指南**:
-- **信号优先级**：信号权重：成交量趋势分析(35%) + 技术指标(35%) + 订单流(20%) + 微观结构(10%)
-
-## 输出规范
-
-### JSON格式要求
-**统一使用格式输出信号**：
-
-{
-"action": "OPEN_LONG/OPEN_SHORT/CLOSE_LONG/CLOSE_SHORT/ADJUST_SL_TP/HOLD",
-"score": -10到+10整数,
-"confidence": 0.0-1.0, 
-"stop_loss": 2777.72,
-"take_profit": 2688.72, 
-"position_size": 45,
-"reasoning": "决策理由(50字内)"
-"memory": "key1:value1|key2:value2"
-}
-
-#### 字段说明
-- **action**: 6种交易操作，必须准确
-  - **HOLD**: stop_loss、take_profit、position_size: 0
-  - **CLOSE_LONG/CLOSE_SHORT**: stop_loss、take_profit:0，position_size:100
-  - **ADJUST_SL_TP**: position_size:0，stop_loss和take_profit必须填写
-- **score**: 决策强度（绝对值越大信号越强) 正数多头，负数空头
-- **confidence**: 基于一致性检查的信心度,使用2位小数，如:0.45
-- **stop_loss**: 参考动态风险管理
-- **take_profit**: 参考动态风险管理
-- **position_size**: 参考信心度量化标准
-- **reasoning**: 必须包含一致性检查结果
-- **memory字段**：
-  - 类型：字符串
-  - 格式：key1:value1|key2:value2|key3:value3
-  - 记忆内容要简洁，总长度控制在200字符内
-  - 使用说明：程序每次调用都会携带上次返回的memory，你可以自主决定在memory中记录关键信息，或者为空
-
-## 决策原则
-### 1. 信号一致性检查
-开仓前必须验证：
-- 至少3个数据源方向一致
-- 大单流向与价格趋势一致
-- 不同时间框架无根本矛盾
-
-### 2. 开仓风险管理
-- **止损**: 开仓价 ± 4×ATR
-- **止盈**: 开仓价 ± 8×ATR（至少1:2风险回报）
-
-### 3. 持仓动态风险管理
-- **止损**: 根据调用频率和当前趋势评估
-- **止盈**: 根据调用频率和当前趋势评估
-
-### 4. 信心度量化标准
-- **<0.6**: 信号矛盾，强制HOLD
-- **0.6-0.7**: 小仓位试探(30)，需额外验证
-- **0.7-0.8**: 正常仓位(30-60)，一致性良好
-- **>0.8**: 加大仓位(60-80)，多信号强烈确认
-
-### 5. 趋势环境适应
-- **强势趋势**: 顺趋势交易，放宽止损
-- **横盘整理**: 减少交易频率，大部分横盘都是垃圾时间。
-- **高波动**: 降低仓位，放宽止损
-- **低波动**: 等待突破，不提前入场
-
-### 6. 持仓管理
-- 只要开仓逻辑未破坏，浮动亏损在2倍ATR内禁止平仓和收紧止损，视为正常市场噪音。
-- 浮动盈利时优先收紧止损
-- ADJUST_SL_TP 止损位只能朝有利方向调整（多单只上调，空单只下调），否则请使用平仓、观望、加仓。
-- 关注持仓快照
-- 关注memory
-
-
-## 专业交易员思维（COT模式）
-**遵循「计划交易，交易计划」的核心原则**：作为系统性交易AI，你因该严格坚持「分析-决策-执行-复盘」的完整交易闭环。每次决策必须基于明确的市场逻辑和风险计算，杜绝任何情绪化操作。所有交易行为都源自系统信号而非个人主观判断，确保策略的一致性和可重复性。
-
-**核心纪律**: 生存优先，只在高质量信号时交易，严格执行一致性检查。
-`
-
 func Of[T any](v T) *T {
 	return &v
 }
 
-// Run 执行 llm处理
-func Run(hasPosition bool, userMsg *schema.Message, currentTime ...string) (string, error) {
-	sysmsg := schema.SystemMessage(roleMsg)
-	var llmModel model.BaseChatModel
-	opts := []model.Option{}
-	model := ""
-	model = conf.Get().GetLLM(hasPosition).Model
-	llmModel, extra := GetOpenAIChatModel(hasPosition)
-	if len(extra) > 0 {
-		etOpt := openai.WithExtraFields(extra)
-		opts = append(opts, etOpt)
-	}
+// Request LLM请求
+type Request struct {
+	System   string            // 系统提示词，为空时不发送
+	Messages []*schema.Message // 不含系统提示词的对话消息
+	Output   *StructuredOutput // 不为空时按模型的输出模式请求结构化结果
+	Tools    *ToolLoop         // 不为空时模型可以在给出结论前调用工具
+}
 
-	in := []*schema.Message{sysmsg, userMsg}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*150)
-	defer cancel()
+// messages 拼接系统提示词和对话消息
+func (r Request) messages() []*schema.Message {
+	if r.System == "" {
+		return r.Messages
+	}
+	return append([]*schema.Message{schema.SystemMessage(r.System)}, r.Messages...)
+}
 
+// Generate 按配置的模型降级链执行请求，返回回复内容和实际使用的模型
+func Generate(ctx context.Context, hasPosition bool, req Request) (string, string, error) {
 	// 记录LLM调用开始时间
 	startTime := time.Now()
-	resp, e := llmModel.Generate(ctx, in, opts...)
-	// 计算LLM调用耗时
-	duration := time.Since(startTime)
+	in := req.messages()
+	resp, llmconf, e := GenerateWithFallback(ctx, hasPosition, in, req.Output, req.Tools)
+	if e != nil {
+		return "", "", e
+	}
+	logLLMUsage(ctx, llmconf, in, resp, time.Since(startTime))
+	return resp.Content, llmconf.Model, nil
+}
+
+// GenerateModel 使用指定模型执行请求，不做降级
+func GenerateModel(ctx context.Context, llmconf conf.LLMConf, req Request) (string, error) {
+	chain, err := applyCostCap([]conf.LLMConf{llmconf})
+	if err != nil {
+		return "", err
+	}
+	llmconf = chain[0]
+	policy := conf.Get().LLMPolicy
 
+	startTime := time.Now()
+	in := req.messages()
+	resp, e := generateWithRetry(ctx, llmconf, policy, in, req.Output, req.Tools)
+	recordLLMResult(ctx, llmconf.Name(), e, policy)
 	if e != nil {
 		return "", e
 	}
-	log.Printf("[LLM] model_name: %s, prompt_tokens: %d, completion_tokens: %d, total_tokens: %d, duration: %v", model, resp.ResponseMeta.Usage.PromptTokens, resp.ResponseMeta.Usage.CompletionTokens, resp.ResponseMeta.Usage.TotalTokens, duration)
-	log.Println("ReasoningContent: ", resp.ReasoningContent)
+	logLLMUsage(ctx, llmconf, in, resp, time.Since(startTime))
 	return resp.Content, nil
 }
 
+// logLLMUsage 记录LLM调用的token用量和耗时，同时记录提示词的估算token便于校准预算
+func logLLMUsage(ctx context.Context, llmconf conf.LLMConf, in []*schema.Message, resp *schema.Message, duration time.Duration) {
+	usage := &schema.TokenUsage{}
+	if resp.ResponseMeta != nil && resp.ResponseMeta.Usage != nil {
+		usage = resp.ResponseMeta.Usage
+	}
+	var estimated int
+	for _, msg := range in {
+		estimated += prompt.EstimateTokens(msg.Content)
+	}
+	cost := LLMCost(llmconf, usage.PromptTokens, usage.CompletionTokens)
+	logger.Infof(ctx, "[LLM] model_name: %s, prompt_tokens: %d (estimated: %d), completion_tokens: %d, total_tokens: %d, cost: %.4f, duration: %v", llmconf.Model, usage.PromptTokens, estimated, usage.CompletionTokens, usage.TotalTokens, cost, duration)
+	logger.Debugf(ctx, "ReasoningContent: %s", resp.ReasoningContent)
+}
+
 // GetOpenAIChatModel
 func GetOpenAIChatModel(hasPosition bool) (chatmodel *openai.ChatModel, extra map[string]any) {
-	llmconf := conf.Get().GetLLM(hasPosition)
-	chatmodel, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
+	chatmodel, extra, err := NewOpenAIChatModel(conf.Get().GetLLM(hasPosition), nil)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// NewOpenAIChatModel 根据模型配置创建 ChatModel 和额外请求参数，out 不为空时按 output_mode 设置结构化输出
+func NewOpenAIChatModel(llmconf conf.LLMConf, out *StructuredOutput) (chatmodel *openai.ChatModel, extra map[string]any, err error) {
+	config := &openai.ChatModelConfig{
 		APIKey:      llmconf.APIKey,
 		Model:       llmconf.Model,
 		BaseURL:     llmconf.BaseURL,
@@ -149,18 +101,36 @@ func GetOpenAIChatModel(hasPosition bool) (chatmodel *openai.ChatModel, extra ma
 		// FrequencyPenalty: Of(float32(0.2)),
 		// PresencePenalty:  Of(float32(0.1)),
 		// HTTPClient:       NewDebugHTTPClient(),
-	})
+	}
+	if out != nil && llmconf.OutputMode == OutputModeJSONSchema {
+		js, e := out.JSONSchema()
+		if e != nil {
+			return nil, nil, e
+		}
+		config.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        out.Name,
+				Description: out.Desc,
+				JSONSchema:  js,
+			},
+		}
+	}
+	chatmodel, err = openai.NewChatModel(context.Background(), config)
 	if err != nil {
-		panic(err)
+		return
+	}
+	if out != nil && llmconf.OutputMode == OutputModeTool {
+		if err = chatmodel.BindForcedTools([]*schema.ToolInfo{out.ToolInfo()}); err != nil {
+			return
+		}
 	}
 	extra = make(map[string]any)
 	if llmconf.Extra == "" {
 		return
 	}
-	err = json.Unmarshal([]byte(llmconf.Extra), &extra)
-	if err != nil {
-		panic(err)
+	if err = json.Unmarshal([]byte(llmconf.Extra), &extra); err != nil {
+		err = fmt.Errorf("模型%s的extra配置解析失败: %v", llmconf.Model, err)
 	}
-
 	return
 }
@@ -23,7 +23,7 @@ func init() {
 func TestRun(t *testing.T) {
 	t.Log(time.Now().Weekday() == 0)
 	return
-	t.Log(utils.Run(false, schema.UserMessage("你好，我想测试下思考的传参")))
+	t.Log(utils.Generate(context.Background(), false, utils.Request{Messages: []*schema.Message{schema.UserMessage("你好，我想测试下思考的传参")}}))
 }
 
 func TestDeepSeek(t *testing.T) {